@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// plannedRename is one rename decided before any file is touched
+type plannedRename struct {
+	mf   *mediaFile
+	From string
+	Temp string
+	To   string
+}
+
+// planRenames picks the final name of every file which needs renaming.  Names already on disk or planned for another file are taken, except, when sourcesFree is set because every file is moved aside first, names of files being renamed.  Files which keep their name are returned as unchanged, files skipped by -skip-if-exists or -skip-if-target-larger as skipped
+func planRenames(mediaFiles []*mediaFile, sourcesFree bool) (plan []*plannedRename, unchanged []*mediaFile, skipped []fileResult, err error) {
+	sources := make(map[string]bool)
+	for _, mf := range mediaFiles {
+		if needsRename(mf) {
+			sources[nameKey(mf.Path, mf.Path)] = true
+		}
+	}
+	planned := make(map[string]bool)
+	for _, group := range collisionGroups(mediaFiles) {
+		for _, mf := range group {
+			if !needsRename(mf) {
+				unchanged = append(unchanged, mf)
+				continue
+			}
+			potentialName, ext := targetName(mf)
+			dir := targetDir(mf)
+			if first := filepath.Join(dir, potentialName+ext); first != mf.Path && !planned[nameKey(first, mf.Path)] && !sources[nameKey(first, mf.Path)] {
+				if reason := existingTargetSkip(mf.Path, first); reason != "" {
+					skipped = append(skipped, fileResult{Path: mf.Path, Status: statusSkipped, Reason: reason})
+					continue
+				}
+			}
+			target := ""
+			for i := 0; i < collisionLimit(); i++ {
+				candidateName := potentialName
+				if i > 0 {
+					candidateName = potentialName + collisionSuffix(i)
+				}
+				candidate := filepath.Join(dir, candidateName+ext)
+				key := nameKey(candidate, mf.Path)
+				if planned[key] || (extensions.DoesFileExist(candidate) && !(sourcesFree && sources[key]) && candidate != mf.Path && !caseVariant(candidate, mf.Path)) || sidecarTargetTaken(mf.Path, candidate) {
+					continue
+				}
+				target = candidate
+				break
+			}
+			if target == "" {
+				return nil, nil, nil, errors.New("Could not plan rename of " + mf.Path + ": " + potentialName + ext + " already exists")
+			}
+			planned[nameKey(target, mf.Path)] = true
+			if target == mf.Path {
+				unchanged = append(unchanged, mf)
+				continue
+			}
+			plan = append(plan, &plannedRename{mf: mf, From: mf.Path, To: target})
+		}
+	}
+	return
+}
+
+// applyAtomicRenames moves every planned file to a temporary name, checks no final name has been taken meanwhile and then moves them all to their final names.  When any step fails every file is put back under its original name
+func applyAtomicRenames(plan []*plannedRename) error {
+	var moved []*plannedRename
+	rollback := func(cause error) error {
+		for i := len(moved) - 1; i >= 0; i-- {
+			if err := os.Rename(moved[i].Temp, moved[i].From); err != nil {
+				stdErr.Println("Could not roll back " + moved[i].Temp + " to " + moved[i].From + ": " + err.Error())
+			}
+		}
+		return cause
+	}
+
+	n := 0
+	for _, rename := range plan {
+		for {
+			rename.Temp = filepath.Join(filepath.Dir(rename.From), ".mediaRenamerToTimestamp-"+extensions.IntToString(n)+".tmp")
+			n++
+			if !extensions.DoesFileExist(rename.Temp) {
+				break
+			}
+		}
+		start := time.Now()
+		if err := os.Rename(rename.From, rename.Temp); err != nil {
+			return rollback(errors.New("Could not move " + rename.From + " aside: " + err.Error()))
+		}
+		traceStage(rename.From, stageRename, start)
+		moved = append(moved, rename)
+	}
+
+	for _, rename := range plan {
+		if extensions.DoesFileExist(rename.To) {
+			return rollback(errors.New("Could not rename " + rename.From + ": " + rename.To + " already exists"))
+		}
+	}
+
+	var committed []*plannedRename
+	for _, rename := range plan {
+		start := time.Now()
+		err := os.MkdirAll(filepath.Dir(rename.To), 0755)
+		if err == nil {
+			err = os.Rename(rename.Temp, rename.To)
+		}
+		traceStage(rename.From, stageRename, start)
+		if err != nil {
+			for i := len(committed) - 1; i >= 0; i-- {
+				if err := os.Rename(committed[i].To, committed[i].Temp); err != nil {
+					stdErr.Println("Could not roll back " + committed[i].To + " to " + committed[i].Temp + ": " + err.Error())
+				}
+			}
+			return rollback(errors.New("Could not rename " + rename.From + " to " + rename.To + ": " + err.Error()))
+		}
+		committed = append(committed, rename)
+	}
+	return nil
+}
+
+// renameAtomically renames every media file or, when anything fails, none of them
+func renameAtomically(mediaFiles []*mediaFile) {
+	var pending []*mediaFile
+	for _, mf := range mediaFiles {
+		if mf.Err != nil {
+			results.add(processFile(mf))
+			continue
+		}
+		pending = append(pending, mf)
+	}
+
+	plan, unchanged, skipped, err := planRenames(pending, true)
+	if err == nil {
+		err = applyAtomicRenames(plan)
+	}
+	if err != nil {
+		stdErr.Println(err.Error())
+		stdErr.Println("Rolled back, no file has been renamed")
+		for _, mf := range pending {
+			results.add(fileResult{Path: mf.Path, Status: statusFailed, Err: err})
+		}
+		return
+	}
+
+	for _, mf := range unchanged {
+		syncFileTime(mf.Path, mf.mediaTime)
+		results.add(fileResult{Path: mf.Path, Status: statusSkipped, Reason: reasonFormatted})
+	}
+	for _, result := range skipped {
+		results.add(result)
+	}
+	for _, rename := range plan {
+		oldLogName, newLogName := logNames(rename.From, rename.To)
+		logFileLine("Renamed "+oldLogName+" to "+newLogName, statusRenamed, oldLogName, newLogName, rename.mf.Source)
+		renameSidecars(rename.From, rename.To)
+		syncFileTime(rename.To, rename.mf.mediaTime)
+		results.add(fileResult{Path: rename.From, NewPath: rename.To, Status: statusRenamed})
+	}
+}
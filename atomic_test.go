@@ -0,0 +1,43 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyAtomicRenamesRollsBack(t *testing.T) {
+	tests := []struct {
+		name string
+		// second is where the second file is renamed to, first always succeeds
+		second string
+		files  []string
+	}{
+		{"target taken after planning", "taken.jpg", []string{"IMG_0001.jpg", "IMG_0002.jpg", "taken.jpg"}},
+		// a file where a folder is needed fails the final move after the first file was committed
+		{"commit fails mid run", "blocker/2021-05-01 12.30.01.jpg", []string{"IMG_0001.jpg", "IMG_0002.jpg", "blocker"}},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		for _, name := range test.files {
+			writeTestFile(t, dir, name, []byte(name))
+		}
+		plan := []*plannedRename{
+			{From: filepath.Join(dir, "IMG_0001.jpg"), To: filepath.Join(dir, "2021-05-01 12.30.00.jpg")},
+			{From: filepath.Join(dir, "IMG_0002.jpg"), To: filepath.Join(dir, filepath.FromSlash(test.second))},
+		}
+		if err := applyAtomicRenames(plan); err == nil {
+			t.Errorf("%s: applyAtomicRenames succeeded", test.name)
+		}
+		assertFiles(t, dir, test.files...)
+	}
+}
+
+func TestAtomicRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	// a name already on disk is taken for the plan too
+	writeTestFile(t, dir, "2021-05-01 12.30.00.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	mustRunMain(t, "-atomic", dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00-1.jpg", "2021-05-01 12.30.00-2.jpg", "2021-05-01 12.30.00.jpg")
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// backupDirSuffix is appended to the processed directory to name the sibling folder -backup copies it to
+const backupDirSuffix = " - Backup Exif"
+
+// backupLocation is set by -backup-dir, the folder -backup copies the directory to instead of the sibling folder
+var backupLocation string
+
+// backupPath returns the folder the backup of dir goes to
+func backupPath(dir string) string {
+	if backupLocation != "" {
+		return filepath.Clean(backupLocation)
+	}
+	return filepath.Clean(dir) + backupDirSuffix
+}
+
+// failedRunDirSuffix names the sibling folder -restore-on-mismatch moves a failed run to while it swaps the backup in
+const failedRunDirSuffix = " - Failed Run"
+
+// includeBackups is set by -include-backups, otherwise backups found while walking are left alone
+var includeBackups bool
+
+// insideDir reports whether path is dir or a path under it, once both are made absolute
+func insideDir(dir string, path string) bool {
+	absDir, errDir := filepath.Abs(dir)
+	absPath, errPath := filepath.Abs(path)
+	if errDir != nil || errPath != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isBackupDir reports whether dir is named like a folder -backup or -restore-on-mismatch leaves behind
+func isBackupDir(dir string) bool {
+	name := filepath.Base(filepath.Clean(dir))
+	return strings.HasSuffix(name, backupDirSuffix) || strings.HasSuffix(name, failedRunDirSuffix)
+}
+
+// backupIncompleteMarker is kept in a backup folder while files are copied into it.  A backup still holding it was interrupted and is resumed by the next run
+const backupIncompleteMarker = ".mediaRenamerToTimestamp-backup-incomplete"
+
+// backupInterrupted reports whether backupDir holds a backup which was interrupted while copying
+func backupInterrupted(backupDir string) bool {
+	return extensions.DoesFileExist(filepath.Join(backupDir, backupIncompleteMarker))
+}
+
+// backupDirectory copies every file under dir into backupDir keeping the folder structure
+func backupDirectory(dir string, backupDir string) error {
+	files, err := RecurseFiles(dir, nil)
+	if err != nil {
+		return err
+	}
+	return backupFiles(dir, backupDir, files)
+}
+
+// minFreeBytes is the space -min-free requires to be left on the backup volume once the backup is written
+var minFreeBytes int64
+
+// checkFreeSpace returns an error when the volume backupDir goes on can not hold files and still have minFreeBytes free.  Platforms where free space can not be read are not checked
+func checkFreeSpace(backupDir string, files []string) error {
+	needed := uint64(minFreeBytes)
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			needed += uint64(info.Size())
+		}
+	}
+	free, err := freeSpace(filepath.Dir(filepath.Clean(backupDir)))
+	if err != nil {
+		stdErr.Println("Could not check free space for " + backupDir + ": " + err.Error())
+		return nil
+	}
+	if free < needed {
+		return errors.New("Not enough free space for " + backupDir + ": the backup and -min-free need " + formatByteSize(needed) + " but only " + formatByteSize(free) + " are free")
+	}
+	return nil
+}
+
+// backupFiles copies files, which are all under dir, into backupDir keeping their path relative to dir.  An interrupted backup in backupDir is completed: files already copied with their full size are not copied again
+func backupFiles(dir string, backupDir string, files []string) error {
+	marker := filepath.Join(backupDir, backupIncompleteMarker)
+	resuming := backupInterrupted(backupDir)
+	if extensions.DoesFileExist(backupDir) && !resuming {
+		return errors.New(backupDir + " already exists, remove it or move it out of the way")
+	}
+	targets := make(map[string]string)
+	var pending []string
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(backupDir, rel)
+		if resuming && sameSize(file, target) && (!verifyBackup || verifyCopy(file, target) == nil) {
+			continue
+		}
+		targets[file] = target
+		pending = append(pending, file)
+	}
+	if resuming {
+		log.Println("Resuming the interrupted backup in " + backupDir + ", " + extensions.IntToString(len(files)-len(pending)) + " files are already copied")
+	}
+	if err := checkFreeSpace(backupDir, pending); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		return err
+	}
+	for _, file := range pending {
+		if err := copyFile(file, targets[file]); err != nil {
+			return err
+		}
+		if verifyBackup {
+			if err := verifyCopy(file, targets[file]); err != nil {
+				return err
+			}
+		}
+	}
+	if verifyBackup {
+		log.Println("Verified the sha256 of " + extensions.IntToString(len(pending)) + " copied files")
+	}
+	return os.Remove(marker)
+}
+
+// sameSize reports whether target exists and is as large as file
+func sameSize(file string, target string) bool {
+	info, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	targetInfo, err := os.Stat(target)
+	return err == nil && targetInfo.Size() == info.Size()
+}
+
+// copyFile copies file to target with the same mode, creating the folders it needs.  The contents are streamed so large videos are never held in memory
+func copyFile(file string, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	source, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	copied, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(copied, source); err != nil {
+		copied.Close()
+		return err
+	}
+	// an existing target, as when resuming a backup, keeps its mode on open
+	if err := copied.Chmod(info.Mode().Perm()); err != nil {
+		copied.Close()
+		return err
+	}
+	return copied.Close()
+}
+
+// moveFile renames file to target.  A target on another volume, such as a -quarantine-dir on an external drive, can not be renamed to, the file is copied there with its modification time and then removed
+func moveFile(file string, target string) error {
+	err := os.Rename(file, target)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if err := copyFile(file, target); err != nil {
+		os.Remove(target)
+		return err
+	}
+	if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+		os.Remove(target)
+		return err
+	}
+	return os.Remove(file)
+}
+
+// verifyBackup is set by -verify-backup, every file copied into the backup is then hashed again and compared with its source
+var verifyBackup bool
+
+// verifyCopy returns an error when target does not hold the same bytes as file
+func verifyCopy(file string, target string) error {
+	sourceHash, err := fileSHA256(file)
+	if err != nil {
+		return errors.New("Could not hash " + file + ": " + err.Error())
+	}
+	targetHash, err := fileSHA256(target)
+	if err != nil {
+		return errors.New("Could not hash " + target + ": " + err.Error())
+	}
+	if sourceHash != targetHash {
+		return errors.New("The backup copy " + target + " differs from " + file + ", sha256 " + targetHash[:12] + " instead of " + sourceHash[:12])
+	}
+	return nil
+}
+
+// countFilteredFiles counts the media files under dir
+func countFilteredFiles(dir string) int {
+	return len(filteredFiles(dir))
+}
+
+// summaryOnMismatch is set by -summary-on-mismatch, a retained backup is then followed by the list of files which differ between it and the directory
+var summaryOnMismatch bool
+
+// filteredFiles lists the media files under dir
+func filteredFiles(dir string) (media []string) {
+	files, _ := RecurseFiles(dir, nil)
+	for _, file := range files {
+		if mediaCategory(file) != "" {
+			media = append(media, file)
+		}
+	}
+	return
+}
+
+// backupDifferences matches every media file of backupDir with the file in dir it became during the run, following the renames and moves in results, quarantined files included.  missing lists the backed up files no longer found where the run put them, extra the media files of dir no backed up file accounts for, which is only known when the whole directory was backed up
+func backupDifferences(dir string, backupDir string, full bool) (missing []string, extra []string) {
+	current := make(map[string]bool)
+	for _, file := range filteredFiles(dir) {
+		current[file] = true
+	}
+	newPaths := make(map[string]string)
+	results.Lock()
+	for _, result := range results.Items {
+		if result.NewPath != "" {
+			newPaths[result.Path] = result.NewPath
+		}
+	}
+	results.Unlock()
+	for _, backup := range filteredFiles(backupDir) {
+		rel, err := filepath.Rel(backupDir, backup)
+		if err != nil {
+			continue
+		}
+		original := filepath.Join(dir, rel)
+		now := original
+		if newPath, ok := newPaths[original]; ok {
+			now = newPath
+		}
+		if current[now] {
+			delete(current, now)
+			continue
+		}
+		if !insideDir(dir, now) && extensions.DoesFileExist(now) {
+			continue
+		}
+		line := "missing: " + rel
+		if now != original {
+			line += " (renamed to " + relativeTo(dir, now) + ")"
+		}
+		missing = append(missing, line)
+	}
+	sort.Strings(missing)
+	if !full {
+		return
+	}
+	for file := range current {
+		extra = append(extra, "extra: "+relativeTo(dir, file)+" (not in the backup)")
+	}
+	sort.Strings(extra)
+	return
+}
+
+// relativeTo returns file relative to dir, or file itself when it is not under dir
+func relativeTo(dir string, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return file
+}
+
+// reportBackupDifferences prints the files which differ between dir and a retained backup for -summary-on-mismatch
+func reportBackupDifferences(dir string, backupDir string, full bool) {
+	if !summaryOnMismatch {
+		return
+	}
+	missing, extra := backupDifferences(dir, backupDir, full)
+	if len(missing)+len(extra) == 0 {
+		stdErr.Println("Every backed up file was found where the run put it")
+		return
+	}
+	stdErr.Println("Files differing between " + dir + " and " + backupDir + ":\n  " + strings.Join(append(missing, extra...), "\n  "))
+}
+
+// movedOutside lists the files the run renamed into a -move-to tree or quarantined into a -quarantine-dir outside dir.  The backup taken before still holds them, so they are added to what dir holds when the counts are compared
+func movedOutside(dir string) (moved []string) {
+	results.Lock()
+	defer results.Unlock()
+	for _, result := range results.Items {
+		if result.NewPath != "" && !insideDir(dir, result.NewPath) && extensions.DoesFileExist(result.NewPath) {
+			moved = append(moved, result.NewPath)
+		}
+	}
+	return
+}
+
+// removeMovedOutside removes the files the run moved out of dir and their sidecars once the backup holding them under their original names is restored, so the library is not left with two copies
+func removeMovedOutside(dir string) {
+	for _, file := range movedOutside(dir) {
+		base := strings.TrimSuffix(file, filepath.Ext(file))
+		for _, ext := range sidecarExtensions {
+			for _, sidecarExt := range []string{"." + ext, "." + strings.ToLower(ext)} {
+				if err := os.Remove(base + sidecarExt); err != nil && !os.IsNotExist(err) {
+					stdErr.Println("Could not remove " + base + sidecarExt + ": " + err.Error())
+				}
+			}
+		}
+		if err := os.Remove(file); err != nil {
+			stdErr.Println("Could not remove " + file + ": " + err.Error())
+		}
+	}
+}
+
+// checkBackup removes backupDir when it holds as many media files as dir does after the run, counting those moved outside it, otherwise it is kept for the user to compare and false is returned
+func checkBackup(dir string, backupDir string) bool {
+	originalCount := countFilteredFiles(dir) + len(movedOutside(dir))
+	backupCount := countFilteredFiles(backupDir)
+	if originalCount != backupCount {
+		stdErr.Println("Retaining backup " + backupDir + ": it holds " + extensions.IntToString(backupCount) + " media files but " + dir + " now holds " + extensions.IntToString(originalCount))
+		reportBackupDifferences(dir, backupDir, true)
+		return false
+	}
+	removeBackup(backupDir)
+	return true
+}
+
+// checkPartialBackup is checkBackup for -backup-processed-only.  The backup must hold every file planned for renaming and dir must hold as many media files as before the renames
+func checkPartialBackup(dir string, backupDir string, countBefore int, planned int) bool {
+	originalCount := countFilteredFiles(dir) + len(movedOutside(dir))
+	backupCount := countFilteredFiles(backupDir)
+	if originalCount != countBefore || backupCount != planned {
+		stdErr.Println("Retaining backup " + backupDir + ": " + dir + " held " + extensions.IntToString(countBefore) + " media files before renaming and " + extensions.IntToString(originalCount) + " after, the backup holds " + extensions.IntToString(backupCount) + " of " + extensions.IntToString(planned) + " files planned for renaming")
+		reportBackupDifferences(dir, backupDir, false)
+		return false
+	}
+	removeBackup(backupDir)
+	return true
+}
+
+// restoreBackup replaces dir with the full backup taken before the run and removes the files the run moved out of it.  dir is first moved to a sibling folder so nothing is lost if the swap fails half way
+func restoreBackup(dir string, backupDir string) error {
+	dir = filepath.Clean(dir)
+	failedDir := dir + failedRunDirSuffix
+	if extensions.DoesFileExist(failedDir) {
+		return errors.New(failedDir + " already exists, remove it or move it out of the way")
+	}
+	// the restored directory is as it was before the run, there is nothing left to undo
+	if err := os.Remove(filepath.Join(backupDir, renameManifestName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(dir, failedDir); err != nil {
+		return err
+	}
+	err := os.Rename(backupDir, dir)
+	if errors.Is(err, syscall.EXDEV) {
+		// a -backup-dir on another volume is copied back instead
+		err = backupDirectory(backupDir, dir)
+		if err == nil {
+			err = os.RemoveAll(backupDir)
+		} else {
+			os.RemoveAll(dir)
+		}
+	}
+	if err != nil {
+		if errUndo := os.Rename(failedDir, dir); errUndo != nil {
+			return errors.New(err.Error() + ", the renamed files are left in " + failedDir)
+		}
+		return err
+	}
+	removeMovedOutside(dir)
+	if err := moveExcluded(failedDir, dir); err != nil {
+		stdErr.Println(err.Error() + ", " + failedDir + " is kept")
+		return nil
+	}
+	if err := os.RemoveAll(failedDir); err != nil {
+		stdErr.Println("Could not remove " + failedDir + ": " + err.Error())
+	}
+	return nil
+}
+
+// restorePartialBackup undoes a run backed up with -backup-processed-only: every renamed file is copied back from backupDir under its original name and its new name removed, sidecars are renamed back and files moved aside by deduping are moved back
+func restorePartialBackup(dir string, backupDir string) error {
+	results.Lock()
+	items := append([]fileResult(nil), results.Items...)
+	results.Unlock()
+	for _, result := range items {
+		switch result.Status {
+		case statusRenamed:
+			rel, err := filepath.Rel(dir, result.Path)
+			if err != nil {
+				return err
+			}
+			backup := filepath.Join(backupDir, rel)
+			if !extensions.DoesFileExist(backup) {
+				return errors.New("Could not restore " + result.Path + ": it is missing from " + backupDir)
+			}
+			if err := copyFile(backup, result.Path); err != nil {
+				return errors.New("Could not restore " + result.Path + ": " + err.Error())
+			}
+			// the renamed file may be the one that went missing
+			if err := os.Remove(result.NewPath); err != nil && !os.IsNotExist(err) {
+				return errors.New("Could not remove " + result.NewPath + ": " + err.Error())
+			}
+			renameSidecars(result.NewPath, result.Path)
+		case statusMoved:
+			if err := os.Rename(result.NewPath, result.Path); err != nil {
+				return errors.New("Could not move " + result.NewPath + " back: " + err.Error())
+			}
+		}
+	}
+	return os.RemoveAll(backupDir)
+}
+
+func removeBackup(backupDir string) {
+	keepRenameManifest(backupDir)
+	if err := os.RemoveAll(backupDir); err != nil {
+		stdErr.Println("Could not remove backup " + backupDir + ": " + err.Error())
+		return
+	}
+	log.Println("File counts match, removed backup " + backupDir)
+}
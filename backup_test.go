@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "photos")
+	renamed := writeTestFile(t, dir, "IMG_0001.jpg", []byte("one"))
+	nested := writeTestFile(t, dir, "trip/IMG_0002.jpg", []byte("two"))
+	writeTestFile(t, dir, "2021-05-01 12.30.00.jpg", []byte("named"))
+	writeTestFile(t, dir, "notes.txt", []byte("notes"))
+	if err := backupFiles(dir, backupPath(dir), []string{renamed, nested}); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, backupPath(dir), "IMG_0001.jpg", "trip/IMG_0002.jpg")
+}
+
+func TestResumeBackup(t *testing.T) {
+	tests := []struct {
+		name   string
+		marker bool
+		fail   bool
+	}{
+		{"interrupted backup completed", true, false},
+		{"finished backup left alone", false, true},
+	}
+	for _, test := range tests {
+		dir := filepath.Join(t.TempDir(), "photos")
+		backupDir := backupPath(dir)
+		copied := writeTestFile(t, dir, "IMG_0001.jpg", []byte("one"))
+		truncated := writeTestFile(t, dir, "IMG_0002.jpg", []byte("two"))
+		missing := writeTestFile(t, dir, "trip/IMG_0003.jpg", []byte("three"))
+		// the power went out while IMG_0002.jpg was copied, the copy of IMG_0001.jpg is marked to tell whether it is copied again
+		writeTestFile(t, backupDir, "IMG_0001.jpg", []byte("ONE"))
+		writeTestFile(t, backupDir, "IMG_0002.jpg", []byte("tw"))
+		if test.marker {
+			writeTestFile(t, backupDir, backupIncompleteMarker, nil)
+		}
+		err := backupFiles(dir, backupDir, []string{copied, truncated, missing})
+		if (err != nil) != test.fail {
+			t.Errorf("%s: backupFiles error %v, want failure %v", test.name, err, test.fail)
+			continue
+		}
+		if test.fail {
+			assertFiles(t, backupDir, "IMG_0001.jpg", "IMG_0002.jpg")
+			continue
+		}
+		assertFiles(t, backupDir, "IMG_0001.jpg", "IMG_0002.jpg", "trip/IMG_0003.jpg")
+		for file, want := range map[string]string{"IMG_0001.jpg": "ONE", "IMG_0002.jpg": "two", "trip/IMG_0003.jpg": "three"} {
+			if data, _ := os.ReadFile(filepath.Join(backupDir, file)); string(data) != want {
+				t.Errorf("%s: backup of %s holds %q, want %q", test.name, file, data, want)
+			}
+		}
+	}
+}
+
+func TestResumeBackupRun(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "photos")
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	writeTestFile(t, dir, "IMG_0001.jpg", photo)
+	writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	writeTestFile(t, backupPath(dir), "IMG_0001.jpg", photo)
+	writeTestFile(t, backupPath(dir), backupIncompleteMarker, nil)
+	output := mustRunMain(t, "-backup", dir)
+	for _, want := range []string{"Resuming the interrupted backup in " + backupPath(dir) + ", 1 files are already copied", "File counts match, removed backup"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg", "2021-05-02 08.00.00.jpg")
+}
+
+func TestBackupProcessedOnly(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "photos")
+	writeTestFile(t, dir, "2021-05-01 12.30.00.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	writeTestFile(t, dir, "trip/IMG_0002.jpg", jpegWithExif(exifTiff("", "2021:05:03 09:00:00")))
+	writeTestFile(t, dir, "no date.jpg", jpegWithExif(exifTiff("", "")))
+	writeTestFile(t, dir, "notes.txt", []byte("notes"))
+	output := mustRunMain(t, "-backup", "-backup-processed-only", dir)
+	// the named file, the one without a date and the text file are left out of the backup
+	for _, want := range []string{"Backing up 2 files to be renamed", "File counts match, removed backup"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg", "2021-05-02 08.00.00.jpg", "no date.jpg", "notes.txt", "trip/2021-05-03 09.00.00.jpg")
+}
+
+func TestRestoreBackupAfterMismatch(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "photos")
+	first := writeTestFile(t, dir, "IMG_0001.jpg", []byte("one"))
+	second := writeTestFile(t, dir, "trip/IMG_0002.jpg", []byte("two"))
+	writeTestFile(t, dir, "notes.txt", []byte("notes"))
+	backupDir := backupPath(dir)
+	if err := backupDirectory(dir, backupDir); err != nil {
+		t.Fatal(err)
+	}
+	// a run which renamed one file and lost another
+	if err := os.Rename(first, filepath.Join(dir, "2021-05-01 12.30.00.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(second); err != nil {
+		t.Fatal(err)
+	}
+	if checkBackup(dir, backupDir) {
+		t.Fatal("checkBackup matched after a file went missing")
+	}
+	if err := restoreBackup(dir, backupDir); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, dir, "IMG_0001.jpg", "notes.txt", "trip/IMG_0002.jpg")
+	for _, gone := range []string{backupDir, dir + failedRunDirSuffix} {
+		if _, err := os.Stat(gone); !os.IsNotExist(err) {
+			t.Errorf("%s is left behind", gone)
+		}
+	}
+}
+
+func TestMoveToBackup(t *testing.T) {
+	t.Cleanup(func() { results = runResults{} })
+	root := t.TempDir()
+	dir := filepath.Join(root, "import")
+	library := filepath.Join(root, "library")
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "undated.jpg", jpegWithExif(exifTiff("", "")))
+	// the renamed file left the directory for the library but is still one of its files
+	output := mustRunMain(t, "-backup", "-strict", "-move-to", library, dir)
+	if !strings.Contains(output, "File counts match, removed backup") {
+		t.Errorf("the backup did not match:\n%s", output)
+	}
+	assertFiles(t, dir, "undated.jpg")
+	assertFiles(t, library, "2021/2021-05/2021-05-01 12.30.00.jpg")
+}
+
+func TestRestoreBackupRemovesMovedFiles(t *testing.T) {
+	t.Cleanup(func() { results = runResults{} })
+	root := t.TempDir()
+	dir := filepath.Join(root, "import")
+	first := writeTestFile(t, dir, "IMG_0001.jpg", []byte("one"))
+	writeTestFile(t, dir, "IMG_0001.AAE", []byte("edits"))
+	second := writeTestFile(t, dir, "IMG_0002.jpg", []byte("two"))
+	backupDir := backupPath(dir)
+	if err := backupDirectory(dir, backupDir); err != nil {
+		t.Fatal(err)
+	}
+	// a -move-to run which moved one file and its sidecar into the library and lost another
+	moved := filepath.Join(root, "library", "2021-05-01 12.30.00.jpg")
+	if err := os.MkdirAll(filepath.Dir(moved), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(first, moved); err != nil {
+		t.Fatal(err)
+	}
+	renameSidecars(first, moved)
+	results.add(fileResult{Path: first, NewPath: moved, Status: statusRenamed})
+	if err := os.Remove(second); err != nil {
+		t.Fatal(err)
+	}
+	if checkBackup(dir, backupDir) {
+		t.Fatal("checkBackup matched after a file went missing")
+	}
+	if err := restoreBackup(dir, backupDir); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, root, "import/IMG_0001.AAE", "import/IMG_0001.jpg", "import/IMG_0002.jpg")
+}
+
+func TestRestorePartialBackupAfterMismatch(t *testing.T) {
+	t.Cleanup(func() { results = runResults{} })
+	dir := filepath.Join(t.TempDir(), "photos")
+	first := writeTestFile(t, dir, "IMG_0001.jpg", []byte("one"))
+	second := writeTestFile(t, dir, "IMG_0002.jpg", []byte("two"))
+	writeTestFile(t, dir, "2021-05-01 08.00.00.jpg", []byte("named"))
+	backupDir := backupPath(dir)
+	if err := backupFiles(dir, backupDir, []string{first, second}); err != nil {
+		t.Fatal(err)
+	}
+	renamed := []string{filepath.Join(dir, "2021-05-01 12.30.00.jpg"), filepath.Join(dir, "2021-05-01 12.30.01.jpg")}
+	for i, file := range []string{first, second} {
+		if err := os.Rename(file, renamed[i]); err != nil {
+			t.Fatal(err)
+		}
+		results.add(fileResult{Path: file, NewPath: renamed[i], Status: statusRenamed})
+	}
+	// the second renamed file went missing after the run
+	if err := os.Remove(renamed[1]); err != nil {
+		t.Fatal(err)
+	}
+	if checkPartialBackup(dir, backupDir, 3, 2) {
+		t.Fatal("checkPartialBackup matched after a file went missing")
+	}
+	if err := restorePartialBackup(dir, backupDir); err != nil {
+		t.Fatal(err)
+	}
+	assertFiles(t, dir, "2021-05-01 08.00.00.jpg", "IMG_0001.jpg", "IMG_0002.jpg")
+	if _, err := os.Stat(backupDir); !os.IsNotExist(err) {
+		t.Errorf("%s is left behind", backupDir)
+	}
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	restoreAfterTest(t, &minFreeBytes)
+	dir := t.TempDir()
+	file := writeTestFile(t, dir, "photos/IMG_0001.jpg", make([]byte, 1024))
+	free, err := freeSpace(dir)
+	if err != nil {
+		t.Skip("free space can not be read here: " + err.Error())
+	}
+	tests := []struct {
+		minFree int64
+		fail    bool
+	}{
+		{0, false},
+		// the file no longer fits once the margin takes all but a few bytes of the volume
+		{int64(free) - 10, true},
+		{1 << 60, true},
+	}
+	for _, test := range tests {
+		minFreeBytes = test.minFree
+		err := checkFreeSpace(filepath.Join(dir, "photos - Backup"), []string{file})
+		if (err != nil) != test.fail {
+			t.Errorf("checkFreeSpace with -min-free %d of %d free: %v, want failure %v", test.minFree, free, err, test.fail)
+		}
+	}
+}
+
+func TestBackupAbortsWithoutSpace(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "photos")
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	for _, args := range [][]string{{"-backup"}, {"-backup", "-backup-processed-only"}} {
+		output, err := runMain(t, append(args, "-min-free", "1000TB", dir)...)
+		if err == nil || !strings.Contains(output, "Not enough free space for "+backupPath(dir)) {
+			t.Errorf("%q exited with %v:\n%s", args, err, output)
+		}
+		assertFiles(t, dir, "IMG_0001.jpg")
+		if _, err := os.Stat(backupPath(dir)); !os.IsNotExist(err) {
+			t.Errorf("%q left a partial backup", args)
+		}
+	}
+}
+
+func TestIsBackupDir(t *testing.T) {
+	tests := []struct {
+		dir  string
+		want bool
+	}{
+		{"photos" + backupDirSuffix, true},
+		{"photos" + failedRunDirSuffix + string(filepath.Separator), true},
+		{filepath.Join("photos"+backupDirSuffix, "2021"), false},
+		{"photos", false},
+	}
+	for _, test := range tests {
+		if got := isBackupDir(test.dir); got != test.want {
+			t.Errorf("isBackupDir(%q) = %v, want %v", test.dir, got, test.want)
+		}
+	}
+}
+
+func TestIncludeBackups(t *testing.T) {
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"backups left alone", nil, []string{"2021-05-01 12.30.00.jpg", "old" + backupDirSuffix + "/b.jpg", "old" + failedRunDirSuffix + "/c.jpg"}},
+		{"backups renamed", []string{"-include-backups"}, []string{"2021-05-01 12.30.00.jpg", "old" + backupDirSuffix + "/2021-05-01 12.30.00.jpg", "old" + failedRunDirSuffix + "/2021-05-01 12.30.00.jpg"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, dir, "a.jpg", photo)
+			writeTestFile(t, filepath.Join(dir, "old"+backupDirSuffix), "b.jpg", photo)
+			writeTestFile(t, filepath.Join(dir, "old"+failedRunDirSuffix), "c.jpg", photo)
+			mustRunMain(t, append(test.args, dir)...)
+			assertFiles(t, dir, test.want...)
+		})
+	}
+}
+
+func TestIncludeBackupsPointedAt(t *testing.T) {
+	backupDir := filepath.Join(t.TempDir(), "photos"+backupDirSuffix)
+	writeTestFile(t, backupDir, "a.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	if output, err := runMain(t, backupDir); err == nil || !strings.Contains(output, "pass -include-backups") {
+		t.Errorf("run on a backup without -include-backups: %v\n%s", err, output)
+	}
+	assertFiles(t, backupDir, "a.jpg")
+	mustRunMain(t, "-include-backups", backupDir)
+	assertFiles(t, backupDir, "2021-05-01 12.30.00.jpg")
+}
+
+func TestBackupDifferences(t *testing.T) {
+	t.Cleanup(func() { results = runResults{} })
+	tests := []struct {
+		name        string
+		full        bool
+		wantMissing []string
+		wantExtra   []string
+	}{
+		{"full backup", true, []string{"missing: IMG_0002.jpg (renamed to 2021-05-01 12.30.01.jpg)", "missing: trip/IMG_0003.jpg"}, []string{"extra: IMG_0004.jpg (not in the backup)"}},
+		{"processed only", false, []string{"missing: IMG_0002.jpg (renamed to 2021-05-01 12.30.01.jpg)", "missing: trip/IMG_0003.jpg"}, nil},
+	}
+	for _, test := range tests {
+		results = runResults{}
+		dir := filepath.Join(t.TempDir(), "photos")
+		first := writeTestFile(t, dir, "IMG_0001.jpg", []byte("one"))
+		second := writeTestFile(t, dir, "IMG_0002.jpg", []byte("two"))
+		third := writeTestFile(t, dir, "trip/IMG_0003.jpg", []byte("three"))
+		writeTestFile(t, dir, "notes.txt", []byte("notes"))
+		backupDir := backupPath(dir)
+		if err := backupFiles(dir, backupDir, []string{first, second, third}); err != nil {
+			t.Fatal(err)
+		}
+		renamed := []string{filepath.Join(dir, "2021-05-01 12.30.00.jpg"), filepath.Join(dir, "2021-05-01 12.30.01.jpg")}
+		for i, file := range []string{first, second} {
+			if err := os.Rename(file, renamed[i]); err != nil {
+				t.Fatal(err)
+			}
+			results.add(fileResult{Path: file, NewPath: renamed[i], Status: statusRenamed})
+		}
+		// a renamed file and one the run never touched went missing, a file nobody backed up turned up
+		for _, file := range []string{renamed[1], third} {
+			if err := os.Remove(file); err != nil {
+				t.Fatal(err)
+			}
+		}
+		writeTestFile(t, dir, "IMG_0004.jpg", []byte("four"))
+		missing, extra := backupDifferences(dir, backupDir, test.full)
+		if strings.Join(missing, "\n") != strings.Join(test.wantMissing, "\n") {
+			t.Errorf("%s: missing = %q, want %q", test.name, missing, test.wantMissing)
+		}
+		if strings.Join(extra, "\n") != strings.Join(test.wantExtra, "\n") {
+			t.Errorf("%s: extra = %q, want %q", test.name, extra, test.wantExtra)
+		}
+	}
+}
+
+func TestSummaryOnMismatch(t *testing.T) {
+	restoreAfterTest(t, &summaryOnMismatch)
+	summaryOnMismatch = true
+	dir := filepath.Join(t.TempDir(), "photos")
+	lost := writeTestFile(t, dir, "IMG_0001.jpg", []byte("one"))
+	writeTestFile(t, dir, "IMG_0002.jpg", []byte("two"))
+	backupDir := backupPath(dir)
+	if err := backupDirectory(dir, backupDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(lost); err != nil {
+		t.Fatal(err)
+	}
+	saved := stdErr.Writer()
+	t.Cleanup(func() { stdErr.SetOutput(saved) })
+	var logged bytes.Buffer
+	stdErr.SetOutput(&logged)
+	if checkBackup(dir, backupDir) {
+		t.Fatal("checkBackup matched after a file went missing")
+	}
+	output := logged.String()
+	want := "Files differing between " + dir + " and " + backupDir + ":\n  missing: IMG_0001.jpg"
+	if !strings.Contains(output, want) {
+		t.Errorf("output lacks %q:\n%s", want, output)
+	}
+}
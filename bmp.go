@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+)
+
+// bmpExtensions are Windows bitmaps, which have no metadata to hold a capture time
+var bmpExtensions = []string{
+	"BMP",
+}
+
+// bmpModTime is set by -bmp-mtime to name bitmaps after their file modification time, otherwise they are skipped as having no date
+var bmpModTime bool
+
+// bmpTime returns the capture time of a bitmap: its modification time with -bmp-mtime, errNoDate without.  Files not starting with the BM signature are an error
+func bmpTime(data []byte, fileWork string) (mediaTime, error) {
+	if !bytes.HasPrefix(data, []byte("BM")) {
+		return mediaTime{}, errors.New("Could not read BMP " + fileWork + ": no BM signature")
+	}
+	if !bmpModTime {
+		return mediaTime{}, errNoDate
+	}
+	info, err := os.Stat(fileWork)
+	if err != nil {
+		return mediaTime{}, errors.New("Could not Stat " + fileWork + ": " + err.Error())
+	}
+	return mediaTime{Time: info.ModTime().Local(), Zoned: true, Source: sourceModTime}, nil
+}
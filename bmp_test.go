@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBmpTime(t *testing.T) {
+	restoreAfterTest(t, &bmpModTime)
+	data, err := os.ReadFile(filepath.Join("testdata", "pixel.bmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := writeTestFile(t, t.TempDir(), "pixel.bmp", data)
+	modified := time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		modTime bool
+		want    time.Time
+		err     error
+		fail    bool
+	}{
+		{"no date without -bmp-mtime", data, false, time.Time{}, errNoDate, true},
+		{"modification time", data, true, modified, nil, false},
+		{"no BM signature", []byte("GIF89a"), true, time.Time{}, nil, true},
+	}
+	for _, test := range tests {
+		bmpModTime = test.modTime
+		got, err := bmpTime(test.data, file)
+		if (err != nil) != test.fail || test.err != nil && err != test.err {
+			t.Errorf("%s: bmpTime error %v, want failure %v (%v)", test.name, err, test.fail, test.err)
+			continue
+		}
+		if !test.fail && (!got.Time.Equal(test.want) || got.Source != sourceModTime) {
+			t.Errorf("%s: bmpTime = %v from %s, want %v", test.name, got.Time, got.Source, test.want)
+		}
+		if err != nil && strings.Contains(err.Error(), "exif") {
+			t.Errorf("%s: bmpTime reports an Exif error: %v", test.name, err)
+		}
+	}
+}
+
+func TestBmpFallbacks(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"skipped without a fallback", nil, []string{"Screenshot_20210501_123000.bmp", "pixel.bmp"}},
+		{"file name", []string{"-parse-filename-date"}, []string{"2021-05-01 12.30.00.bmp", "pixel.bmp"}},
+		{"modification time", []string{"-bmp-mtime"}, []string{"2020-02-03 04.05.06.bmp", "2020-02-03 04.05.06-1.bmp"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			modified := time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)
+			for _, name := range []string{"Screenshot_20210501_123000.bmp", "pixel.bmp"} {
+				file := copyTestdata(t, dir, "pixel.bmp", name)
+				if err := os.Chtimes(file, modified, modified); err != nil {
+					t.Fatal(err)
+				}
+			}
+			output := mustRunMain(t, append(test.args, dir)...)
+			assertFiles(t, dir, test.want...)
+			if !strings.Contains(output, "failed 0") || strings.Contains(output, "exif") {
+				t.Errorf("bitmaps were reported as broken:\n%s", output)
+			}
+		})
+	}
+}
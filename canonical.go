@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// groupTree is the -tree template of the folder, relative to groupRoot, -canonical and -tree file each media file into
+var groupTree = "%Y/%m"
+
+// groupRoot is set by -canonical and -tree to the processed directory, or by -move-to to another folder, media files are then renamed into its dated folders instead of staying where they are
+var groupRoot string
+
+// defaultTree is the -tree template -move-to uses when none is given
+const defaultTree = "%Y/%Y-%m"
+
+// treeTokens are the % tokens of a -tree template and the Go time layouts they are formatted with
+var treeTokens = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+	'B': "January",
+	'b': "Jan",
+	'j': "002",
+}
+
+// renderTree formats a -tree template for t.  Text other than the tokens is kept as it is, %% is a percent sign
+func renderTree(template string, t time.Time) string {
+	var folder strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			folder.WriteByte(template[i])
+			continue
+		}
+		i++
+		if layout, ok := treeTokens[template[i]]; ok {
+			folder.WriteString(t.Format(layout))
+		} else {
+			folder.WriteByte(template[i])
+		}
+	}
+	return folder.String()
+}
+
+// checkTree reports a -tree template with unknown tokens, no token at all or folders which would leave the root
+func checkTree(template string) error {
+	hasToken := false
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' {
+			continue
+		}
+		if i+1 == len(template) {
+			return errors.New("it ends in a lone %")
+		}
+		i++
+		if template[i] == '%' {
+			continue
+		}
+		if _, ok := treeTokens[template[i]]; !ok {
+			return errors.New("unknown token %" + string(template[i]) + ", use %Y, %y, %m, %d, %H, %B, %b or %j")
+		}
+		hasToken = true
+	}
+	if !hasToken {
+		return errors.New("it needs at least one token such as %Y")
+	}
+	for _, folder := range strings.Split(template, "/") {
+		if folder == "" || folder == "." || folder == ".." {
+			return errors.New("its folders can not be empty, . or ..")
+		}
+	}
+	return nil
+}
+
+// flattenRoot is set by -flatten to the processed directory, media files in its subfolders are then renamed into it
+var flattenRoot string
+
+// targetDir returns the folder a media file with a capture time is renamed into.  With both -organize-by-location and -canonical the YYYY/MM folders are inside the country folder
+func targetDir(mf *mediaFile) string {
+	if flattenRoot != "" {
+		return flattenRoot
+	}
+	if groupRoot == "" && locationRoot == "" {
+		return filepath.Dir(mf.Path)
+	}
+	dir := groupRoot
+	if locationRoot != "" {
+		dir = locationDir(mf)
+	}
+	if groupRoot == "" {
+		return dir
+	}
+	return filepath.Join(dir, filepath.FromSlash(renderTree(groupTree, displayTime(mf.mediaTime))))
+}
+
+// logNames returns how a rename from oldPath to newPath is named in the log: the file names, or the paths when the file changes folders
+func logNames(oldPath string, newPath string) (string, string) {
+	if filepath.Dir(oldPath) != filepath.Dir(newPath) {
+		return oldPath, newPath
+	}
+	return filepath.Base(oldPath), filepath.Base(newPath)
+}
+
+// planDedupeIdentical groups files sharing a size and sha256 anywhere under the processed directory and plans removing all but the first of each group by path.  Only files colliding on capture time and size are hashed, identical files read the same so files without a date are compared among themselves
+func planDedupeIdentical(mediaFiles []*mediaFile) (plan []dedupeAction) {
+	groups := make(map[string][]*mediaFile)
+	var keys []string
+	for _, mf := range mediaFiles {
+		info, err := os.Stat(mf.Path)
+		if err != nil {
+			continue
+		}
+		key := "undated"
+		if mf.Err == nil {
+			key = mf.Time.String()
+		}
+		key += "|" + strconv.FormatInt(info.Size(), 10)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], mf)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			return group[i].Path < group[j].Path
+		})
+		byHash := make(map[string]*dedupeAction)
+		var hashes []string
+		for _, mf := range group {
+			hash, err := fileSHA256(mf.Path)
+			if err != nil {
+				stdErr.Println("Could not hash " + mf.Path + ": " + err.Error())
+				continue
+			}
+			action, ok := byHash[hash]
+			if !ok {
+				byHash[hash] = &dedupeAction{Keep: mf, Reason: "identical content, sha256 " + hash[:12], SHA256: hash}
+				hashes = append(hashes, hash)
+				continue
+			}
+			action.Remove = append(action.Remove, mf)
+		}
+		for _, hash := range hashes {
+			if action := byHash[hash]; len(action.Remove) > 0 {
+				plan = append(plan, *action)
+			}
+		}
+	}
+	return
+}
+
+// identicalDuplicates counts the files a plan removes for having identical content and the bytes they take
+func identicalDuplicates(plan []dedupeAction) (count int, size uint64) {
+	for _, action := range plan {
+		if action.SHA256 == "" {
+			continue
+		}
+		for _, mf := range action.Remove {
+			count++
+			if info, err := os.Stat(mf.Path); err == nil {
+				size += uint64(info.Size())
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalRun(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	dir := filepath.Join(t.TempDir(), "photos")
+	photo := jpegWithExif(exifTiff("", "2019:05:06 07:08:09"))
+	writeTestFile(t, dir, "trip/IMG_0001.jpg", photo)
+	// the same picture imported twice, once under another name
+	writeTestFile(t, dir, "IMG_0001 copy.jpg", photo)
+	// the HEIC original and its JPEG export share a capture time
+	copyTestdata(t, dir, "gainmap.heic", "IMG_0002.HEIC")
+	writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("", "2022:07:08 09:10:11")))
+	writeTestFile(t, dir, "clip.mp4", mp4WithTime(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+	writeTestFile(t, dir, "2021-05-01 12.30.00.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "no date.jpg", jpegWithExif(exifTiff("", "")))
+	writeTestFile(t, dir, "notes.txt", []byte("notes"))
+
+	output := mustRunMain(t, "-canonical", "-prefer-format", "heic,jpg", dir)
+	organized := []string{
+		"2019/05/2019-05-06 07.08.09.jpg",
+		"2020/01/2020-01-02 03.04.05.mp4",
+		"2021/05/2021-05-01 12.30.00.jpg",
+		"2022/07/2022-07-08 09.10.11.HEIC",
+		"duplicates/IMG_0002.jpg",
+		"duplicates/trip/IMG_0001.jpg",
+		"no date.jpg",
+		"notes.txt",
+	}
+	assertFiles(t, dir, organized...)
+	// the first copy by path is kept, the backup was taken once and removed once the counts matched
+	if _, err := os.Stat(backupPath(dir)); !os.IsNotExist(err) {
+		t.Errorf("the backup was left behind: %v", err)
+	}
+	if want := "File counts match, removed backup"; strings.Count(output, want) != 1 {
+		t.Errorf("output holds %q %d times, want once:\n%s", want, strings.Count(output, want), output)
+	}
+
+	// an organized directory is left as it is
+	mustRunMain(t, "-canonical", "-prefer-format", "heic,jpg", dir)
+	assertFiles(t, dir, organized...)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// collisionFormat is set by -collision-format, the fmt verb giving the suffix of the n-th file bound for a taken name, e.g. _%03d for _001
+var collisionFormat = "-%d"
+
+var collisionFormatRegexp = regexp.MustCompile(`^([^%/\\]*)%(0?)(\d*)d([^%/\\]*)$`)
+
+// checkCollisionFormat reports a -collision-format which is not a single integer verb between text that can go into a file name
+func checkCollisionFormat(format string) error {
+	match := collisionFormatRegexp.FindStringSubmatch(format)
+	if match == nil {
+		return errors.New("Invalid -collision-format " + format + ", it needs one %d (optionally zero padded like %03d) and no other verbs or path separators")
+	}
+	if match[1] == "" && match[4] == "" {
+		return errors.New("Invalid -collision-format " + format + ", the number needs a separator from the name such as - or _")
+	}
+	return nil
+}
+
+// collisionSuffix returns the suffix of the n-th file bound for a taken name
+func collisionSuffix(n int) string {
+	return fmt.Sprintf(collisionFormat, n)
+}
+
+// collisionLimit is how many names are tried for a file, colisionMax or fewer when zero padding fixes the width of the number so it can not grow past it, 999 suffixes for %03d
+func collisionLimit() int {
+	match := collisionFormatRegexp.FindStringSubmatch(collisionFormat)
+	if match == nil || match[2] != "0" || match[3] == "" {
+		return colisionMax
+	}
+	width, _ := strconv.Atoi(match[3])
+	limit := 1
+	for i := 0; i < width && limit < colisionMax; i++ {
+		limit *= 10
+	}
+	if limit > colisionMax {
+		return colisionMax
+	}
+	return limit
+}
+
+// collisionSuffixPattern is a regexp matching any suffix collisionSuffix gives
+func collisionSuffixPattern() string {
+	match := collisionFormatRegexp.FindStringSubmatch(collisionFormat)
+	if match == nil {
+		return `-\d+`
+	}
+	return regexp.QuoteMeta(match[1]) + `\d+` + regexp.QuoteMeta(match[4])
+}
+
+// trailingSuffixRegexp and suffixChainRegexp match names ending in one, or two or more, collision suffixes.  They are compiled again once -collision-format is parsed
+var trailingSuffixRegexp, suffixChainRegexp = compileCollisionRegexps()
+
+// compileCollisionRegexps compiles the regexps matching the collision suffixes of collisionFormat
+func compileCollisionRegexps() (trailing *regexp.Regexp, chain *regexp.Regexp) {
+	pattern := collisionSuffixPattern()
+	return regexp.MustCompile(`^(.+?)(?:` + pattern + `)$`), regexp.MustCompile(`^(.*?)(?:` + pattern + `){2,}$`)
+}
+
+// trimCollisionSuffix returns fileName without the collision suffix it ends in, e.g. 2021-05-01 12.30.00 for 2021-05-01 12.30.00-1
+func trimCollisionSuffix(fileName string) (string, bool) {
+	match := trailingSuffixRegexp.FindStringSubmatch(fileName)
+	if match == nil {
+		return fileName, false
+	}
+	return match[1], true
+}
+
+var sequenceNumberRegexp = regexp.MustCompile(`\d+`)
+
+// sequenceNumber returns the last run of digits in a file's original name, e.g. 42 for IMG_0042.JPG, which cameras count up shot by shot
+func sequenceNumber(file string) (int64, bool) {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	numbers := sequenceNumberRegexp.FindAllString(name, -1)
+	if len(numbers) == 0 {
+		return 0, false
+	}
+	number, err := strconv.ParseInt(numbers[len(numbers)-1], 10, 64)
+	return number, err == nil
+}
+
+// collisionGroups groups media files which are going to be renamed to the same name, such as a burst shot within one second.  Each group is sorted by the sequence number in the original names so collision suffixes follow capture order, files without a number go last
+func collisionGroups(mediaFiles []*mediaFile) (groups [][]*mediaFile) {
+	index := make(map[string]int)
+	for _, mf := range mediaFiles {
+		key := mf.Path
+		if needsRename(mf) {
+			potentialName, ext := targetName(mf)
+			key = strings.ToLower(filepath.Join(targetDir(mf), potentialName+ext))
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], mf)
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool {
+			a, aOk := sequenceNumber(group[i].Path)
+			b, bOk := sequenceNumber(group[j].Path)
+			if aOk != bOk {
+				return aOk
+			}
+			if a != b {
+				return a < b
+			}
+			return filepath.Base(group[i].Path) < filepath.Base(group[j].Path)
+		})
+	}
+	return
+}
+
+// Set by -skip-if-exists and -skip-if-target-larger for incremental imports into a library
+var (
+	skipIfExists       bool
+	skipIfTargetLarger bool
+)
+
+// existingTargetSkip returns the reason file is skipped instead of numbered because target, the name it would get and which is not a file of this run, already exists.  "" means it is renamed with a collision suffix as usual
+func existingTargetSkip(file string, target string) string {
+	if !skipIfExists && !skipIfTargetLarger {
+		return ""
+	}
+	targetInfo, err := os.Stat(target)
+	if err != nil {
+		return ""
+	}
+	if skipIfExists {
+		return reasonTargetExists
+	}
+	info, err := os.Stat(file)
+	if err == nil && targetInfo.Size() >= info.Size() {
+		return reasonTargetLarger
+	}
+	return ""
+}
+
+// dateOnlyCollision is set by -date-only-collision, "spread" moves date only files bound for the same name to the following free seconds instead of numbering them
+var dateOnlyCollision string
+
+// lastSecondOfDay is how far spreading may move a date only time without leaving its day
+const lastSecondOfDay = 24*60*60 - 1
+
+// spreadDateOnly gives the date only files of every collision group consecutive seconds, 00.00.00, 00.00.01... in the group's order.  Seconds whose name is the target of another file or already exists are passed over, so files keep their capture order among names nobody else takes
+func spreadDateOnly(mediaFiles []*mediaFile) {
+	taken := make(map[string]bool)
+	groups := collisionGroups(mediaFiles)
+	for _, group := range groups {
+		for _, mf := range group {
+			if needsRename(mf) && !mf.DateOnly {
+				potentialName, ext := targetName(mf)
+				taken[strings.ToLower(filepath.Join(targetDir(mf), potentialName+ext))] = true
+			}
+		}
+	}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		second := 0
+		for _, mf := range group {
+			if !mf.DateOnly || !needsRename(mf) {
+				continue
+			}
+			day := mf.Time
+			if !namesSeconds(mf) {
+				// the format has no seconds, spreading cannot tell the files apart
+				break
+			}
+			for ; second <= lastSecondOfDay; second++ {
+				mf.Time = day.Add(time.Duration(second) * time.Second)
+				potentialName, ext := targetName(mf)
+				target := filepath.Join(targetDir(mf), potentialName+ext)
+				if !taken[strings.ToLower(target)] && (target == mf.Path || !extensions.DoesFileExist(target)) {
+					taken[strings.ToLower(target)] = true
+					break
+				}
+			}
+			if second > lastSecondOfDay {
+				// the day is full, the remaining files are numbered as usual
+				mf.Time = day
+			}
+			second++
+		}
+	}
+}
+
+// namesSeconds reports whether the name mf would get changes with the second of its time
+func namesSeconds(mf *mediaFile) bool {
+	name, _ := targetName(mf)
+	next := *mf
+	next.Time = mf.Time.Add(time.Second)
+	nextName, _ := targetName(&next)
+	return name != nextName
+}
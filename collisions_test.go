@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSequenceNumber(t *testing.T) {
+	tests := []struct {
+		file string
+		want int64
+		ok   bool
+	}{
+		{"IMG_0042.JPG", 42, true},
+		{"DSC00007.ARW", 7, true},
+		{"2021_burst_0003.jpg", 3, true},
+		{"photo.jpg", 0, false},
+		{"dir/IMG_12.jpg", 12, true},
+	}
+	for _, test := range tests {
+		got, ok := sequenceNumber(filepath.FromSlash(test.file))
+		if got != test.want || ok != test.ok {
+			t.Errorf("sequenceNumber(%q) = %v, %v, want %v, %v", test.file, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestBurstCollisionsFollowCaptureOrder(t *testing.T) {
+	dir := t.TempDir()
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	// the original name is kept after the picture so each file can be told apart once renamed
+	originals := []string{"IMG_0100.jpg", "burst.jpg", "IMG_0010.jpg", "IMG_0009.jpg"}
+	for _, name := range originals {
+		writeTestFile(t, dir, name, append(append([]byte{}, photo...), name...))
+	}
+	mustRunMain(t, dir)
+	want := map[string]string{
+		"2021-05-01 12.30.00.jpg":   "IMG_0009.jpg",
+		"2021-05-01 12.30.00-1.jpg": "IMG_0010.jpg",
+		"2021-05-01 12.30.00-2.jpg": "IMG_0100.jpg",
+		"2021-05-01 12.30.00-3.jpg": "burst.jpg",
+	}
+	for renamed, original := range want {
+		data, err := os.ReadFile(filepath.Join(dir, renamed))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := string(data[len(photo):]); got != original {
+			t.Errorf("%s was %s, want %s", renamed, got, original)
+		}
+	}
+}
+
+func TestExistingTargetSkip(t *testing.T) {
+	restoreAfterTest(t, &skipIfExists, &skipIfTargetLarger)
+	dir := t.TempDir()
+	small := writeTestFile(t, dir, "small.jpg", []byte("small"))
+	large := writeTestFile(t, dir, "large.jpg", []byte("larger file"))
+	free := filepath.Join(dir, "free.jpg")
+	tests := []struct {
+		exists, larger bool
+		file, target   string
+		want           string
+	}{
+		{false, false, small, large, ""},
+		{true, false, large, small, reasonTargetExists},
+		{true, false, small, free, ""},
+		{false, true, small, large, reasonTargetLarger},
+		{false, true, large, small, ""},
+		{false, true, small, small, reasonTargetLarger},
+		{false, true, small, free, ""},
+	}
+	for _, test := range tests {
+		skipIfExists, skipIfTargetLarger = test.exists, test.larger
+		if got := existingTargetSkip(test.file, test.target); got != test.want {
+			t.Errorf("existingTargetSkip(%s, %s) with exists %v, larger %v = %q, want %q", filepath.Base(test.file), filepath.Base(test.target), test.exists, test.larger, got, test.want)
+		}
+	}
+}
+
+func TestSkipIfExistsImports(t *testing.T) {
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	tests := []struct {
+		flag string
+		// existing is the size of the file already in the library
+		existing int
+		want     []string
+	}{
+		{"-skip-if-exists", 1, []string{"import/IMG_0001.jpg", "library/2021/2021-05/2021-05-01 12.30.00.jpg"}},
+		{"-skip-if-target-larger", len(photo) + 10, []string{"import/IMG_0001.jpg", "library/2021/2021-05/2021-05-01 12.30.00.jpg"}},
+		// a smaller file in the library is numbered past instead
+		{"-skip-if-target-larger", 1, []string{"library/2021/2021-05/2021-05-01 12.30.00-1.jpg", "library/2021/2021-05/2021-05-01 12.30.00.jpg"}},
+	}
+	for _, test := range tests {
+		root := t.TempDir()
+		writeTestFile(t, root, "library/2021/2021-05/2021-05-01 12.30.00.jpg", make([]byte, test.existing))
+		writeTestFile(t, root, "import/IMG_0001.jpg", photo)
+		mustRunMain(t, test.flag, "-move-to", filepath.Join(root, "library"), filepath.Join(root, "import"))
+		assertFiles(t, root, test.want...)
+	}
+}
+
+func TestDateOnlyCollisionSpread(t *testing.T) {
+	gpsDateOnly := jpegWithExif(buildTiff(testIFD{gps: []tiffEntry{asciiEntry(0x001D, "2021:05:01")}}))
+	tests := []struct {
+		name   string
+		spread bool
+		want   map[string]string
+	}{
+		{"suffixes by default", false, map[string]string{
+			"2021-05-01 00.00.00.jpg":   "IMG_0001.jpg",
+			"2021-05-01 00.00.00-1.jpg": "IMG_0002.jpg",
+			"2021-05-01 00.00.00-2.jpg": "IMG_0003.jpg",
+			"2021-05-01 00.00.00-3.jpg": "IMG_0004.jpg",
+			"2021-05-01 00.00.01.jpg":   "timed.jpg",
+		}},
+		{"spread passes over the second another file takes", true, map[string]string{
+			"2021-05-01 00.00.00.jpg": "IMG_0001.jpg",
+			"2021-05-01 00.00.02.jpg": "IMG_0002.jpg",
+			"2021-05-01 00.00.03.jpg": "IMG_0003.jpg",
+			"2021-05-01 00.00.04.jpg": "IMG_0004.jpg",
+			"2021-05-01 00.00.01.jpg": "timed.jpg",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"IMG_0003.jpg", "IMG_0001.jpg", "IMG_0004.jpg", "IMG_0002.jpg"} {
+				writeTestFile(t, dir, name, append(append([]byte{}, gpsDateOnly...), name...))
+			}
+			writeTestFile(t, dir, "timed.jpg", append(jpegWithExif(exifTiff("", "2021:05:01 00:00:01")), "timed.jpg"...))
+			if test.spread {
+				mustRunMain(t, "-trust", "gps-time", "-date-only-collision", "spread", dir)
+			} else {
+				mustRunMain(t, "-trust", "gps-time", dir)
+			}
+			for renamed, original := range test.want {
+				data, err := os.ReadFile(filepath.Join(dir, renamed))
+				if err != nil {
+					t.Errorf("%s: %v", renamed, err)
+					continue
+				}
+				if !bytes.HasSuffix(data, []byte(original)) {
+					t.Errorf("%s does not hold %s", renamed, original)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// commentMaxLength is how many characters of UserComment {comment} inserts at most
+const commentMaxLength = 40
+
+// userComment returns the Exif UserComment of a picture without its 8 byte character code prefix, or "" when there is none
+func userComment(x *exif.Exif) string {
+	tag, err := x.Get(exif.UserComment)
+	if err != nil || len(tag.Val) < 8 {
+		return ""
+	}
+	code, text := tag.Val[:8], tag.Val[8:]
+	var comment string
+	switch {
+	case bytes.HasPrefix(code, []byte("ASCII")):
+		comment = string(text)
+	case bytes.HasPrefix(code, []byte("UNICODE")):
+		comment = decodeUCS2(text, x.Tiff.Order)
+	case bytes.Equal(code, make([]byte, 8)):
+		// undefined character code, in practice ASCII or UTF-8 from phones
+		comment = string(text)
+	default:
+		// JIS is not supported
+		return ""
+	}
+	return strings.ToValidUTF8(comment, "")
+}
+
+// decodeUCS2 decodes the UNICODE UserComment text, which follows the Tiff byte order unless it starts with a byte order mark
+func decodeUCS2(text []byte, order binary.ByteOrder) string {
+	switch {
+	case bytes.HasPrefix(text, []byte{0xFE, 0xFF}):
+		order, text = binary.BigEndian, text[2:]
+	case bytes.HasPrefix(text, []byte{0xFF, 0xFE}):
+		order, text = binary.LittleEndian, text[2:]
+	}
+	units := make([]uint16, 0, len(text)/2)
+	for i := 0; i+1 < len(text); i += 2 {
+		units = append(units, order.Uint16(text[i:]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// commentToken makes a UserComment fit in a file name: control characters and path separators are dropped, runs of space are collapsed and it is cut to commentMaxLength characters
+func commentToken(comment string) string {
+	comment = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, comment)
+	comment = sanitizeNameComponent(strings.Join(strings.Fields(asciiComponent(comment)), " "))
+	if runes := []rune(comment); len(runes) > commentMaxLength {
+		comment = strings.TrimSpace(string(runes[:commentMaxLength]))
+	}
+	return comment
+}
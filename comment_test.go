@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ucs2 encodes text as UTF-16 in the byte order given, with a byte order mark first when bom is set
+func ucs2(text string, bigEndian bool, bom bool) []byte {
+	var out []byte
+	units := utf16.Encode([]rune(text))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	for _, unit := range units {
+		if bigEndian {
+			out = append(out, byte(unit>>8), byte(unit))
+		} else {
+			out = append(out, byte(unit), byte(unit>>8))
+		}
+	}
+	return out
+}
+
+func TestUserComment(t *testing.T) {
+	tests := []struct {
+		name  string
+		value []byte
+		want  string
+	}{
+		{"ascii", []byte("ASCII\x00\x00\x00Beach day"), "Beach day"},
+		{"unicode in tiff order", append([]byte("UNICODE\x00"), ucs2("Café 🎉", false, false)...), "Café 🎉"},
+		{"unicode big endian mark", append([]byte("UNICODE\x00"), ucs2("Café", true, true)...), "Café"},
+		{"undefined code", append(make([]byte, 8), "Grüße"...), "Grüße"},
+		{"jis", []byte("JIS\x00\x00\x00\x00\x00\x1b$B"), ""},
+		{"too short", []byte("ASCII"), ""},
+	}
+	for _, test := range tests {
+		data := buildTiff(testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:30:00"), {0x9286, 7, uint32(len(test.value)), test.value}}})
+		x, err := exif.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := userComment(x); got != test.want {
+			t.Errorf("%s: userComment = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCommentToken(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    string
+	}{
+		{"Beach day", "Beach day"},
+		{"  Beach\t\nday\x00 ", "Beach day"},
+		{"Trip/Rome", "Trip_Rome"},
+		{strings.Repeat("a", commentMaxLength+10), strings.Repeat("a", commentMaxLength)},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := commentToken(test.comment); got != test.want {
+			t.Errorf("commentToken(%q) = %q, want %q", test.comment, got, test.want)
+		}
+	}
+}
+
+func TestCommentTokenRenames(t *testing.T) {
+	dir := t.TempDir()
+	comment := func(value []byte) []byte {
+		return jpegWithExif(buildTiff(testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:30:00"), {0x9286, 7, uint32(len(value)), value}}}))
+	}
+	writeTestFile(t, dir, "ascii/IMG_0001.jpg", comment([]byte("ASCII\x00\x00\x00Beach  day/2\x00")))
+	writeTestFile(t, dir, "unicode/IMG_0001.jpg", comment(append([]byte("UNICODE\x00"), ucs2("Party", false, false)...)))
+	writeTestFile(t, dir, "none/IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	// without a comment the token is left empty, the separator before it stays
+	want := []string{"ascii/2021-05-01 12.30.00 Beach day_2.jpg", "none/2021-05-01 12.30.00 .jpg", "unicode/2021-05-01 12.30.00 Party.jpg"}
+	mustRunMain(t, dir, "2006-01-02 15.04.05 {comment}")
+	assertFiles(t, dir, want...)
+	mustRunMain(t, dir, "2006-01-02 15.04.05 {comment}")
+	assertFiles(t, dir, want...)
+}
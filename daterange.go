@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// sinceTime and untilTime are set by -since and -until, files named after a time outside them are left alone.  Zero times do not limit the range
+var sinceTime, untilTime time.Time
+
+// parseRangeBound parses a -since or -until value: RFC 3339, the naming format or a day such as 2021-05-01.  A day given for -until reaches to its end
+func parseRangeBound(value string, until bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return wallClock(t), nil
+	}
+	if layout := rangeLayout(fmtDesired); layout != "" {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	if day, err := time.Parse("2006-01-02", value); err == nil {
+		if until {
+			return day.Add(24*time.Hour - time.Nanosecond), nil
+		}
+		return day, nil
+	}
+	return time.Time{}, errors.New("use RFC 3339 (2021-05-01T12:30:00+02:00), the naming format (" + time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC).Format(rangeLayout(fmtDesired)) + ") or a day (2021-05-01)")
+}
+
+// rangeLayout returns the time layout of the naming format without its tokens and the literal text around them, e.g. "2006-01-02 15.04.05" for the "2006-01-02 15.04.05 ({original})" of -keep-original-name, the layout pieces joined by a space
+func rangeLayout(format string) string {
+	var layouts []string
+	for _, segment := range splitNameFormat(format) {
+		start, end := -1, 0
+		for i := 0; i < len(segment.layout); {
+			size := layoutElementSize(segment.layout[i:])
+			if size == 0 {
+				i++
+				continue
+			}
+			if start < 0 {
+				start = i
+			}
+			i += size
+			end = i
+		}
+		if start >= 0 {
+			layouts = append(layouts, safeLayout(segment.layout[start:end]))
+		}
+	}
+	return strings.Join(layouts, " ")
+}
+
+// wallClock returns the clock reading of t as if it were taken in UTC, so times are compared as they appear in names
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// inDateRange reports whether the time a file is named after lies within -since and -until
+func inDateRange(mt mediaTime) bool {
+	t := wallClock(displayTime(mt))
+	if !sinceTime.IsZero() && t.Before(sinceTime) {
+		return false
+	}
+	return untilTime.IsZero() || !t.After(untilTime)
+}
+
+// filterDateRange drops the files whose capture time is outside -since and -until from mediaFiles and reports them skipped.  Files without a date are kept, they are skipped or failed as usual
+func filterDateRange(mediaFiles []*mediaFile) []*mediaFile {
+	if sinceTime.IsZero() && untilTime.IsZero() {
+		return mediaFiles
+	}
+	var inRange []*mediaFile
+	for _, mf := range mediaFiles {
+		if mf.Err == nil && !inDateRange(mf.mediaTime) {
+			fileLog.Println("Skipping " + mf.Path + ", its capture time " + displayTime(mf.mediaTime).Format("2006-01-02 15:04:05") + " is out of range")
+			results.add(fileResult{Path: mf.Path, Status: statusSkipped, Reason: reasonOutOfRange})
+			continue
+		}
+		inRange = append(inRange, mf)
+	}
+	return inRange
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRangeLayout(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"2006-01-02 15.04.05", "2006-01-02 15.04.05"},
+		{"2006-01-02 15.04.05" + originalNameSuffix, "2006-01-02 15.04.05"},
+		{"2006-01-02 {original} 15.04.05", "2006-01-02 15.04.05"},
+		{"2006-01-02 {make} 15.04.05", "2006-01-02 15.04.05"},
+		{"{date}_{model}", "2006-01-02"},
+		{"IMG {original}", ""},
+		{"IMG {make}", ""},
+	}
+	for _, test := range tests {
+		if got := rangeLayout(test.format); got != test.want {
+			t.Errorf("rangeLayout(%q) = %q, want %q", test.format, got, test.want)
+		}
+	}
+}
+
+func TestParseRangeBound(t *testing.T) {
+	restoreAfterTest(t, &fmtDesired)
+	tests := []struct {
+		name   string
+		format string
+		value  string
+		until  bool
+		want   time.Time
+		fail   bool
+	}{
+		{"RFC 3339 keeps the wall clock", "2006-01-02 15.04.05", "2021-05-01T12:30:00+02:00", false, time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC), false},
+		{"naming format", "2006-01-02 15.04.05", "2021-05-01 12.30.00", false, time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC), false},
+		{"naming format with a token", "2006-01-02 {make} 15.04.05", "2021-05-01 12.30.00", false, time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC), false},
+		{"naming format with the original name", "2006-01-02 15.04.05" + originalNameSuffix, "2021-05-01 12.30.00", false, time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC), false},
+		{"day since", "2006-01-02 15.04.05", "2021-05-01", false, time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC), false},
+		{"day until reaches its end", "2006-01-02 15.04.05", "2021-05-01", true, time.Date(2021, 5, 1, 23, 59, 59, 999999999, time.UTC), false},
+		{"only tokens", "IMG {make}", "2021-05-01 12.30.00", false, time.Time{}, true},
+		{"not a date", "2006-01-02 15.04.05", "yesterday", false, time.Time{}, true},
+	}
+	for _, test := range tests {
+		fmtDesired = test.format
+		got, err := parseRangeBound(test.value, test.until)
+		if (err != nil) != test.fail {
+			t.Errorf("%s: parseRangeBound error %v, want failure %v", test.name, err, test.fail)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("%s: parseRangeBound = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSinceWithTokenFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("", "2021:05:01 08:00:00")))
+	mustRunMain(t, "-since", "2021-05-01 12.00.00", dir, "2006-01-02 {make} 15.04.05")
+	assertFiles(t, dir, "2021-05-01 Unknown 12.30.00.jpg", "IMG_0002.jpg")
+}
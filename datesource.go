@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// Date sources other than the Exif field names exifTime reports
+const (
+	sourceGPS             = "GPS"
+	sourceGPSDate         = "GPSDateStamp"
+	sourceMvhd            = "mvhd"
+	sourceMdhd            = "mdhd"
+	sourceTkhd            = "tkhd"
+	sourceUdtaDay         = "©day"
+	sourceQuickTimeKeys   = quickTimeCreationDateKey
+	sourceMatroska        = "DateUTC"
+	sourceGoPro           = "GoPro GPSU"
+	sourceDJISRT          = "DJI SRT"
+	sourceGIFComment      = "GIF comment"
+	sourcePNGCreationTime = "PNG Creation Time"
+	sourceRawPreview      = "RAW preview "
+	sourceModTime         = "file modification time"
+	sourceFileName        = "file name"
+	sourceNone            = "none"
+	sourceError           = "unreadable"
+)
+
+// dateSourceBreakdown counts media files by the source of their date, most common first
+func dateSourceBreakdown(mediaFiles []*mediaFile) string {
+	counts := make(map[string]int)
+	for _, mf := range mediaFiles {
+		switch {
+		case mf.Err == errNoDate:
+			counts[sourceNone]++
+		case mf.Err != nil:
+			counts[sourceError]++
+		default:
+			counts[mf.Source]++
+		}
+	}
+	sources := make([]string, 0, len(counts))
+	for source := range counts {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if counts[sources[i]] != counts[sources[j]] {
+			return counts[sources[i]] > counts[sources[j]]
+		}
+		return sources[i] < sources[j]
+	})
+	lines := []string{"Dates by source:"}
+	if len(sources) == 0 {
+		lines = append(lines, "  none read")
+	}
+	for _, source := range sources {
+		lines = append(lines, "  "+source+": "+extensions.IntToString(counts[source]))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDateSourceBreakdown(t *testing.T) {
+	withSource := func(source string) *mediaFile {
+		return &mediaFile{mediaTime: mediaTime{Source: source}}
+	}
+	tests := []struct {
+		name  string
+		files []*mediaFile
+		want  string
+	}{
+		{"empty", nil, "Dates by source:\n  none read"},
+		{
+			"most common first, ties by name",
+			[]*mediaFile{
+				withSource("DateTimeOriginal"), withSource(sourceMvhd), withSource("DateTimeOriginal"),
+				withSource(sourceGPS), {Err: errNoDate}, {Err: errors.New("Could not Open a.jpg")},
+			},
+			"Dates by source:\n  DateTimeOriginal: 2\n  GPS: 1\n  mvhd: 1\n  none: 1\n  unreadable: 1",
+		},
+	}
+	for _, test := range tests {
+		if got := dateSourceBreakdown(test.files); got != test.want {
+			t.Errorf("%s: dateSourceBreakdown =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDateSourceReport(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "b.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:01")))
+	writeTestFile(t, dir, "c.jpg", jpegWithExif(exifTiff("2021:05:01 12:30:02", "")))
+	writeTestFile(t, dir, "d.jpg", jpegWithExif(buildTiff(testIFD{exif: []tiffEntry{asciiEntry(0x9004, "2021:05:01 12:30:03")}})))
+	writeTestFile(t, dir, "clip.mp4", mp4WithTime(time.Date(2021, 5, 1, 12, 30, 4, 0, time.UTC)))
+	writeTestFile(t, dir, "none.jpg", jpegWithExif(exifTiff("", "")))
+	output := mustRunMain(t, "-date-source-report", dir)
+	want := "Dates by source:\n  DateTimeOriginal: 2\n  DateTime: 1\n  DateTimeDigitized: 1\n  mvhd: 1\n  none: 1"
+	if !strings.Contains(output, want) {
+		t.Errorf("output lacks\n%s\n%s", want, output)
+	}
+}
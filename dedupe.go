@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+	"github.com/DanielRenne/GoCore/core/utils"
+)
+
+// duplicatesDirName is the folder created under the processed directory to hold files removed by deduping
+const duplicatesDirName = "duplicates"
+
+var preferredFormats []string
+
+// parseExtensionList upper cases a comma separated list of extensions, accepting entries with or without a leading dot
+func parseExtensionList(value string) (list []string) {
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(entry), "."))
+		if entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return
+}
+
+// sameFormat reports whether two upper case extensions name the same format, e.g. JPG and JPEG
+func sameFormat(a string, b string) bool {
+	if a == b {
+		return true
+	}
+	for _, group := range equivalentExtensions {
+		if utils.InArray(a, group) && utils.InArray(b, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatRank returns the position of a file's format in preferredFormats or -1 when it is not listed
+func formatRank(file string) int {
+	ext := strings.ToUpper(strings.TrimPrefix(filepath.Ext(file), "."))
+	for i, preferred := range preferredFormats {
+		if sameFormat(ext, preferred) {
+			return i
+		}
+	}
+	return -1
+}
+
+// dedupeAction keeps one file of a duplicate group and removes the rest
+type dedupeAction struct {
+	Keep   *mediaFile
+	Remove []*mediaFile
+	Reason string
+	// SHA256 is the content hash shared by the group when it was deduped by identical content
+	SHA256 string
+}
+
+// planDedupeAcrossExtensions groups files in the same directory sharing a name without its extension and a capture time, such as IMG_0001.HEIC and its IMG_0001.jpg export, and, where the group holds more than one listed format, plans removing every file not in the most preferred format
+func planDedupeAcrossExtensions(mediaFiles []*mediaFile) (plan []dedupeAction) {
+	groups := make(map[string][]*mediaFile)
+	var keys []string
+	for _, mf := range mediaFiles {
+		if mf.Err != nil || formatRank(mf.Path) == -1 {
+			continue
+		}
+		// other photos taken in the same second are not the same photo, only the extension may differ
+		key := strings.TrimSuffix(mf.Path, filepath.Ext(mf.Path)) + "|" + mf.Time.String()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], mf)
+	}
+
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			return formatRank(group[i].Path) < formatRank(group[j].Path)
+		})
+		action := dedupeAction{Keep: group[0]}
+		keeperRank := formatRank(action.Keep.Path)
+		for _, mf := range group[1:] {
+			if formatRank(mf.Path) != keeperRank {
+				action.Remove = append(action.Remove, mf)
+			}
+		}
+		if len(action.Remove) > 0 {
+			action.Reason = "same capture time " + action.Keep.Time.Format(exifDateLayout) + ", " + preferredFormats[keeperRank] + " is the preferred format"
+			plan = append(plan, action)
+		}
+	}
+	return
+}
+
+// applyDedupe moves every file a plan removes into the duplicates folder and returns the media files left to rename
+func applyDedupe(root string, plan []dedupeAction, mediaFiles []*mediaFile) []*mediaFile {
+	var moved []dedupeAction
+	for _, action := range plan {
+		done := dedupeAction{Keep: action.Keep, Reason: action.Reason}
+		for _, mf := range action.Remove {
+			start := time.Now()
+			newName, err := moveAside(root, duplicatesDirName, mf.Path)
+			traceStage(mf.Path, stageRename, start)
+			if err != nil {
+				stdErr.Println("Could not move duplicate: " + mf.Path + ": " + err.Error())
+				continue
+			}
+			done.Remove = append(done.Remove, mf)
+			results.add(fileResult{Path: mf.Path, NewPath: newName, Status: statusMoved, Reason: reasonDuplicate})
+			logFileLine("Moved duplicate "+filepath.Base(mf.Path)+" to "+newName+" keeping "+filepath.Base(action.Keep.Path), statusMoved, mf.Path, newName, mf.Source)
+		}
+		moved = append(moved, done)
+	}
+	return dedupeRemaining(moved, mediaFiles)
+}
+
+// dedupeRemaining returns the media files a plan does not remove
+func dedupeRemaining(plan []dedupeAction, mediaFiles []*mediaFile) []*mediaFile {
+	removed := make(map[*mediaFile]bool)
+	for _, action := range plan {
+		for _, mf := range action.Remove {
+			removed[mf] = true
+		}
+	}
+	var remaining []*mediaFile
+	for _, mf := range mediaFiles {
+		if !removed[mf] {
+			remaining = append(remaining, mf)
+		}
+	}
+	return remaining
+}
+
+// describeDedupePlan lists what a plan would keep and move without touching any file
+func describeDedupePlan(root string, plan []dedupeAction) string {
+	lines := []string{"Dedupe plan, nothing has been moved:"}
+	if len(plan) == 0 {
+		lines = append(lines, "  no duplicates found")
+	}
+	for _, action := range plan {
+		lines = append(lines, "  keep "+action.Keep.Path+" ("+action.Reason+")")
+		for _, mf := range action.Remove {
+			target := mf.Path
+			if rel, err := filepath.Rel(root, mf.Path); err == nil {
+				target = filepath.Join(root, duplicatesDirName, rel)
+			}
+			lines = append(lines, "    move "+mf.Path+" to "+target)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// moveAside moves file into the dirName folder under root, keeping its path relative to root and numbering the name when it is taken
+func moveAside(root string, dirName string, file string) (string, error) {
+	return moveInto(root, filepath.Join(root, dirName), file)
+}
+
+// moveInto moves file, which is under root, into targetRoot keeping its path relative to root and numbering the name when it is taken
+func moveInto(root string, targetRoot string, file string) (string, error) {
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(rel, "..") {
+		return "", errors.New(file + " is not inside " + root)
+	}
+	target := filepath.Join(targetRoot, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(target)
+	return renameWithCollision(file, filepath.Dir(target), strings.TrimSuffix(filepath.Base(target), ext), ext)
+}
+
+// writeDedupeReport saves the groups of a plan of identical files as CSV, one row per file with the group's hash, whether it is kept or a duplicate, its size and path
+func writeDedupeReport(file string, plan []dedupeAction) error {
+	fd, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	w := csv.NewWriter(fd)
+	w.Write([]string{"group", "sha256", "role", "size", "path"})
+	for i, action := range plan {
+		for j, mf := range append([]*mediaFile{action.Keep}, action.Remove...) {
+			role := "duplicate"
+			if j == 0 {
+				role = "keep"
+			}
+			size := ""
+			if info, err := os.Stat(mf.Path); err == nil {
+				size = strconv.FormatInt(info.Size(), 10)
+			}
+			w.Write([]string{extensions.IntToString(i + 1), action.SHA256, role, size, mf.Path})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return fd.Close()
+}
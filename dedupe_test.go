@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlanDedupeAcrossExtensions(t *testing.T) {
+	restoreAfterTest(t, &preferredFormats)
+	morning := time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)
+	evening := time.Date(2021, 5, 1, 19, 0, 0, 0, time.UTC)
+	file := func(path string, taken time.Time) *mediaFile {
+		return &mediaFile{Path: filepath.FromSlash(path), mediaTime: mediaTime{Time: taken}}
+	}
+	tests := []struct {
+		name     string
+		priority string
+		files    []*mediaFile
+		// want maps each kept file to the files removed for it
+		want map[string][]string
+	}{
+		{
+			name:     "heic preferred",
+			priority: "heic,jpg",
+			files:    []*mediaFile{file("a/IMG_1.JPG", morning), file("a/IMG_1.HEIC", morning)},
+			want:     map[string][]string{"a/IMG_1.HEIC": {"a/IMG_1.JPG"}},
+		},
+		{
+			name:     "jpg preferred",
+			priority: "jpg,heic",
+			files:    []*mediaFile{file("a/IMG_1.JPG", morning), file("a/IMG_1.HEIC", morning)},
+			want:     map[string][]string{"a/IMG_1.JPG": {"a/IMG_1.HEIC"}},
+		},
+		{
+			name:     "equivalent extensions are one format",
+			priority: ".HEIC,.jpg",
+			files:    []*mediaFile{file("a/IMG_1.jpeg", morning), file("a/IMG_1.heif", morning)},
+			want:     map[string][]string{"a/IMG_1.heif": {"a/IMG_1.jpeg"}},
+		},
+		{
+			name:     "different capture times",
+			priority: "heic,jpg",
+			files:    []*mediaFile{file("a/IMG_1.JPG", morning), file("a/IMG_1.HEIC", evening)},
+			want:     map[string][]string{},
+		},
+		{
+			name:     "different folders",
+			priority: "heic,jpg",
+			files:    []*mediaFile{file("a/IMG_1.JPG", morning), file("b/IMG_1.HEIC", morning)},
+			want:     map[string][]string{},
+		},
+		{
+			name:     "unlisted formats are kept",
+			priority: "heic,jpg",
+			files:    []*mediaFile{file("a/IMG_1.PNG", morning), file("a/IMG_1.JPG", morning)},
+			want:     map[string][]string{},
+		},
+		{
+			name:     "different names in the same second",
+			priority: "heic,jpg",
+			files:    []*mediaFile{file("a/IMG_1.JPG", morning), file("a/IMG_2.HEIC", morning)},
+			want:     map[string][]string{},
+		},
+		{
+			name:     "only the pair sharing a name",
+			priority: "heic,jpg",
+			files:    []*mediaFile{file("a/IMG_1.JPG", morning), file("a/IMG_2.JPG", morning), file("a/IMG_1.HEIC", morning)},
+			want:     map[string][]string{"a/IMG_1.HEIC": {"a/IMG_1.JPG"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			preferredFormats = parseExtensionList(test.priority)
+			plan := planDedupeAcrossExtensions(test.files)
+			if len(plan) != len(test.want) {
+				t.Fatalf("planned %d actions, want %d", len(plan), len(test.want))
+			}
+			for _, action := range plan {
+				removed, ok := test.want[filepath.ToSlash(action.Keep.Path)]
+				if !ok {
+					t.Fatalf("kept %s, want one of %v", action.Keep.Path, test.want)
+				}
+				if len(action.Remove) != len(removed) {
+					t.Fatalf("removed %d files for %s, want %v", len(action.Remove), action.Keep.Path, removed)
+				}
+				for i, mf := range action.Remove {
+					if filepath.ToSlash(mf.Path) != removed[i] {
+						t.Errorf("removed %s, want %s", mf.Path, removed[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPreferFormatMovesDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	// a HEIC export which is a JPEG under the hood reads the same as the JPEG
+	writeTestFile(t, dir, "IMG_0001.HEIC", photo)
+	writeTestFile(t, dir, "IMG_0001.JPG", photo)
+	mustRunMain(t, "-prefer-format", "heic,jpg", dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00.HEIC", duplicatesDirName+"/IMG_0001.JPG")
+}
+
+func TestPreferFormatKeepsOtherPhotosOfTheSameSecond(t *testing.T) {
+	dir := t.TempDir()
+	// a burst: two different photos taken in the same second
+	writeTestFile(t, dir, "IMG_0001.HEIC", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "IMG_0002.JPG", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	mustRunMain(t, "-prefer-format", "heic,jpg", dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00.HEIC", "2021-05-01 12.30.00.JPG")
+}
+
+func TestDedupeDryRunListsActions(t *testing.T) {
+	dir := t.TempDir()
+	copied := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	writeTestFile(t, dir, "a.jpg", copied)
+	writeTestFile(t, dir, "trip/copy.jpg", copied)
+	writeTestFile(t, dir, "IMG_0002.HEIC", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	writeTestFile(t, dir, "IMG_0002.JPG", jpegWithExif(exifTiff("2021:05:02 08:00:01", "2021:05:02 08:00:00")))
+	output := mustRunMain(t, "-dedupe", "-prefer-format", "heic,jpg", "-dedupe-dry-run", dir)
+	for _, want := range []string{
+		"Dedupe plan, nothing has been moved:",
+		"  keep " + filepath.Join(dir, "a.jpg") + " (identical content, sha256 ",
+		"    move " + filepath.Join(dir, "trip/copy.jpg") + " to " + filepath.Join(dir, duplicatesDirName, "trip/copy.jpg"),
+		"  keep " + filepath.Join(dir, "IMG_0002.HEIC") + " (same capture time 2021:05:02 08:00:00, HEIC is the preferred format)",
+		"    move " + filepath.Join(dir, "IMG_0002.JPG") + " to " + filepath.Join(dir, duplicatesDirName, "IMG_0002.JPG"),
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+	assertFiles(t, dir, "IMG_0002.HEIC", "IMG_0002.JPG", "a.jpg", "trip/copy.jpg")
+}
+
+func TestDedupeReport(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	clip := mp4WithTime(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	writeTestFile(t, dir, "IMG_0001.jpg", photo)
+	writeTestFile(t, dir, "trip/IMG_0001.jpg", photo)
+	writeTestFile(t, dir, "IMG_0001 (1).jpg", photo)
+	writeTestFile(t, dir, "clip.mp4", clip)
+	writeTestFile(t, dir, "old/clip.mp4", clip)
+	// same capture time, other content
+	writeTestFile(t, dir, "IMG_0002.jpg", append(append([]byte{}, photo...), 0))
+	report := filepath.Join(root, "dupes.csv")
+	output := mustRunMain(t, "-dedupe-report", report, dir)
+	if !strings.Contains(output, "Wrote 2 groups of identical files to "+report+", nothing has been moved") {
+		t.Errorf("output lacks the group count:\n%s", output)
+	}
+	fd, err := os.Open(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	rows, err := csv.NewReader(fd).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	photoSum, clipSum := sha256.Sum256(photo), sha256.Sum256(clip)
+	photoHash, clipHash := hex.EncodeToString(photoSum[:]), hex.EncodeToString(clipSum[:])
+	photoSize, clipSize := strconv.Itoa(len(photo)), strconv.Itoa(len(clip))
+	want := [][]string{
+		{"group", "sha256", "role", "size", "path"},
+		// groups and their files are in path order, the first path of a group is kept
+		{"1", photoHash, "keep", photoSize, filepath.Join(dir, "IMG_0001 (1).jpg")},
+		{"1", photoHash, "duplicate", photoSize, filepath.Join(dir, "IMG_0001.jpg")},
+		{"1", photoHash, "duplicate", photoSize, filepath.Join(dir, "trip/IMG_0001.jpg")},
+		{"2", clipHash, "keep", clipSize, filepath.Join(dir, "clip.mp4")},
+		{"2", clipHash, "duplicate", clipSize, filepath.Join(dir, "old/clip.mp4")},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("report rows\n%q\nwant\n%q", rows, want)
+	}
+	assertFiles(t, dir, "IMG_0001 (1).jpg", "IMG_0001.jpg", "IMG_0002.jpg", "clip.mp4", "old/clip.mp4", "trip/IMG_0001.jpg")
+}
+
+func TestPlanDedupeIdentical(t *testing.T) {
+	dir := t.TempDir()
+	taken := mediaTime{Time: time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)}
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	file := func(name string, data []byte, mt mediaTime, err error) *mediaFile {
+		return &mediaFile{Path: writeTestFile(t, dir, name, data), mediaTime: mt, Err: err}
+	}
+	holiday := file("holiday.jpg", photo, taken, nil)
+	original := file("IMG_0001.jpg", photo, taken, nil)
+	// as large and taken at the same time, but another picture
+	other := file("IMG_0002.jpg", append(append([]byte{}, photo[:len(photo)-1]...), 0), taken, nil)
+	scan := file("scan.png", []byte("undated picture"), mediaTime{}, errNoDate)
+	scanCopy := file("scan (2).png", []byte("undated picture"), mediaTime{}, errNoDate)
+
+	plan := planDedupeIdentical([]*mediaFile{holiday, original, other, scan, scanCopy})
+	want := map[string][]string{
+		original.Path: {holiday.Path},
+		scanCopy.Path: {scan.Path},
+	}
+	if len(plan) != len(want) {
+		t.Fatalf("planDedupeIdentical found %d groups, want %d", len(plan), len(want))
+	}
+	for _, action := range plan {
+		var removed []string
+		for _, mf := range action.Remove {
+			removed = append(removed, mf.Path)
+		}
+		if !reflect.DeepEqual(removed, want[action.Keep.Path]) || action.SHA256 == "" {
+			t.Errorf("keeping %s moves %v (sha256 %q), want %v", action.Keep.Path, removed, action.SHA256, want[action.Keep.Path])
+		}
+	}
+}
+
+func TestDedupeIdenticalFilesWithDifferentNames(t *testing.T) {
+	dir := t.TempDir()
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	writeTestFile(t, dir, "IMG_0001.jpg", photo)
+	writeTestFile(t, dir, "holiday.jpg", photo)
+	output := mustRunMain(t, "-dedupe", dir)
+	// the first by path is kept and renamed, the copy is moved aside under its own name
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg", "duplicates/holiday.jpg")
+	if want := "Found 1 files with identical content elsewhere, taking " + formatByteSize(uint64(len(photo))); !strings.Contains(output, want) {
+		t.Errorf("output lacks %q:\n%s", want, output)
+	}
+}
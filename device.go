@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// deviceMaxLength is how many characters {make} and {model} insert at most
+const deviceMaxLength = 40
+
+// unknownDevice is what {make} and {model} insert for files whose metadata does not name the camera, such as most movies
+const unknownDevice = "Unknown"
+
+// exifText returns an ASCII Exif tag such as Make without its padding, or "" when it is missing
+func exifText(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+// deviceToken makes a camera make or model fit in a file name: spaces and path separators become dashes, e.g. Canon EOS R5 becomes Canon-EOS-R5, and it is cut to deviceMaxLength characters
+func deviceToken(value string) string {
+	value = strings.Join(strings.FieldsFunc(asciiComponent(value), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r) || r == '/' || r == '\\'
+	}), "-")
+	value = sanitizeNameComponent(value)
+	if runes := []rune(value); len(runes) > deviceMaxLength {
+		value = strings.Trim(string(runes[:deviceMaxLength]), "-")
+	}
+	if value == "" {
+		return unknownDevice
+	}
+	return value
+}
+
+func init() {
+	devicePattern := func(file string) string {
+		return `[^/\\]{1,` + extensions.IntToString(deviceMaxLength) + `}`
+	}
+	nameTokens["make"] = nameToken{
+		render: func(mf *mediaFile) string {
+			return deviceToken(mf.Make)
+		},
+		pattern: devicePattern,
+	}
+	nameTokens["model"] = nameToken{
+		render: func(mf *mediaFile) string {
+			return deviceToken(mf.Model)
+		},
+		pattern: devicePattern,
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func TestDeviceToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"spaces become dashes", "Canon EOS R5", "Canon-EOS-R5"},
+		{"path separators become dashes", "DJI/FC3170\\v2", "DJI-FC3170-v2"},
+		{"padding and runs of spaces", "  NIKON   D850 ", "NIKON-D850"},
+		{"cut to deviceMaxLength", strings.Repeat("A", 45), strings.Repeat("A", deviceMaxLength)},
+		{"empty", "", unknownDevice},
+		{"only spaces", "   ", unknownDevice},
+	}
+	for _, test := range tests {
+		if got := deviceToken(test.value); got != test.want {
+			t.Errorf("%s: deviceToken(%q) = %q, want %q", test.name, test.value, got, test.want)
+		}
+	}
+}
+
+func TestDeviceTokenMissingField(t *testing.T) {
+	tests := []struct {
+		name  string
+		ifd   testIFD
+		field exif.FieldName
+		want  string
+	}{
+		{"Make present", testIFD{fields: []tiffEntry{asciiEntry(0x010F, "Apple"), asciiEntry(tagDateTime, "2021:05:01 12:30:00")}}, exif.Make, "Apple"},
+		{"Make missing", testIFD{fields: []tiffEntry{asciiEntry(tagDateTime, "2021:05:01 12:30:00")}}, exif.Make, unknownDevice},
+		{"Model missing", testIFD{fields: []tiffEntry{asciiEntry(0x010F, "Apple")}}, exif.Model, unknownDevice},
+		{"Model only padding", testIFD{fields: []tiffEntry{asciiEntry(0x010F, "Apple"), asciiEntry(0x0110, "    ")}}, exif.Model, unknownDevice},
+	}
+	for _, test := range tests {
+		x, err := exif.Decode(bytes.NewReader(buildTiff(test.ifd)))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := deviceToken(exifText(x, test.field)); got != test.want {
+			t.Errorf("%s: deviceToken = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDeviceTokenRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(buildTiff(testIFD{fields: []tiffEntry{asciiEntry(0x010F, "Canon"), asciiEntry(0x0110, "Canon EOS R5")}, exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:30:00")}})))
+	writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	mustRunMain(t, dir, "2006-01-02 15.04.05 {model}")
+	assertFiles(t, dir, "2021-05-01 12.30.00 Canon-EOS-R5.jpg", "2021-05-02 08.00.00 Unknown.jpg")
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+
+package main
+
+import "errors"
+
+// freeSpace is not supported on this platform, the free space check before backing up is skipped
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("Checking free space is not supported on this platform")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// djiSRT is set by -dji-srt, videos with a .SRT next to them are named after its first timestamp
+var djiSRT bool
+
+// maxDJISRTHead bounds how much of an SRT is searched for its first timestamp, the first subtitle holds it
+const maxDJISRTHead = 4096
+
+// djiTimeRegexp matches the timestamps DJI drones write in their subtitles, e.g. 2023-04-15 12:34:56.789 or 2018.07.14 15:34:21
+var djiTimeRegexp = regexp.MustCompile(`(\d{4})[-.](\d{2})[-.](\d{2})[ T](\d{2}:\d{2}:\d{2})`)
+
+// djiSRTFile returns the .SRT sharing the base name of video, if there is one
+func djiSRTFile(video string) (string, bool) {
+	base := strings.TrimSuffix(video, filepath.Ext(video))
+	for _, ext := range []string{".SRT", ".srt"} {
+		if info, err := os.Stat(base + ext); err == nil && !info.IsDir() {
+			return base + ext, true
+		}
+	}
+	return "", false
+}
+
+// getDJISRTTime reads the first timestamp of a DJI subtitle file.  DJI writes the local time of the remote controller without a zone, unlike the often UTC mvhd of the clip
+func getDJISRTTime(file string) (mediaTime, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return mediaTime{}, err
+	}
+	defer fd.Close()
+	head := make([]byte, maxDJISRTHead)
+	n, err := io.ReadFull(fd, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return mediaTime{}, err
+	}
+	match := djiTimeRegexp.FindSubmatch(head[:n])
+	if match == nil {
+		return mediaTime{}, errors.New("No timestamp in " + file)
+	}
+	timeInfo, err := time.Parse("2006-01-02 15:04:05", string(match[1])+"-"+string(match[2])+"-"+string(match[3])+" "+string(match[4]))
+	if err != nil {
+		return mediaTime{}, errors.New("Could not parse the timestamp in " + file + ": " + err.Error())
+	}
+	return mediaTime{Time: timeInfo, Source: sourceDJISRT, Value: string(match[0])}, nil
+}
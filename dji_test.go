@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// djiSubtitle is the start of an SRT a DJI Mini writes next to its clips
+const djiSubtitle = `1
+00:00:00,000 --> 00:00:00,033
+<font size="28">FrameCnt: 1, DiffTime: 33ms
+2023-04-15 12:34:56.789
+[iso: 100] [shutter: 1/640.0] [fnum: 1.7] [ev: 0] [latitude: 46.5197] [longitude: 6.6323] [rel_alt: 1.200 abs_alt: 400.5] </font>
+
+2
+00:00:00,033 --> 00:00:00,066
+<font size="28">FrameCnt: 2, DiffTime: 33ms
+2023-04-15 12:34:56.822
+`
+
+func TestGetDJISRTTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		subtitle string
+		want     time.Time
+		fail     bool
+	}{
+		{"dashes and milliseconds", djiSubtitle, time.Date(2023, 4, 15, 12, 34, 56, 0, time.UTC), false},
+		{"older dotted date", "1\n00:00:01,000 --> 00:00:02,000\nHOME(6.6323,46.5197) 2018.07.14 15:34:21\n", time.Date(2018, 7, 14, 15, 34, 21, 0, time.UTC), false},
+		{"invalid date", "1\n2023-13-45 12:34:56\n", time.Time{}, true},
+		{"no timestamp", "1\n00:00:00,000 --> 00:00:01,000\nHello\n", time.Time{}, true},
+	}
+	for _, test := range tests {
+		file := writeTestFile(t, t.TempDir(), "DJI_0001.SRT", []byte(test.subtitle))
+		got, err := getDJISRTTime(file)
+		if (err != nil) != test.fail {
+			t.Errorf("%s: getDJISRTTime error %v, want failure %v", test.name, err, test.fail)
+			continue
+		}
+		if !got.Time.Equal(test.want) || !test.fail && (got.Zoned || got.Source != sourceDJISRT) {
+			t.Errorf("%s: getDJISRTTime = %+v, want %v unzoned from %s", test.name, got, test.want, sourceDJISRT)
+		}
+	}
+}
+
+func TestDJISRT(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		// the drone writes mvhd in UTC, two hours behind the local time of the subtitles
+		{"mvhd", nil, []string{"2023-04-15 10.34.56.MP4", "2023-04-15 10.34.56.SRT"}},
+		{"subtitles", []string{"-dji-srt"}, []string{"2023-04-15 12.34.56.MP4", "2023-04-15 12.34.56.SRT"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, dir, "DJI_0001.MP4", mp4WithTime(time.Date(2023, 4, 15, 10, 34, 56, 0, time.UTC)))
+			writeTestFile(t, dir, "DJI_0001.SRT", []byte(djiSubtitle))
+			mustRunMain(t, append(test.args, dir)...)
+			assertFiles(t, dir, test.want...)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// patternList is a flag which may be given more than once, every value is kept
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ", ")
+}
+
+func (p *patternList) Set(value string) error {
+	if _, err := filepath.Match(value, ""); err != nil {
+		return errors.New("invalid glob " + value)
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// excludePatterns are the globs given with -exclude, matching files and folders are neither renamed nor backed up
+var excludePatterns patternList
+
+// excluded reports whether path, under root, matches a pattern of -exclude.  Patterns are matched against the path relative to root with forward slashes, patterns without a slash also against the name alone so .thumbnails excludes such folders at any depth
+func excluded(root string, path string) bool {
+	if len(excludePatterns) == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range excludePatterns {
+		if matched, _ := filepath.Match(pattern, rel); matched {
+			return true
+		}
+		if !strings.Contains(pattern, "/") {
+			if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// moveExcluded moves the excluded files and folders of from to the same place in to.  A restored backup holds none of them, they are taken from the directory the backup replaced
+func moveExcluded(from string, to string) error {
+	if len(excludePatterns) == 0 {
+		return nil
+	}
+	var paths []string
+	err := filepath.Walk(from, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if excluded(from, path) {
+			paths = append(paths, path)
+			if f.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		rel, _ := filepath.Rel(from, path)
+		target := filepath.Join(to, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(path, target); err != nil {
+			return errors.New("Could not move excluded " + path + " back: " + err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+const (
+	exifDateLayout = "2006:01:02 15:04:05"
+	exifDayLayout  = "2006:01:02"
+)
+
+// trustGPSTime makes the GPS fix time win over the camera clock, set by -trust gps-time
+var trustGPSTime bool
+
+// extraExifFields are Exif sub-IFD tags goexif does not load on its own
+var extraExifFields = map[uint16]exif.FieldName{
+	0x9010: "OffsetTime",
+	0x9011: "OffsetTimeOriginal",
+	0x9012: "OffsetTimeDigitized",
+	0x882a: "TimeZoneOffset",
+}
+
+// extraFieldsParser loads extraExifFields from the Exif sub-IFD so they show up in Get and MarshalJSON like any other field
+type extraFieldsParser struct{}
+
+func (extraFieldsParser) Parse(x *exif.Exif) error {
+	tag, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return nil
+	}
+	offset, err := tag.Int64(0)
+	if err != nil {
+		return nil
+	}
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, 0); err != nil {
+		return nil
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return nil
+	}
+	x.LoadTags(dir, extraExifFields, false)
+	return nil
+}
+
+func init() {
+	exif.RegisterParsers(extraFieldsParser{})
+}
+
+// parseExifDate parses an Exif date string.  When offset holds an OffsetTime* value such as "+09:00" the result is a zoned instant, otherwise it is a wall clock reading
+func parseExifDate(value string, offset string) (mediaTime, error) {
+	value = strings.TrimSpace(strings.TrimRight(value, "\x00"))
+	offset = strings.TrimSpace(strings.TrimRight(offset, "\x00"))
+	if offset != "" {
+		timeInfo, err := time.Parse(exifDateLayout+"Z07:00", value+offset)
+		if err != nil {
+			return mediaTime{}, errors.New("invalid offset " + offset + ": " + err.Error())
+		}
+		return mediaTime{Time: timeInfo, Zoned: true}, nil
+	}
+	timeInfo, err := time.Parse(exifDateLayout, value)
+	if err != nil {
+		// some scanning software writes the day alone
+		if day, errDay := time.Parse(exifDayLayout, value); errDay == nil {
+			return mediaTime{Time: day, DateOnly: true}, nil
+		}
+		return mediaTime{}, err
+	}
+	return mediaTime{Time: timeInfo}, nil
+}
+
+// exifDateField is an Exif date tag with the OffsetTime* tag holding its zone, the SubSecTime* tag holding its fraction of a second and which value of the older TimeZoneOffset tag holds its zone, -1 for none
+type exifDateField struct {
+	name      exif.FieldName
+	offset    exif.FieldName
+	subSec    exif.FieldName
+	zoneIndex int
+}
+
+// exifDateFields are the Exif date tags in order of preference
+var exifDateFields = []exifDateField{
+	{exif.DateTimeOriginal, "OffsetTimeOriginal", exif.SubSecTimeOriginal, 0},
+	// exiftool calls DateTimeDigitized CreateDate, tools built on it often write only this one
+	{exif.DateTimeDigitized, "OffsetTimeDigitized", exif.SubSecTimeDigitized, -1},
+	{exif.DateTime, "OffsetTime", exif.SubSecTime, 1},
+}
+
+// exifDateAliases are the exiftool names of the Exif date tags -date-priority accepts too
+var exifDateAliases = map[string]exif.FieldName{
+	"createdate": exif.DateTimeDigitized,
+	"modifydate": exif.DateTime,
+}
+
+// setDatePriority reorders exifDateFields after -date-priority, a comma separated list of date tag names.  Tags left out are not read at all
+func setDatePriority(list string) error {
+	var fields []exifDateField
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		fieldName, ok := exifDateAliases[strings.ToLower(name)]
+		if !ok {
+			fieldName = exif.FieldName(name)
+		}
+		found := false
+		for _, field := range exifDateFields {
+			if strings.EqualFold(string(field.name), string(fieldName)) {
+				for _, taken := range fields {
+					if taken.name == field.name {
+						return errors.New(name + " is listed twice")
+					}
+				}
+				fields = append(fields, field)
+				found = true
+			}
+		}
+		if !found {
+			return errors.New("unknown date tag " + name + ", use " + exifDateFieldNames())
+		}
+	}
+	if len(fields) == 0 {
+		return errors.New("no date tag given")
+	}
+	exifDateFields = fields
+	return nil
+}
+
+// exifDateFieldNames lists the names of exifDateFields
+func exifDateFieldNames() string {
+	var names []string
+	for _, field := range exifDateFields {
+		names = append(names, string(field.name))
+	}
+	return strings.Join(names, ", ")
+}
+
+// dateOffset returns the zone of a date tag, from its OffsetTime* tag or, for cameras older than those, from TimeZoneOffset
+func dateOffset(x *exif.Exif, field exifDateField) string {
+	offset, _, _ := exifString(x, field.offset)
+	if strings.TrimSpace(offset) != "" {
+		return offset
+	}
+	return timeZoneOffset(x, field.zoneIndex)
+}
+
+// timeZoneOffset reads value index of the TimeZoneOffset tag, whole hours from UTC for DateTimeOriginal and, when there is a second value, DateTime, as an offset such as "+09:00".  It is empty when the value is missing or out of range
+func timeZoneOffset(x *exif.Exif, index int) string {
+	tag, err := x.Get("TimeZoneOffset")
+	if err != nil || index < 0 || index >= int(tag.Count) || tag.Format() != tiff.IntVal {
+		return ""
+	}
+	hours, err := tag.Int64(index)
+	if err != nil || hours < -12 || hours > 14 {
+		return ""
+	}
+	return fmt.Sprintf("%+03d:00", hours)
+}
+
+// withSubSec adds a SubSecTime* value, the decimal digits of the fraction of a second (e.g. "042" for 42ms), to a parsed time.  Values holding anything but digits are ignored
+func withSubSec(mt mediaTime, subSec string) mediaTime {
+	subSec = strings.TrimSpace(strings.TrimRight(subSec, "\x00"))
+	if subSec == "" || mt.DateOnly || strings.Trim(subSec, "0123456789") != "" {
+		return mt
+	}
+	if len(subSec) > 9 {
+		subSec = subSec[:9]
+	}
+	nanoseconds, _ := strconv.Atoi(subSec + strings.Repeat("0", 9-len(subSec)))
+	mt.Time = mt.Time.Add(time.Duration(nanoseconds))
+	return mt
+}
+
+// exifString returns a date tag's value as a string, ok is false when the tag is missing or its value can not be read as one.  Tags some software writes with another type than ASCII are converted, see tagDateString
+func exifString(x *exif.Exif, name exif.FieldName) (value string, present bool, ok bool) {
+	tag, err := x.Get(name)
+	if err != nil {
+		return "", false, false
+	}
+	if tag.Format() != tiff.StringVal {
+		value, ok = tagDateString(tag)
+		return value, true, ok
+	}
+	value, err = tag.StringVal()
+	if err != nil {
+		return "", true, false
+	}
+	return strings.TrimRight(value, "\x00"), true, true
+}
+
+// tagDateString turns a date tag stored with another type than ASCII back into Exif date text: BYTE and UNDEFINED values hold the characters, numeric values the components year, month, day and optionally hour, minute, second
+func tagDateString(tag *tiff.Tag) (string, bool) {
+	if tag.Format() == tiff.UndefVal || tag.Type == tiff.DTByte && tag.Count > 6 {
+		return strings.TrimRight(string(tag.Val), "\x00"), true
+	}
+	if tag.Count != 3 && tag.Count < 6 {
+		return "", false
+	}
+	var components []int64
+	for i := 0; i < int(tag.Count) && i < 6; i++ {
+		var component int64
+		var err error
+		switch tag.Format() {
+		case tiff.IntVal:
+			component, err = tag.Int64(i)
+		case tiff.RatVal:
+			var denominator int64
+			component, denominator, err = tag.Rat2(i)
+			if err == nil && denominator == 0 {
+				return "", false
+			}
+			if err == nil {
+				component /= denominator
+			}
+		case tiff.FloatVal:
+			var f float64
+			f, err = tag.Float(i)
+			component = int64(f)
+		default:
+			return "", false
+		}
+		if err != nil {
+			return "", false
+		}
+		components = append(components, component)
+	}
+	return componentDateString(components)
+}
+
+// componentDateString formats year, month, day and optionally hour, minute, second as Exif date text
+func componentDateString(components []int64) (string, bool) {
+	if len(components) != 3 && len(components) != 6 {
+		return "", false
+	}
+	value := fmt.Sprintf("%04d:%02d:%02d", components[0], components[1], components[2])
+	if len(components) == 6 {
+		value += fmt.Sprintf(" %02d:%02d:%02d", components[3], components[4], components[5])
+	}
+	return value, true
+}
+
+// jsonDateString reads a date field of the JSON marshaled Exif, which holds a string or, for numeric tags, an array of components with rationals written as "n/d"
+func jsonDateString(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case []interface{}:
+		if len(value) > 6 {
+			value = value[:6]
+		}
+		var components []int64
+		for _, component := range value {
+			switch component := component.(type) {
+			case float64:
+				components = append(components, int64(component))
+			case string:
+				var numerator, denominator int64
+				if _, err := fmt.Sscanf(component, "%d/%d", &numerator, &denominator); err != nil || denominator == 0 {
+					return "", false
+				}
+				components = append(components, numerator/denominator)
+			default:
+				return "", false
+			}
+		}
+		return componentDateString(components)
+	}
+	return "", false
+}
+
+// exifTime returns the capture time held in a decoded Exif block
+func exifTime(x *exif.Exif, fileWork string) (mediaTime, error) {
+	if pickEarliest {
+		return earliestExifTime(x, fileWork)
+	}
+	return preferredExifTime(x, fileWork)
+}
+
+// preferredExifTime returns the first date in exifDateFields order, read through goexif's typed accessors
+func preferredExifTime(x *exif.Exif, fileWork string) (mediaTime, error) {
+	if trustGPSTime {
+		if timeInfo, ok := gpsTime(x); ok && !timeInfo.DateOnly {
+			return timeInfo, nil
+		}
+	}
+
+	for _, field := range exifDateFields {
+		value, present, ok := exifString(x, field.name)
+		if !present {
+			continue
+		}
+		if !ok {
+			// the JSON map is the last resort for tags read neither as text nor as components
+			return exifTimeFromJSON(x, fileWork)
+		}
+		offset := dateOffset(x, field)
+		timeInfo, err := parseExifDate(value, offset)
+		if err != nil {
+			return mediaTime{}, errors.New("Failed to parse " + string(field.name) + " Exif Data: " + fileWork + ": " + err.Error())
+		}
+		subSec, _, _ := exifString(x, field.subSec)
+		timeInfo = withSubSec(timeInfo, subSec)
+		timeInfo.Source, timeInfo.Value = string(field.name), strings.TrimSpace(value+" "+offset)
+		return timeInfo, nil
+	}
+	if trustGPSTime {
+		// a GPSDateStamp without GPSTimeStamp only beats having no date at all
+		if timeInfo, ok := gpsTime(x); ok {
+			return timeInfo, nil
+		}
+	}
+	return mediaTime{}, errNoDate
+}
+
+// exifTimeFromJSON reads the date tags from the JSON marshaled Exif fields, the fallback for tags the typed accessors cannot read as strings
+func exifTimeFromJSON(x *exif.Exif, fileWork string) (mediaTime, error) {
+	data, err := x.MarshalJSON()
+	if err != nil {
+		return mediaTime{}, errors.New("Could not MarshalJSON " + fileWork + ": " + err.Error())
+	}
+	exifFields := make(map[string]interface{})
+	json.Unmarshal(data, &exifFields)
+	for _, field := range exifDateFields {
+		value, ok := jsonDateString(exifFields[string(field.name)])
+		if !ok {
+			continue
+		}
+		offset, _ := exifFields[string(field.offset)].(string)
+		if strings.TrimSpace(offset) == "" {
+			offset = timeZoneOffset(x, field.zoneIndex)
+		}
+		timeInfo, err := parseExifDate(value, offset)
+		if err != nil {
+			return mediaTime{}, errors.New("Failed to parse " + string(field.name) + " Exif Data: " + fileWork + ": " + err.Error())
+		}
+		subSec, _ := exifFields[string(field.subSec)].(string)
+		timeInfo = withSubSec(timeInfo, subSec)
+		timeInfo.Source, timeInfo.Value = string(field.name), strings.TrimSpace(value+" "+offset)
+		return timeInfo, nil
+	}
+	return mediaTime{}, errNoDate
+}
+
+// gpsTime returns the time of the GPS fix recorded with a photo.  GPS time is UTC so it is converted to the local zone like video times are, a GPSDateStamp alone gives a date only time
+func gpsTime(x *exif.Exif) (mediaTime, bool) {
+	dateTag, err := x.Get(exif.GPSDateStamp)
+	if err != nil {
+		return mediaTime{}, false
+	}
+	date, err := dateTag.StringVal()
+	if err != nil {
+		return mediaTime{}, false
+	}
+	day, err := time.Parse(exifDayLayout, strings.TrimSpace(strings.TrimRight(date, "\x00")))
+	if err != nil {
+		return mediaTime{}, false
+	}
+	timeTag, err := x.Get(exif.GPSTimeStamp)
+	if err != nil {
+		// without the time of day the UTC date cannot be moved to the local zone, keep the day as it is
+		return mediaTime{Time: day, DateOnly: true, Source: sourceGPSDate, Value: date}, true
+	}
+	if timeTag.Count < 3 {
+		return mediaTime{}, false
+	}
+	var seconds float64
+	for i, unit := range []float64{3600, 60, 1} {
+		numerator, denominator, err := timeTag.Rat2(i)
+		if err != nil || denominator == 0 {
+			return mediaTime{}, false
+		}
+		seconds += float64(numerator) / float64(denominator) * unit
+	}
+	timeInfo := day.Add(time.Duration(seconds * float64(time.Second)))
+	return mediaTime{Time: timeInfo.Local(), Zoned: true, Source: sourceGPS}, true
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// gpsExifTiff is a Tiff whose camera clock says dateTimeOriginal and whose GPS fix was taken at the UTC day and hour, minute, second given
+func gpsExifTiff(dateTimeOriginal string, day string, hour, minute, second uint32) []byte {
+	return buildTiff(testIFD{
+		exif: []tiffEntry{asciiEntry(0x9003, dateTimeOriginal)},
+		gps:  []tiffEntry{rationalEntry(0x0007, hour, 1, minute, 1, second, 1), asciiEntry(0x001D, day)},
+	})
+}
+
+func TestTrustGPSTime(t *testing.T) {
+	restoreAfterTest(t, &trustGPSTime)
+	x, err := exif.Decode(bytes.NewReader(gpsExifTiff("2000:01:01 00:00:00", "2023:04:15", 12, 34, 56)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		trust  bool
+		want   time.Time
+		source string
+	}{
+		{false, time.Date(2000, 1, 1, 0, 0, 0, 0, time.Local), "DateTimeOriginal"},
+		{true, time.Date(2023, 4, 15, 12, 34, 56, 0, time.UTC), sourceGPS},
+	}
+	for _, test := range tests {
+		trustGPSTime = test.trust
+		got, err := preferredExifTime(x, "IMG_0001.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Time.Equal(test.want) || got.Source != test.source {
+			t.Errorf("trust gps-time %v gave %v from %s, want %v from %s", test.trust, got.Time, got.Source, test.want, test.source)
+		}
+	}
+}
+
+func TestTrustGPSTimeRenames(t *testing.T) {
+	t.Setenv("TZ", "America/New_York")
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(gpsExifTiff("2000:01:01 00:00:00", "2023:04:15", 12, 34, 56)))
+	mustRunMain(t, "-trust", "gps-time", dir)
+	assertFiles(t, dir, "2023-04-15 08.34.56.jpg")
+}
+
+func TestTypedAccessorsMatchJSON(t *testing.T) {
+	shorts := func(values ...uint16) []byte {
+		var data []byte
+		for _, value := range values {
+			data = append(data, byte(value), byte(value>>8))
+		}
+		return data
+	}
+	tests := []struct {
+		name string
+		ifd  testIFD
+		// jsonFails is set where only the typed accessors read the date
+		jsonFails bool
+	}{
+		{"ascii", testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:30:00")}}, false},
+		{"date time only", testIFD{fields: []tiffEntry{asciiEntry(tagDateTime, "2021:05:01 12:30:00")}}, false},
+		{"offset and sub seconds", testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:30:00"), asciiEntry(0x9011, "+02:00"), asciiEntry(0x9291, "25")}}, false},
+		{"undefined", testIFD{exif: []tiffEntry{{0x9003, 7, 20, []byte("2021:05:01 12:30:00\x00")}}}, false},
+		{"short components", testIFD{exif: []tiffEntry{{0x9003, 3, 6, shorts(2021, 5, 1, 12, 30, 0)}}}, false},
+		{"byte characters", testIFD{exif: []tiffEntry{{0x9003, 1, 20, []byte("2021:05:01 12:30:00\x00")}}}, true},
+	}
+	for _, test := range tests {
+		x, err := exif.Decode(bytes.NewReader(buildTiff(test.ifd)))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		typed, err := preferredExifTime(x, test.name)
+		if err != nil {
+			t.Errorf("%s: typed accessors failed: %v", test.name, err)
+			continue
+		}
+		fromJSON, err := exifTimeFromJSON(x, test.name)
+		if test.jsonFails {
+			if err == nil {
+				t.Errorf("%s: JSON map read %v, expected only the typed accessors to read it", test.name, fromJSON.Time)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: JSON map failed: %v", test.name, err)
+			continue
+		}
+		if !typed.Time.Equal(fromJSON.Time) || typed.Source != fromJSON.Source {
+			t.Errorf("%s: typed %v from %s, JSON %v from %s", test.name, typed.Time, typed.Source, fromJSON.Time, fromJSON.Source)
+		}
+	}
+}
+
+func TestCreateDateOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		exif []tiffEntry
+		want time.Time
+	}{
+		// exiftool's CreateDate is DateTimeDigitized
+		{"create date", []tiffEntry{asciiEntry(0x9004, "2016:06:07 08:09:10")}, time.Date(2016, 6, 7, 8, 9, 10, 0, time.Local)},
+		{"create date with its offset", []tiffEntry{asciiEntry(0x9004, "2016:06:07 08:09:10"), asciiEntry(0x9012, "-05:00")}, time.Date(2016, 6, 7, 13, 9, 10, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		x, err := exif.Decode(bytes.NewReader(buildTiff(testIFD{exif: test.exif})))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for reader, read := range map[string]func(*exif.Exif, string) (mediaTime, error){"typed": preferredExifTime, "JSON": exifTimeFromJSON} {
+			got, err := read(x, test.name)
+			if err != nil {
+				t.Errorf("%s: %s read failed: %v", test.name, reader, err)
+				continue
+			}
+			if !captureInstant(got).Equal(test.want) || got.Source != "DateTimeDigitized" {
+				t.Errorf("%s: %s read %v from %s, want %v from DateTimeDigitized", test.name, reader, got.Time, got.Source, test.want)
+			}
+		}
+	}
+}
+
+func TestJSONDateString(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+		ok    bool
+	}{
+		{"string", "2021:05:01 12:30:00", "2021:05:01 12:30:00", true},
+		{"numbers", []interface{}{2021.0, 5.0, 1.0, 12.0, 30.0, 0.0}, "2021:05:01 12:30:00", true},
+		{"rationals", []interface{}{"2021/1", "5/1", "1/1", "25/2", "30/1", "0/1"}, "2021:05:01 12:30:00", true},
+		{"day only", []interface{}{2021.0, 5.0, 1.0}, "2021:05:01", true},
+		{"extra components dropped", []interface{}{2021.0, 5.0, 1.0, 12.0, 30.0, 0.0, 99.0}, "2021:05:01 12:30:00", true},
+		{"zero denominator", []interface{}{"2021/0", "5/1", "1/1"}, "", false},
+		{"too few components", []interface{}{2021.0, 5.0}, "", false},
+		{"nested", []interface{}{[]interface{}{2021.0}, 5.0, 1.0}, "", false},
+		{"number", 2021.0, "", false},
+		{"missing", nil, "", false},
+	}
+	for _, test := range tests {
+		got, ok := jsonDateString(test.value)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: jsonDateString(%v) = %q, %v, want %q, %v", test.name, test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestNonStringDateRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "rational.jpg", jpegWithExif(buildTiff(testIFD{exif: []tiffEntry{rationalEntry(0x9003, 2021, 1, 5, 1, 1, 1, 12, 1, 30, 1, 0, 1)}})))
+	// a rational with a zero denominator can not be a date component, the file is left alone instead of crashing the run
+	writeTestFile(t, dir, "broken.jpg", jpegWithExif(buildTiff(testIFD{exif: []tiffEntry{rationalEntry(0x9003, 2021, 0, 5, 1, 1, 1)}})))
+	mustRunMain(t, dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg", "broken.jpg")
+}
+
+// timeZoneOffsetEntry is the older TimeZoneOffset tag, signed hours from UTC for DateTimeOriginal and then DateTime
+func timeZoneOffsetEntry(hours ...int16) tiffEntry {
+	var data []byte
+	for _, value := range hours {
+		data = append(data, byte(value), byte(uint16(value)>>8))
+	}
+	return tiffEntry{0x882A, 8, uint32(len(hours)), data}
+}
+
+func TestTimeZoneOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		ifd    testIFD
+		want   time.Time
+		zoned  bool
+		offset string
+	}{
+		{
+			"hours east of UTC",
+			testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:00:00"), timeZoneOffsetEntry(9)}},
+			time.Date(2021, 5, 1, 3, 0, 0, 0, time.UTC), true, "+09:00",
+		},
+		{
+			"hours west of UTC",
+			testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:00:00"), timeZoneOffsetEntry(-5)}},
+			time.Date(2021, 5, 1, 17, 0, 0, 0, time.UTC), true, "-05:00",
+		},
+		{
+			"OffsetTimeOriginal wins",
+			testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:00:00"), asciiEntry(0x9011, "+02:00"), timeZoneOffsetEntry(9)}},
+			time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC), true, "+02:00",
+		},
+		{
+			"second value for DateTime",
+			testIFD{fields: []tiffEntry{asciiEntry(tagDateTime, "2021:05:01 12:00:00")}, exif: []tiffEntry{timeZoneOffsetEntry(9, 1)}},
+			time.Date(2021, 5, 1, 11, 0, 0, 0, time.UTC), true, "+01:00",
+		},
+		{
+			"no value for DateTime",
+			testIFD{fields: []tiffEntry{asciiEntry(tagDateTime, "2021:05:01 12:00:00")}, exif: []tiffEntry{timeZoneOffsetEntry(9)}},
+			time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC), false, "",
+		},
+		{
+			"out of range",
+			testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:00:00"), timeZoneOffsetEntry(20)}},
+			time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC), false, "",
+		},
+	}
+	for _, test := range tests {
+		x, err := exif.Decode(bytes.NewReader(buildTiff(test.ifd)))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		got, err := preferredExifTime(x, test.name)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got.Zoned != test.zoned || !got.Time.Equal(test.want) {
+			t.Errorf("%s: preferredExifTime = %v (zoned %v), want %v (zoned %v)", test.name, got.Time, got.Zoned, test.want, test.zoned)
+		}
+		if test.offset != "" && !strings.HasSuffix(got.Value, test.offset) {
+			t.Errorf("%s: value %q does not record the offset %s", test.name, got.Value, test.offset)
+		}
+	}
+}
+
+func TestTimeZoneOffsetRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "tokyo.jpg", jpegWithExif(buildTiff(testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:00:00"), timeZoneOffsetEntry(9)}})))
+	mustRunMain(t, "-display-tz", "UTC", dir)
+	assertFiles(t, dir, "2021-05-01 03.00.00.jpg")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// exifDebug dumps every Exif field of each picture, set by -exif-debug
+var exifDebug bool
+
+// fieldCollector is an exif.Walker gathering each field's value as read through the typed tag accessors
+type fieldCollector map[string]string
+
+func (fields fieldCollector) Walk(name exif.FieldName, tag *tiff.Tag) error {
+	fields[string(name)] = directTagValue(tag)
+	return nil
+}
+
+// directTagValue formats a tag from its typed values without going through JSON
+func directTagValue(tag *tiff.Tag) string {
+	switch tag.Format() {
+	case tiff.StringVal:
+		value, _ := tag.StringVal()
+		return strings.TrimRight(value, "\x00")
+	case tiff.UndefVal:
+		return fmt.Sprintf("%q", tag.Val)
+	}
+	var values []string
+	for i := 0; i < int(tag.Count); i++ {
+		switch tag.Format() {
+		case tiff.RatVal:
+			numerator, denominator, _ := tag.Rat2(i)
+			values = append(values, fmt.Sprintf("%v/%v", numerator, denominator))
+		case tiff.FloatVal:
+			value, _ := tag.Float(i)
+			values = append(values, fmt.Sprintf("%v", value))
+		case tiff.IntVal:
+			value, _ := tag.Int64(i)
+			values = append(values, fmt.Sprintf("%v", value))
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// jsonFieldValue formats a value of the JSON round tripped field map the same way directTagValue does
+func jsonFieldValue(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		var values []string
+		for _, item := range list {
+			values = append(values, fmt.Sprintf("%v", item))
+		}
+		return strings.Join(values, ", ")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// exifDebugReport lists the Exif fields of fileWork as the typed accessors and the JSON round trip see them, flagging fields the JSON map lost or changed
+func exifDebugReport(x *exif.Exif, fileWork string) string {
+	direct := fieldCollector{}
+	x.Walk(direct)
+
+	jsonFields := make(map[string]interface{})
+	jsonError := ""
+	data, err := x.MarshalJSON()
+	if err == nil {
+		err = json.Unmarshal(data, &jsonFields)
+	}
+	if err != nil {
+		jsonError = err.Error()
+	}
+
+	names := make([]string, 0, len(direct))
+	for name := range direct {
+		names = append(names, name)
+	}
+	for name := range jsonFields {
+		if _, ok := direct[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	lines := []string{"Exif fields of " + fileWork + ":"}
+	if jsonError != "" {
+		lines = append(lines, "  !! JSON round trip failed: "+jsonError)
+	}
+	for _, name := range names {
+		directValue, inDirect := direct[name]
+		jsonValue, inJSON := jsonFields[name]
+		switch {
+		case !inJSON:
+			lines = append(lines, "  !! "+name+": direct "+directValue+" | missing from JSON map")
+		case !inDirect:
+			lines = append(lines, "  !! "+name+": missing from direct accessors | JSON "+jsonFieldValue(jsonValue))
+		case jsonFieldValue(jsonValue) != directValue:
+			lines = append(lines, "  !! "+name+": direct "+directValue+" | JSON "+jsonFieldValue(jsonValue))
+		default:
+			lines = append(lines, "     "+name+": "+directValue)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
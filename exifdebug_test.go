@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func TestExifDebugReportDirectOnly(t *testing.T) {
+	// an infinite float breaks goexif's JSON marshaling, so the map loses every field while the typed accessors still read them
+	x, err := exif.Decode(bytes.NewReader(buildTiff(testIFD{
+		exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:30:00"), {0x829A, 11, 1, []byte{0, 0, 0x80, 0x7f}}},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := exifDebugReport(x, "IMG_0001.jpg")
+	for _, want := range []string{
+		"!! JSON round trip failed",
+		"!! DateTimeOriginal: direct 2021:05:01 12:30:00 | missing from JSON map",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+	if _, err := exifTimeFromJSON(x, "IMG_0001.jpg"); err == nil {
+		t.Error("exifTimeFromJSON read a date from a map that failed to marshal")
+	}
+	if got, err := preferredExifTime(x, "IMG_0001.jpg"); err != nil || got.Source != "DateTimeOriginal" {
+		t.Errorf("preferredExifTime = %v from %q, %v, want DateTimeOriginal", got.Time, got.Source, err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ignoreFileName lists glob patterns of files to leave alone, like a .gitignore.  Patterns apply to the folder holding the file and everything below it, files in subfolders refine the rules of their parents
+const ignoreFileName = ".exifignore"
+
+// ignoreRule is one line of an ignore file
+type ignoreRule struct {
+	base    string // folder holding the ignore file
+	pattern string
+	negate  bool // !pattern re-includes what a previous rule ignored
+	dirOnly bool // pattern/ only matches folders
+}
+
+// matches reports whether path is matched by the rule.  Patterns holding a slash are matched against the path relative to the rule's folder, others against the base name at any depth
+func (rule ignoreRule) matches(path string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	rel, err := filepath.Rel(rule.base, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if strings.Contains(rule.pattern, "/") {
+		matched, _ := filepath.Match(rule.pattern, rel)
+		return matched
+	}
+	matched, _ := filepath.Match(rule.pattern, filepath.Base(path))
+	return matched
+}
+
+// ignoreMatcher applies every ignore file found between root and a path, caching the rules of each folder
+type ignoreMatcher struct {
+	sync.Mutex
+	root  string
+	rules map[string][]ignoreRule
+}
+
+func newIgnoreMatcher(root string) *ignoreMatcher {
+	return &ignoreMatcher{root: filepath.Clean(root), rules: make(map[string][]ignoreRule)}
+}
+
+// rulesFor loads the ignore file of dir
+func (m *ignoreMatcher) rulesFor(dir string) []ignoreRule {
+	m.Lock()
+	defer m.Unlock()
+	if rules, ok := m.rules[dir]; ok {
+		return rules
+	}
+	var rules []ignoreRule
+	data, err := os.ReadFile(filepath.Join(dir, ignoreFileName))
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			rule := ignoreRule{base: dir}
+			if strings.HasPrefix(line, "!") {
+				rule.negate = true
+				line = line[1:]
+			}
+			if strings.HasSuffix(line, "/") {
+				rule.dirOnly = true
+				line = strings.TrimSuffix(line, "/")
+			}
+			rule.pattern = strings.TrimPrefix(line, "/")
+			if rule.pattern != "" {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	m.rules[dir] = rules
+	return rules
+}
+
+// ignored reports whether path is ignored.  Rules are applied from root down to the folder holding path and the last matching rule wins
+func (m *ignoreMatcher) ignored(path string, isDir bool) bool {
+	path = filepath.Clean(path)
+	if path == m.root {
+		return false
+	}
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+		if dir == m.root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	ignored := false
+	for _, dir := range dirs {
+		for _, rule := range m.rulesFor(dir) {
+			if rule.matches(path, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
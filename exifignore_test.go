@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, ignoreFileName, []byte("# scans are renamed by hand\n*.tif\nprivate/\n/raw/*.jpg\n"))
+	writeTestFile(t, root, "keep/"+ignoreFileName, []byte("!*.tif\nIMG_*\n"))
+	writeTestFile(t, root, "keep/deeper/"+ignoreFileName, []byte("!IMG_0002.jpg\n"))
+	m := newIgnoreMatcher(root)
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"scan.tif", false, true},
+		{"album/scan.tif", false, true},
+		{"private", true, true},
+		{"album/private", true, true},
+		{"private.jpg", false, false},
+		{"raw/IMG_0001.jpg", false, true},
+		{"album/raw/IMG_0001.jpg", false, false},
+		// a nested file re-includes what its parent ignores and ignores more
+		{"keep/scan.tif", false, false},
+		{"keep/IMG_0001.jpg", false, true},
+		{"keep/deeper/IMG_0001.jpg", false, true},
+		{"keep/deeper/IMG_0002.jpg", false, false},
+		{"album/IMG_0001.jpg", false, false},
+	}
+	for _, test := range tests {
+		if got := m.ignored(filepath.Join(root, filepath.FromSlash(test.path)), test.isDir); got != test.want {
+			t.Errorf("ignored(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestExifIgnoreSkipsFiles(t *testing.T) {
+	dir := t.TempDir()
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	writeTestFile(t, dir, ignoreFileName, []byte("IMG_*\n"))
+	writeTestFile(t, dir, "IMG_0001.jpg", photo)
+	writeTestFile(t, dir, "trip/"+ignoreFileName, []byte("!IMG_0002.jpg\n"))
+	writeTestFile(t, dir, "trip/IMG_0002.jpg", photo)
+	writeTestFile(t, dir, "trip/IMG_0003.jpg", photo)
+	mustRunMain(t, dir)
+	assertFiles(t, dir, ignoreFileName, "IMG_0001.jpg", "trip/"+ignoreFileName, "trip/2021-05-01 12.30.00.jpg", "trip/IMG_0003.jpg")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// explain is set by -explain, the result of every file is logged with the metadata and reasoning that led to it
+var explain bool
+
+// explainedFiles holds the media files whose metadata was read, by path, so results can be explained with it
+var explainedFiles = struct {
+	sync.Mutex
+	files map[string]*mediaFile
+}{files: make(map[string]*mediaFile)}
+
+// explainFiles remembers mediaFiles for -explain
+func explainFiles(mediaFiles []*mediaFile) {
+	explainedFiles.Lock()
+	defer explainedFiles.Unlock()
+	for _, mf := range mediaFiles {
+		explainedFiles.files[mf.Path] = mf
+	}
+}
+
+// reasonExplanations say why a file was skipped or moved
+var reasonExplanations = map[string]string{
+	reasonFormatted:    "its name already matches its capture time",
+	reasonNoDate:       "its metadata holds no date",
+	reasonDuplicate:    "a copy in a preferred format or with identical content is kept",
+	reasonLink:         "it is a link to another file of the directory, which is renamed instead",
+	reasonExternalLink: "it is a symlink to a file outside the directory, -follow-symlinks renames it",
+	reasonNotCorrupted: "its name has no collision suffix chain to collapse",
+	reasonTargetExists: "a file with its target name already exists",
+	reasonTargetLarger: "a file with its target name already exists and is at least as large",
+	reasonDeclined:     "the rename was declined when -interactive asked",
+	reasonOutOfRange:   "its capture time is outside -since and -until",
+}
+
+// explanation describes the result of one file as key=value pairs: what was read from it, the name it was due and why it ended up as it did
+func explanation(result fileResult) string {
+	explainedFiles.Lock()
+	mf := explainedFiles.files[result.Path]
+	explainedFiles.Unlock()
+
+	fields := []string{"file=" + strconv.Quote(result.Path), "status=" + result.Status}
+	if result.Reason != "" {
+		fields = append(fields, "reason="+result.Reason)
+	}
+	why := reasonExplanations[result.Reason]
+	if mf == nil {
+		fields = append(fields, "metadata=not-read")
+	} else if mf.Err == nil {
+		fields = append(fields, "source="+strconv.Quote(mf.Source))
+		if mf.Value != "" {
+			fields = append(fields, "value="+strconv.Quote(mf.Value))
+		}
+		timeText := mf.Time.Format(time.RFC3339)
+		switch {
+		case mf.DateOnly:
+			timeText = mf.Time.Format("2006-01-02") + " (date only)"
+		case !mf.Zoned:
+			timeText = mf.Time.Format("2006-01-02T15:04:05") + " (no zone)"
+		}
+		fields = append(fields, "time="+strconv.Quote(timeText))
+		potentialName, ext := targetName(mf)
+		target := potentialName + ext
+		fields = append(fields, "target="+strconv.Quote(target))
+		if result.Status == statusRenamed {
+			if filepath.Base(result.NewPath) == target {
+				why = "the target name was free"
+			} else {
+				why = "the target name was taken, so it was numbered"
+			}
+		}
+	} else if mf.Err != errNoDate {
+		fields = append(fields, "error="+strconv.Quote(mf.Err.Error()))
+	}
+	if result.NewPath != "" {
+		fields = append(fields, "new="+strconv.Quote(result.NewPath))
+	}
+	if result.Status == statusFailed && result.Err != nil && (mf == nil || result.Err != mf.Err) {
+		fields = append(fields, "error="+strconv.Quote(result.Err.Error()))
+	}
+	if why != "" {
+		fields = append(fields, "why="+strconv.Quote(why))
+	}
+	return "Explain " + strings.Join(fields, " ")
+}
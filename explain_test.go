@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplanation(t *testing.T) {
+	restoreAfterTest(t, &fmtDesired)
+	fmtDesired = "2006-01-02 15.04.05"
+	dir := t.TempDir()
+	original := filepath.Join(dir, "a.jpg")
+	renamed := &mediaFile{Path: original, mediaTime: mediaTime{Time: time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC), Source: "DateTimeOriginal", Value: "2021:05:01 12:30:00"}}
+	dayOnly := &mediaFile{Path: filepath.Join(dir, "b.jpg"), mediaTime: mediaTime{Time: time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC), DateOnly: true, Source: sourceGPSDate, Value: "2021:05:01"}}
+	undated := &mediaFile{Path: filepath.Join(dir, "c.jpg"), Err: errNoDate}
+	broken := &mediaFile{Path: filepath.Join(dir, "d.jpg"), Err: errors.New("Could not exif.Decode d.jpg: EOF")}
+	explainFiles([]*mediaFile{renamed, dayOnly, undated, broken})
+
+	tests := []struct {
+		name   string
+		result fileResult
+		want   []string
+	}{
+		{
+			"renamed",
+			fileResult{Path: original, NewPath: filepath.Join(dir, "2021-05-01 12.30.00.jpg"), Status: statusRenamed},
+			[]string{`status=renamed`, `source="DateTimeOriginal"`, `value="2021:05:01 12:30:00"`, `time="2021-05-01T12:30:00 (no zone)"`, `target="2021-05-01 12.30.00.jpg"`, `why="the target name was free"`},
+		},
+		{
+			"numbered",
+			fileResult{Path: original, NewPath: filepath.Join(dir, "2021-05-01 12.30.00-1.jpg"), Status: statusRenamed},
+			[]string{`new="` + filepath.Join(dir, "2021-05-01 12.30.00-1.jpg") + `"`, `why="the target name was taken, so it was numbered"`},
+		},
+		{
+			"date only",
+			fileResult{Path: dayOnly.Path, Status: statusSkipped, Reason: reasonTargetExists},
+			[]string{`reason=target-exists`, `source="GPSDateStamp"`, `time="2021-05-01 (date only)"`, `why="a file with its target name already exists"`},
+		},
+		{"no date", fileResult{Path: undated.Path, Status: statusSkipped, Reason: reasonNoDate}, []string{`reason=no-date`, `why="its metadata holds no date"`}},
+		{"unreadable", fileResult{Path: broken.Path, Status: statusFailed, Err: broken.Err}, []string{`status=failed`, `error="Could not exif.Decode d.jpg: EOF"`}},
+		{"not read", fileResult{Path: filepath.Join(dir, "e.jpg"), Status: statusSkipped, Reason: reasonLink}, []string{`metadata=not-read`, `reason=link`}},
+	}
+	for _, test := range tests {
+		got := explanation(test.result)
+		if !strings.HasPrefix(got, "Explain file=") {
+			t.Errorf("%s: explanation = %s", test.name, got)
+		}
+		for _, want := range test.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: explanation lacks %s\n%s", test.name, want, got)
+			}
+		}
+	}
+	if got := explanation(fileResult{Path: broken.Path, Status: statusFailed, Err: broken.Err}); strings.Count(got, "error=") != 1 {
+		t.Errorf("the read error is explained twice: %s", got)
+	}
+}
+
+func TestExplainRun(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "2021-05-02 08.00.00.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	output := mustRunMain(t, "-explain", dir)
+	renamed := explainLine(output, "IMG_0001.jpg")
+	for _, want := range []string{`status=renamed`, `source="DateTimeOriginal"`, `value="2021:05:01 12:30:00"`, `target="2021-05-01 12.30.00.jpg"`, `why="the target name was free"`} {
+		if !strings.Contains(renamed, want) {
+			t.Errorf("renamed file explanation lacks %s\n%s", want, output)
+		}
+	}
+	skipped := explainLine(output, "2021-05-02 08.00.00.jpg")
+	for _, want := range []string{`status=skipped`, `reason=already-formatted`, `why="its name already matches its capture time"`} {
+		if !strings.Contains(skipped, want) {
+			t.Errorf("skipped file explanation lacks %s\n%s", want, output)
+		}
+	}
+}
+
+// explainLine returns the -explain line of output about the file named name
+func explainLine(output string, name string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "Explain file=") && strings.Contains(line, name+`"`) {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// extensionCase is set by -lowercase-ext and -uppercase-ext to the case every renamed file's extension is given, "" keeps the case it had
+var extensionCase string
+
+const (
+	extensionLower = "lower"
+	extensionUpper = "upper"
+)
+
+// applyExtensionCase gives ext the case of -lowercase-ext or -uppercase-ext
+func applyExtensionCase(ext string) string {
+	switch extensionCase {
+	case extensionLower:
+		return strings.ToLower(ext)
+	case extensionUpper:
+		return strings.ToUpper(ext)
+	}
+	return ext
+}
+
+// sameFile reports whether two paths name the same file, as names differing only in case do on case-insensitive file systems
+func sameFile(a string, b string) bool {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	return err == nil && os.SameFile(infoA, infoB)
+}
+
+// caseVariant reports whether a and b are names differing only in case of the same file, as on case-insensitive file systems.  Hardlinks named alike on other file systems are not told apart from those
+func caseVariant(a string, b string) bool {
+	return a != b && strings.EqualFold(a, b) && sameFile(a, b)
+}
+
+// caseInsensitiveDirs remembers, by folder, whether the file system holding it ignores the case of names
+var caseInsensitiveDirs sync.Map
+
+// caseInsensitive reports whether the file system holding file, which must exist, ignores the case of names, as on macOS and Windows by default.  It is found by looking the file up with the case of its name swapped
+func caseInsensitive(file string) bool {
+	dir := filepath.Dir(file)
+	if known, ok := caseInsensitiveDirs.Load(dir); ok {
+		return known.(bool)
+	}
+	name := filepath.Base(file)
+	swapped := strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, name)
+	if swapped == name {
+		// nothing to swap, the next file will tell
+		return false
+	}
+	insensitive := sameFile(file, filepath.Join(dir, swapped))
+	caseInsensitiveDirs.Store(dir, insensitive)
+	return insensitive
+}
+
+// nameKey returns the key a name is remembered by in maps of names taken: the name folded to lower case when file is on a case-insensitive file system, where names differing only in case clobber each other
+func nameKey(name string, file string) string {
+	if caseInsensitive(file) {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// renameCaseOnly renames from to a name differing only in the case of some letters through a temporary name.  On case-insensitive file systems a direct rename may do nothing, to already being from
+func renameCaseOnly(from string, to string) error {
+	temp := ""
+	for n := 0; n < colisionMax; n++ {
+		candidate := filepath.Join(filepath.Dir(from), ".mediaRenamerToTimestamp-case-"+strconv.Itoa(n)+".tmp")
+		if !extensions.DoesFileExist(candidate) {
+			temp = candidate
+			break
+		}
+	}
+	if temp == "" {
+		return errors.New("Could not find a temporary name to rename " + from + " through")
+	}
+	if err := os.Rename(from, temp); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, to); err != nil {
+		if errBack := os.Rename(temp, from); errBack != nil {
+			return errors.New(err.Error() + ", the file is left as " + temp)
+		}
+		return err
+	}
+	// a rename between two links of the same file does nothing, the temporary link is left over
+	if sameFile(temp, to) {
+		return os.Remove(temp)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// caseInsensitiveName gives file a second name differing only in case, as a case-insensitive file system would resolve it, by hardlinking it
+func caseInsensitiveName(t *testing.T, file string, name string) string {
+	t.Helper()
+	alias := filepath.Join(filepath.Dir(file), name)
+	if err := os.Link(file, alias); err != nil {
+		t.Skip("hardlinks are not supported here: " + err.Error())
+	}
+	return alias
+}
+
+func TestCaseVariant(t *testing.T) {
+	dir := t.TempDir()
+	upper := writeTestFile(t, dir, "IMG_0001.JPG", []byte("one"))
+	lower := caseInsensitiveName(t, upper, "img_0001.jpg")
+	other := writeTestFile(t, dir, "IMG_0002.JPG", []byte("two"))
+	otherLower := writeTestFile(t, dir, "img_0002.jpg", []byte("two"))
+	renamed := caseInsensitiveName(t, other, "copy.JPG")
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"same name", upper, upper, false},
+		{"same file in another case", upper, lower, true},
+		{"different files in another case", other, otherLower, false},
+		{"same file under another name", other, renamed, false},
+	}
+	for _, test := range tests {
+		if got := caseVariant(test.a, test.b); got != test.want {
+			t.Errorf("%s: caseVariant = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRenameCaseOnly(t *testing.T) {
+	tests := []struct {
+		name        string
+		insensitive bool
+	}{
+		{"case-sensitive file system", false},
+		{"case-insensitive file system", true},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		from := writeTestFile(t, dir, "2021-05-01 12.30.00.JPG", []byte("photo"))
+		to := filepath.Join(dir, "2021-05-01 12.30.00.jpg")
+		if test.insensitive {
+			caseInsensitiveName(t, from, filepath.Base(to))
+		}
+		if err := renameCaseOnly(from, to); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		// the temporary name is gone and only the new case is left
+		assertFiles(t, dir, "2021-05-01 12.30.00.jpg")
+		if data, _ := os.ReadFile(to); string(data) != "photo" {
+			t.Errorf("%s: %s holds %q", test.name, to, data)
+		}
+	}
+}
+
+func TestRenameWithCollisionCaseOnly(t *testing.T) {
+	dir := t.TempDir()
+	from := writeTestFile(t, dir, "2021-05-01 12.30.00.JPG", []byte("photo"))
+	caseInsensitiveName(t, from, "2021-05-01 12.30.00.jpg")
+	// the target seems taken by the file itself, which must not push the file to a collision suffix
+	got, err := renameWithCollision(from, dir, "2021-05-01 12.30.00", ".jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "2021-05-01 12.30.00.jpg"); got != want {
+		t.Errorf("renameWithCollision = %s, want %s", got, want)
+	}
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg")
+}
+
+func TestLowercaseExtRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "2021-05-01 12.30.00.JPG", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "IMG_0001.JPEG", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	mustRunMain(t, "-lowercase-ext", dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg", "2021-05-02 08.00.00.jpeg")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseFilenameDates is set by -parse-filename-date, media files whose metadata holds no date are then named after a date found in their name
+var parseFilenameDates bool
+
+// filenameDatePatterns find dates in names such as IMG-20210501-WA0001 (WhatsApp) or Screenshot_20210501_123000.  Their year, month and day groups are required, hour, minute and second optional.  Patterns with a time of day come first, -filename-date-regex goes before them all
+var filenameDatePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?:^|\D)(?P<year>(?:19|20)\d{2})(?P<month>\d{2})(?P<day>\d{2})[ _-]?(?P<hour>\d{2})(?P<minute>\d{2})(?P<second>\d{2})(?:\D|$)`),
+	regexp.MustCompile(`(?:^|\D)(?P<year>(?:19|20)\d{2})-(?P<month>\d{2})-(?P<day>\d{2})(?:[ _T-]|\D+)(?P<hour>\d{2})[.:_-](?P<minute>\d{2})[.:_-](?P<second>\d{2})(?:\D|$)`),
+	regexp.MustCompile(`(?:^|\D)(?P<year>(?:19|20)\d{2})(?P<month>\d{2})(?P<day>\d{2})(?:\D|$)`),
+	regexp.MustCompile(`(?:^|\D)(?P<year>(?:19|20)\d{2})-(?P<month>\d{2})-(?P<day>\d{2})(?:\D|$)`),
+}
+
+// addFilenameDateRegex puts a -filename-date-regex in front of the built in patterns
+func addFilenameDateRegex(expression string) error {
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		return err
+	}
+	for _, group := range []string{"year", "month", "day"} {
+		if re.SubexpIndex(group) < 0 {
+			return errors.New("it needs named groups year, month and day, e.g. (?P<year>\\d{4})")
+		}
+	}
+	filenameDatePatterns = append([]*regexp.Regexp{re}, filenameDatePatterns...)
+	return nil
+}
+
+// filenameDate returns the date found in the name of file by the first pattern of filenameDatePatterns which matches a real date.  Like camera clocks the time has no zone, a name without a time of day gives a date only time
+func filenameDate(file string) (mediaTime, bool) {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	for _, re := range filenameDatePatterns {
+		match := re.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		group := func(name string) (int, bool) {
+			i := re.SubexpIndex(name)
+			if i < 0 || match[i] == "" {
+				return 0, false
+			}
+			value, err := strconv.Atoi(match[i])
+			return value, err == nil
+		}
+		year, _ := group("year")
+		month, _ := group("month")
+		day, _ := group("day")
+		hour, hasTime := group("hour")
+		minute, _ := group("minute")
+		second, _ := group("second")
+		t := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+		// time.Date normalizes out of range values, a name holding e.g. month 13 is no date
+		if t.Year() != year || int(t.Month()) != month || t.Day() != day || t.Hour() != hour || t.Minute() != minute || t.Second() != second {
+			continue
+		}
+		return mediaTime{Time: t, Source: sourceFileName, DateOnly: !hasTime, Value: strings.TrimSpace(match[0])}, true
+	}
+	return mediaTime{}, false
+}
+
+// useFilenameDate names a media file whose metadata gave no date after the date in its name, with -parse-filename-date
+func useFilenameDate(mf *mediaFile) {
+	if !parseFilenameDates || mf.Err == nil {
+		return
+	}
+	if mt, ok := filenameDate(mf.Path); ok {
+		mf.mediaTime, mf.Err = mt, nil
+	}
+}
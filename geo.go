@@ -0,0 +1,163 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// unknownLocation is the folder -organize-by-location moves files without a GPS position, or outside every country of countryBoxes, into
+const unknownLocation = "Unknown Location"
+
+// locationRoot is set by -organize-by-location to the processed directory, media files are then renamed into a folder named after their country under it
+var locationRoot string
+
+// countryBox is a rectangle of latitudes and longitudes around a country
+type countryBox struct {
+	Name           string
+	MinLat, MinLon float64
+	MaxLat, MaxLon float64
+}
+
+// countryBoxes is the offline table countries are looked up in.  Boxes overlap near borders, the smallest box holding a position wins, so places close to a border may be filed under a neighbour
+var countryBoxes = []countryBox{
+	{"Albania", 39.62, 19.30, 42.69, 21.02},
+	{"Algeria", 19.06, -8.68, 37.12, 12.00},
+	{"Argentina", -55.25, -73.42, -21.83, -53.63},
+	{"Australia", -43.63, 113.34, -10.67, 153.57},
+	{"Austria", 46.43, 9.48, 49.04, 16.98},
+	{"Bangladesh", 20.67, 88.08, 26.45, 92.67},
+	{"Belarus", 51.32, 23.20, 56.17, 32.69},
+	{"Belgium", 49.53, 2.51, 51.48, 6.16},
+	{"Bolivia", -22.87, -69.59, -9.76, -57.50},
+	{"Bosnia and Herzegovina", 42.65, 15.75, 45.23, 19.60},
+	{"Brazil", -33.77, -73.99, 5.24, -34.73},
+	{"Bulgaria", 41.23, 22.38, 44.23, 28.56},
+	{"Cambodia", 10.49, 102.35, 14.57, 107.61},
+	{"Canada", 41.68, -141.00, 83.23, -52.65},
+	{"Chile", -55.61, -75.64, -17.58, -66.96},
+	{"China", 18.20, 73.68, 53.46, 135.03},
+	{"Colombia", -4.30, -78.99, 12.44, -66.88},
+	{"Costa Rica", 8.23, -85.94, 11.22, -82.55},
+	{"Croatia", 42.48, 13.66, 46.50, 19.39},
+	{"Cuba", 19.86, -84.97, 23.19, -74.18},
+	{"Cyprus", 34.57, 32.26, 35.17, 34.00},
+	{"Czechia", 48.56, 12.24, 51.12, 18.85},
+	{"Denmark", 54.80, 8.09, 57.73, 12.69},
+	{"Dominican Republic", 17.60, -71.95, 19.88, -68.32},
+	{"Ecuador", -4.96, -80.97, 1.38, -75.23},
+	{"Egypt", 22.00, 24.70, 31.59, 36.87},
+	{"Estonia", 57.47, 23.34, 59.61, 28.13},
+	{"Ethiopia", 3.42, 32.95, 14.96, 47.79},
+	{"Finland", 59.81, 20.65, 70.16, 31.52},
+	{"France", 41.33, -5.14, 51.09, 9.56},
+	{"Germany", 47.30, 5.99, 54.98, 15.02},
+	{"Greece", 34.92, 20.15, 41.83, 26.60},
+	{"Guatemala", 13.74, -92.23, 17.82, -88.23},
+	{"Hong Kong", 22.15, 113.84, 22.56, 114.41},
+	{"Hungary", 45.76, 16.20, 48.62, 22.71},
+	{"Iceland", 63.50, -24.33, 66.53, -13.61},
+	{"India", 7.97, 68.18, 35.49, 97.40},
+	{"Indonesia", -10.36, 95.29, 5.48, 141.03},
+	{"Iran", 25.08, 44.11, 39.71, 63.32},
+	{"Iraq", 29.10, 38.79, 37.39, 48.57},
+	{"Ireland", 51.67, -9.98, 55.13, -6.03},
+	{"Israel", 29.50, 34.27, 33.28, 35.84},
+	{"Italy", 36.62, 6.75, 47.12, 18.48},
+	{"Jamaica", 17.70, -78.34, 18.52, -76.20},
+	{"Japan", 24.04, 122.93, 45.55, 145.82},
+	{"Jordan", 29.20, 34.92, 33.38, 39.20},
+	{"Kazakhstan", 40.66, 46.47, 55.39, 87.36},
+	{"Kenya", -4.68, 33.89, 5.51, 41.86},
+	{"Laos", 13.88, 100.12, 22.46, 107.56},
+	{"Latvia", 55.62, 21.06, 57.97, 28.18},
+	{"Lebanon", 33.09, 35.13, 34.64, 36.61},
+	{"Liechtenstein", 47.05, 9.47, 47.27, 9.64},
+	{"Lithuania", 53.91, 21.06, 56.37, 26.59},
+	{"Luxembourg", 49.44, 5.67, 50.13, 6.24},
+	{"Malaysia", 0.77, 100.09, 6.93, 119.18},
+	{"Malta", 35.80, 14.18, 36.08, 14.58},
+	{"Mexico", 14.53, -117.13, 32.72, -86.81},
+	{"Moldova", 45.49, 26.62, 48.47, 30.02},
+	{"Monaco", 43.72, 7.41, 43.75, 7.44},
+	{"Mongolia", 41.60, 87.75, 52.05, 119.77},
+	{"Montenegro", 41.88, 18.45, 43.52, 20.34},
+	{"Morocco", 21.42, -17.02, 35.76, -1.12},
+	{"Myanmar", 9.93, 92.30, 28.34, 101.18},
+	{"Nepal", 26.40, 80.09, 30.42, 88.17},
+	{"Netherlands", 50.80, 3.31, 53.51, 7.09},
+	{"New Zealand", -46.64, 166.51, -34.45, 178.52},
+	{"Nigeria", 4.24, 2.69, 13.87, 14.58},
+	{"North Macedonia", 40.84, 20.46, 42.32, 22.95},
+	{"Norway", 57.98, 4.99, 71.19, 31.29},
+	{"Pakistan", 23.69, 60.87, 37.13, 77.84},
+	{"Panama", 7.22, -82.97, 9.61, -77.24},
+	{"Paraguay", -27.55, -62.69, -19.29, -54.29},
+	{"Peru", -18.35, -81.41, -0.06, -68.67},
+	{"Philippines", 5.58, 117.17, 18.51, 126.54},
+	{"Poland", 49.03, 14.07, 54.85, 24.03},
+	{"Portugal", 36.84, -9.53, 42.28, -6.39},
+	{"Puerto Rico", 17.88, -67.28, 18.52, -65.22},
+	{"Qatar", 24.56, 50.74, 26.11, 51.61},
+	{"Romania", 43.69, 20.22, 48.22, 29.63},
+	{"Russia", 41.19, 19.64, 81.86, 180.00},
+	{"Saudi Arabia", 16.35, 34.63, 32.16, 55.67},
+	{"Serbia", 42.25, 18.83, 46.17, 22.99},
+	{"Singapore", 1.16, 103.60, 1.48, 104.09},
+	{"Slovakia", 47.76, 16.88, 49.57, 22.56},
+	{"Slovenia", 45.45, 13.70, 46.85, 16.56},
+	{"South Africa", -34.82, 16.34, -22.09, 32.83},
+	{"South Korea", 34.39, 126.12, 38.61, 129.47},
+	{"Spain", 35.95, -9.39, 43.75, 3.04},
+	{"Sri Lanka", 5.97, 79.70, 9.82, 81.79},
+	{"Sweden", 55.36, 11.03, 69.11, 23.90},
+	{"Switzerland", 45.78, 6.02, 47.83, 10.44},
+	{"Taiwan", 21.97, 120.11, 25.30, 121.95},
+	{"Tanzania", -11.72, 29.34, -0.95, 40.32},
+	{"Thailand", 5.69, 97.38, 20.42, 105.59},
+	{"Tunisia", 30.31, 7.52, 37.35, 11.49},
+	{"Turkey", 35.82, 26.04, 42.14, 44.79},
+	{"Ukraine", 44.36, 22.09, 52.34, 40.08},
+	{"United Arab Emirates", 22.50, 51.58, 26.06, 56.40},
+	{"United Kingdom", 49.96, -7.57, 58.64, 1.68},
+	{"United States", 24.40, -124.85, 49.38, -66.89},
+	{"United States", 51.21, -170.00, 71.39, -129.97},
+	{"United States", 18.91, -160.25, 22.24, -154.81},
+	{"Uruguay", -34.95, -58.43, -30.11, -53.21},
+	{"Venezuela", 0.72, -73.30, 12.16, -59.76},
+	{"Vietnam", 8.60, 102.17, 23.35, 109.34},
+}
+
+// countryAt returns the country of a position, or unknownLocation when no box of countryBoxes holds it
+func countryAt(lat float64, lon float64) string {
+	country := unknownLocation
+	smallest := 0.0
+	for _, box := range countryBoxes {
+		if lat < box.MinLat || lat > box.MaxLat || lon < box.MinLon || lon > box.MaxLon {
+			continue
+		}
+		area := (box.MaxLat - box.MinLat) * (box.MaxLon - box.MinLon)
+		if country == unknownLocation || area < smallest {
+			country, smallest = box.Name, area
+		}
+	}
+	return country
+}
+
+// exifCountry returns the country of the GPSLatitude and GPSLongitude of a picture, or unknownLocation without them.  0,0 is what some cameras write without a fix, it counts as no position
+func exifCountry(x *exif.Exif) string {
+	lat, lon, err := x.LatLong()
+	if err != nil || lat == 0 && lon == 0 {
+		return unknownLocation
+	}
+	return countryAt(lat, lon)
+}
+
+// locationDir returns the folder under locationRoot -organize-by-location files a media file into
+func locationDir(mf *mediaFile) string {
+	country := mf.Country
+	if country == "" {
+		country = unknownLocation
+	}
+	return filepath.Join(locationRoot, country)
+}
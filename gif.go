@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// gifExtensions are GIF images, which carry no Exif.  Some tools write the creation date into a comment extension instead
+var gifExtensions = []string{
+	"GIF",
+}
+
+// commentDateRegexp matches a date and time of day in free text, Exif style (2006:01:02 15:04:05) or ISO 8601 with an optional zone
+var commentDateRegexp = regexp.MustCompile(`(\d{4})[-:](\d{2})[-:](\d{2})[ T](\d{2}:\d{2}:\d{2})(Z|[+-]\d{2}:?\d{2})?`)
+
+// parseCommentDate returns the first date found in a comment
+func parseCommentDate(comment string) (mediaTime, bool) {
+	match := commentDateRegexp.FindStringSubmatch(comment)
+	if match == nil {
+		return mediaTime{}, false
+	}
+	value := match[1] + "-" + match[2] + "-" + match[3] + " " + match[4]
+	if zone := match[5]; zone != "" {
+		if zone != "Z" && !strings.Contains(zone, ":") {
+			zone = zone[:3] + ":" + zone[3:]
+		}
+		timeInfo, err := time.Parse("2006-01-02 15:04:05Z07:00", value+zone)
+		return mediaTime{Time: timeInfo, Zoned: true, Value: match[0]}, err == nil
+	}
+	timeInfo, err := time.Parse("2006-01-02 15:04:05", value)
+	return mediaTime{Time: timeInfo, Value: match[0]}, err == nil
+}
+
+// gifComments returns the text of every comment extension of a GIF
+func gifComments(data []byte) ([]string, error) {
+	if !strings.HasPrefix(string(data), "GIF8") {
+		return nil, errors.New("Not a GIF")
+	}
+	if len(data) < 13 {
+		return nil, errors.New("Truncated GIF header")
+	}
+	// a global color table follows the logical screen descriptor when its packed field says so
+	i := 13
+	if packed := data[10]; packed&0x80 != 0 {
+		i += 3 << ((packed & 7) + 1)
+	}
+	var comments []string
+	for i < len(data) {
+		switch data[i] {
+		case 0x3B:
+			return comments, nil
+		case 0x21:
+			if i+1 >= len(data) {
+				return comments, errors.New("Truncated extension")
+			}
+			label := data[i+1]
+			block, next, err := gifSubBlocks(data, i+2)
+			if err != nil {
+				return comments, err
+			}
+			if label == 0xFE {
+				comments = append(comments, string(block))
+			}
+			i = next
+		case 0x2C:
+			// image descriptor, its optional local color table and the LZW code size precede the image data
+			if i+10 >= len(data) {
+				return comments, errors.New("Truncated image descriptor")
+			}
+			packed := data[i+9]
+			i += 10
+			if packed&0x80 != 0 {
+				i += 3 << ((packed & 7) + 1)
+			}
+			_, next, err := gifSubBlocks(data, i+1)
+			if err != nil {
+				return comments, err
+			}
+			i = next
+		default:
+			return comments, errors.New("Invalid GIF block")
+		}
+	}
+	return comments, nil
+}
+
+// gifSubBlocks joins the data sub-blocks starting at i and returns the position after their terminator
+func gifSubBlocks(data []byte, i int) ([]byte, int, error) {
+	var block []byte
+	for {
+		if i >= len(data) {
+			return block, i, errors.New("Truncated GIF data")
+		}
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return block, i, nil
+		}
+		if i+size > len(data) {
+			return block, i, errors.New("Truncated GIF data")
+		}
+		block = append(block, data[i:i+size]...)
+		i += size
+	}
+}
+
+// gifTime returns the first date found in the comment extensions of a GIF.  Comments are read up to the first broken block, a GIF without a dated comment has no date rather than failing
+func gifTime(data []byte, fileWork string) (mediaTime, error) {
+	comments, err := gifComments(data)
+	if len(data) < 13 || !strings.HasPrefix(string(data), "GIF8") {
+		return mediaTime{}, errors.New("Could not read GIF " + fileWork + ": " + err.Error())
+	}
+	for _, comment := range comments {
+		if mt, ok := parseCommentDate(comment); ok {
+			mt.Source = sourceGIFComment
+			return mt, nil
+		}
+	}
+	return mediaTime{}, errNoDate
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"strings"
+	"testing"
+	"time"
+)
+
+// animatedGIF returns a two frame GIF with a comment extension for every comment, placed after its global color table as GIF editors write them
+func animatedGIF(t *testing.T, comments ...string) []byte {
+	t.Helper()
+	palette := color.Palette{color.Black, color.White}
+	frames := &gif.GIF{Config: image.Config{ColorModel: palette, Width: 2, Height: 2}}
+	for i := 0; i < 2; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 2, 2), palette)
+		frame.SetColorIndex(i, i, 1)
+		frames.Image = append(frames.Image, frame)
+		frames.Delay = append(frames.Delay, 10)
+	}
+	var encoded bytes.Buffer
+	if err := gif.EncodeAll(&encoded, frames); err != nil {
+		t.Fatal(err)
+	}
+	data := encoded.Bytes()
+	header := 13
+	if packed := data[10]; packed&0x80 != 0 {
+		header += 3 << ((packed & 7) + 1)
+	}
+	var extensions []byte
+	for _, comment := range comments {
+		extensions = append(extensions, 0x21, 0xFE)
+		// comments longer than a sub-block are split, the reader joins them again
+		for len(comment) > 0 {
+			size := len(comment)
+			if size > 255 {
+				size = 255
+			}
+			extensions = append(append(extensions, byte(size)), comment[:size]...)
+			comment = comment[size:]
+		}
+		extensions = append(extensions, 0)
+	}
+	return append(append(append([]byte{}, data[:header]...), extensions...), data[header:]...)
+}
+
+func TestParseCommentDate(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    time.Time
+		zoned   bool
+		ok      bool
+	}{
+		{"Created 2019:08:07 06:05:04 with GIMP", time.Date(2019, 8, 7, 6, 5, 4, 0, time.UTC), false, true},
+		{"2019-08-07T06:05:04Z", time.Date(2019, 8, 7, 6, 5, 4, 0, time.UTC), true, true},
+		{"taken 2019-08-07 08:05:04+0200", time.Date(2019, 8, 7, 6, 5, 4, 0, time.UTC), true, true},
+		{"2019-13-07 06:05:04", time.Time{}, false, false},
+		{"Made with love", time.Time{}, false, false},
+	}
+	for _, test := range tests {
+		got, ok := parseCommentDate(test.comment)
+		if ok != test.ok || ok && (!got.Time.Equal(test.want) || got.Zoned != test.zoned) {
+			t.Errorf("parseCommentDate(%q) = %v zoned %v, %v, want %v zoned %v, %v", test.comment, got.Time, got.Zoned, ok, test.want, test.zoned, test.ok)
+		}
+	}
+}
+
+func TestGifTime(t *testing.T) {
+	dated := animatedGIF(t, "Made with love", strings.Repeat("x", 300)+" 2019:08:07 06:05:04")
+	commented := animatedGIF(t, "2019:08:07 06:05:04")
+	// the comment and its terminator, then garbage instead of the frames
+	end := bytes.Index(commented, []byte("06:05:04")) + len("06:05:04") + 1
+	broken := append(append([]byte{}, commented[:end]...), 0x99)
+	tests := []struct {
+		name string
+		data []byte
+		want time.Time
+		err  error
+		fail bool
+	}{
+		{"dated comment after an undated one", dated, time.Date(2019, 8, 7, 6, 5, 4, 0, time.UTC), nil, false},
+		{"date before a broken block", broken, time.Date(2019, 8, 7, 6, 5, 4, 0, time.UTC), nil, false},
+		{"no comments", animatedGIF(t), time.Time{}, errNoDate, true},
+		{"undated comment", animatedGIF(t, "Made with love"), time.Time{}, errNoDate, true},
+		{"not a GIF", []byte("\x89PNG\r\n\x1a\n"), time.Time{}, nil, true},
+	}
+	for _, test := range tests {
+		got, err := gifTime(test.data, "a.gif")
+		if (err != nil) != test.fail || test.err != nil && err != test.err {
+			t.Errorf("%s: gifTime error %v, want failure %v (%v)", test.name, err, test.fail, test.err)
+			continue
+		}
+		if !test.fail && (!got.Time.Equal(test.want) || got.Source != sourceGIFComment) {
+			t.Errorf("%s: gifTime = %v from %s, want %v", test.name, got.Time, got.Source, test.want)
+		}
+	}
+}
+
+func TestGifCommentRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "dancing.gif", animatedGIF(t, "Created 2019:08:07 06:05:04"))
+	writeTestFile(t, dir, "plain.gif", animatedGIF(t))
+	output := mustRunMain(t, dir)
+	assertFiles(t, dir, "2019-08-07 06.05.04.gif", "plain.gif")
+	if !strings.Contains(output, "failed 0") {
+		t.Errorf("a GIF without a dated comment failed:\n%s", output)
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/DanielRenne/GoCore/core/logger v0.0.0-20221115154130-45d16c3bf917
 	github.com/DanielRenne/GoCore/core/path v0.0.0-20221115154130-45d16c3bf917
 	github.com/DanielRenne/GoCore/core/utils v0.0.0-20221115154130-45d16c3bf917
+	github.com/gosimple/unidecode v1.0.1
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
 )
 
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// heifExtensions are HEIF based still image formats, including AVIF, whose Exif is stored as an item inside the meta box
+var heifExtensions = []string{
+	"HEIC", "HEIF", "AVIF",
+}
+
+// isoBox is an ISO base media file format box read from memory
+type isoBox struct {
+	Type string
+	Data []byte
+}
+
+// readBoxes splits data into the boxes it holds
+func readBoxes(data []byte) (boxes []isoBox, err error) {
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return boxes, errors.New("Truncated box header")
+		}
+		size := uint64(binary.BigEndian.Uint32(data))
+		boxType := string(data[4:8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes, errors.New("Truncated box header")
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)) {
+			return boxes, errors.New("Invalid size of box " + boxType)
+		}
+		boxes = append(boxes, isoBox{Type: boxType, Data: data[header:size]})
+		data = data[size:]
+	}
+	return
+}
+
+// findBox returns the first box of a type
+func findBox(boxes []isoBox, boxType string) (isoBox, bool) {
+	for _, box := range boxes {
+		if box.Type == boxType {
+			return box, true
+		}
+	}
+	return isoBox{}, false
+}
+
+// byteReader reads big endian fields of a box, remembering when it ran out of data
+type byteReader struct {
+	data []byte
+	err  error
+}
+
+func (r *byteReader) uint(size int) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if size > len(r.data) {
+		r.err = errors.New("Truncated box")
+		return 0
+	}
+	var value uint64
+	for _, b := range r.data[:size] {
+		value = value<<8 | uint64(b)
+	}
+	r.data = r.data[size:]
+	return value
+}
+
+// itemID reads an item ID, 16 bit in version 0 boxes and 32 bit otherwise
+func (r *byteReader) itemID(version uint64) uint32 {
+	if version == 0 {
+		return uint32(r.uint(2))
+	}
+	return uint32(r.uint(4))
+}
+
+// heifExtent is one piece of an item's data
+type heifExtent struct {
+	offset uint64
+	length uint64
+}
+
+// heifItemLocation says where an item's data is, construction method 1 places it inside the idat box instead of the file
+type heifItemLocation struct {
+	method  uint64
+	extents []heifExtent
+}
+
+// parseIloc reads the item location box
+func parseIloc(data []byte) (map[uint32]heifItemLocation, error) {
+	r := &byteReader{data: data}
+	version := r.uint(1)
+	r.uint(3)
+	sizes := r.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0xF)
+	sizes = r.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), int(sizes&0xF)
+	if version == 0 {
+		indexSize = 0
+	}
+	count := uint64(0)
+	if version < 2 {
+		count = r.uint(2)
+	} else {
+		count = r.uint(4)
+	}
+	locations := make(map[uint32]heifItemLocation)
+	for i := uint64(0); i < count && r.err == nil; i++ {
+		var id uint32
+		if version < 2 {
+			id = uint32(r.uint(2))
+		} else {
+			id = uint32(r.uint(4))
+		}
+		var location heifItemLocation
+		if version > 0 {
+			location.method = r.uint(2) & 0xF
+		}
+		r.uint(2) // data reference index
+		baseOffset := r.uint(baseOffsetSize)
+		extents := r.uint(2)
+		for j := uint64(0); j < extents && r.err == nil; j++ {
+			r.uint(indexSize)
+			offset := r.uint(offsetSize)
+			length := r.uint(lengthSize)
+			location.extents = append(location.extents, heifExtent{offset: baseOffset + offset, length: length})
+		}
+		locations[id] = location
+	}
+	return locations, r.err
+}
+
+// parseIinf returns the item type of every item listed in the item information box
+func parseIinf(data []byte) (map[uint32]string, error) {
+	r := &byteReader{data: data}
+	version := r.uint(1)
+	r.uint(3)
+	if version == 0 {
+		r.uint(2)
+	} else {
+		r.uint(4)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	entries, err := readBoxes(r.data)
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[uint32]string)
+	for _, entry := range entries {
+		if entry.Type != "infe" {
+			continue
+		}
+		e := &byteReader{data: entry.Data}
+		entryVersion := e.uint(1)
+		e.uint(3)
+		if entryVersion < 2 {
+			// version 0 and 1 entries predate item types
+			continue
+		}
+		id := uint32(0)
+		if entryVersion == 2 {
+			id = uint32(e.uint(2))
+		} else {
+			id = uint32(e.uint(4))
+		}
+		e.uint(2) // protection index
+		itemType := e.uint(4)
+		if e.err != nil {
+			return nil, e.err
+		}
+		types[id] = string([]byte{byte(itemType >> 24), byte(itemType >> 16), byte(itemType >> 8), byte(itemType)})
+	}
+	return types, nil
+}
+
+// parseIref returns, by reference type, which items every item refers to
+func parseIref(data []byte) (map[string]map[uint32][]uint32, error) {
+	r := &byteReader{data: data}
+	version := r.uint(1)
+	r.uint(3)
+	if r.err != nil {
+		return nil, r.err
+	}
+	boxes, err := readBoxes(r.data)
+	if err != nil {
+		return nil, err
+	}
+	references := make(map[string]map[uint32][]uint32)
+	for _, box := range boxes {
+		b := &byteReader{data: box.Data}
+		from := b.itemID(version)
+		count := b.uint(2)
+		var to []uint32
+		for i := uint64(0); i < count && b.err == nil; i++ {
+			to = append(to, b.itemID(version))
+		}
+		if b.err != nil {
+			return nil, b.err
+		}
+		if references[box.Type] == nil {
+			references[box.Type] = make(map[uint32][]uint32)
+		}
+		references[box.Type][from] = append(references[box.Type][from], to...)
+	}
+	return references, nil
+}
+
+// heifExifItem picks the Exif item describing the primary image.  Exif items describing auxiliary images, such as the HDR gain map newer iPhones store next to the photo, are never used
+func heifExifItem(types map[uint32]string, references map[string]map[uint32][]uint32, primary uint32) (uint32, bool) {
+	auxiliary := make(map[uint32]bool)
+	for from := range references["auxl"] {
+		auxiliary[from] = true
+	}
+	var fallback []uint32
+	for id, itemType := range types {
+		if itemType != "Exif" {
+			continue
+		}
+		describes := references["cdsc"][id]
+		describesAuxiliary := false
+		for _, target := range describes {
+			if target == primary {
+				return id, true
+			}
+			if auxiliary[target] {
+				describesAuxiliary = true
+			}
+		}
+		if !describesAuxiliary {
+			fallback = append(fallback, id)
+		}
+	}
+	if len(fallback) == 0 {
+		return 0, false
+	}
+	// the lowest ID keeps the choice stable when no Exif item names the primary image
+	lowest := fallback[0]
+	for _, id := range fallback[1:] {
+		if id < lowest {
+			lowest = id
+		}
+	}
+	return lowest, true
+}
+
+// heifExif returns the Tiff structured Exif of the primary image of a HEIF file
+func heifExif(data []byte) ([]byte, error) {
+	top, err := readBoxes(data)
+	if err != nil && len(top) == 0 {
+		return nil, err
+	}
+	meta, ok := findBox(top, "meta")
+	if !ok || len(meta.Data) < 4 {
+		return nil, errors.New("No meta box")
+	}
+	children, err := readBoxes(meta.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+
+	primary := uint32(0)
+	if pitm, ok := findBox(children, "pitm"); ok {
+		r := &byteReader{data: pitm.Data}
+		version := r.uint(1)
+		r.uint(3)
+		primary = r.itemID(version)
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+	iinf, ok := findBox(children, "iinf")
+	if !ok {
+		return nil, errors.New("No iinf box")
+	}
+	types, err := parseIinf(iinf.Data)
+	if err != nil {
+		return nil, err
+	}
+	references := make(map[string]map[uint32][]uint32)
+	if iref, ok := findBox(children, "iref"); ok {
+		if references, err = parseIref(iref.Data); err != nil {
+			return nil, err
+		}
+	}
+	id, ok := heifExifItem(types, references, primary)
+	if !ok {
+		return nil, errors.New("No Exif item for the primary image")
+	}
+	iloc, ok := findBox(children, "iloc")
+	if !ok {
+		return nil, errors.New("No iloc box")
+	}
+	locations, err := parseIloc(iloc.Data)
+	if err != nil {
+		return nil, err
+	}
+	location, ok := locations[id]
+	if !ok {
+		return nil, errors.New("No location for the Exif item")
+	}
+	source := data
+	if location.method == 1 {
+		idat, ok := findBox(children, "idat")
+		if !ok {
+			return nil, errors.New("No idat box")
+		}
+		source = idat.Data
+	} else if location.method != 0 {
+		return nil, errors.New("Unsupported Exif item construction method")
+	}
+	var payload []byte
+	for _, extent := range location.extents {
+		if extent.offset > uint64(len(source)) || extent.length > uint64(len(source))-extent.offset {
+			return nil, errors.New("Exif item extent is outside the file")
+		}
+		length := extent.length
+		if length == 0 {
+			length = uint64(len(source)) - extent.offset
+		}
+		payload = append(payload, source[extent.offset:extent.offset+length]...)
+	}
+
+	// the payload starts with the offset of the Tiff header, which usually follows an Exif\0\0 marker
+	if len(payload) < 4 {
+		return nil, errors.New("Truncated Exif item")
+	}
+	offset := uint64(binary.BigEndian.Uint32(payload))
+	payload = payload[4:]
+	if offset < uint64(len(payload)) && isTiffHeader(payload[offset:]) {
+		return payload[offset:], nil
+	}
+	// some encoders write a wrong offset, look for the header near the start
+	for i := 0; i < len(payload) && i < 16; i++ {
+		if isTiffHeader(payload[i:]) {
+			return payload[i:], nil
+		}
+	}
+	return nil, errors.New("No Tiff header in the Exif item")
+}
+
+// scanExif finds Exif data by its Exif\0\0 marker followed by a Tiff header anywhere in data, the last resort for HEIF files whose boxes can not be parsed.  Which image the block describes is unknown, the first one is taken
+func scanExif(data []byte) ([]byte, bool) {
+	marker := []byte("Exif\x00\x00")
+	for start := 0; start < len(data); {
+		i := bytes.Index(data[start:], marker)
+		if i < 0 {
+			return nil, false
+		}
+		tiff := data[start+i+len(marker):]
+		if isTiffHeader(tiff) {
+			return tiff, true
+		}
+		start += i + len(marker)
+	}
+	return nil, false
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// irefEntry is a reference box of an iref box with 16 bit item IDs
+func irefEntry(referenceType string, from uint16, to ...uint16) []byte {
+	body := binary.BigEndian.AppendUint16(nil, from)
+	body = binary.BigEndian.AppendUint16(body, uint16(len(to)))
+	for _, id := range to {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	return atomBytes(referenceType, body)
+}
+
+func TestParseIref(t *testing.T) {
+	version1 := atomBytes("cdsc", []byte{0, 1, 0, 0, 0, 1, 0, 0, 0, 7})
+	tests := []struct {
+		name string
+		data []byte
+		want map[string]map[uint32][]uint32
+		fail bool
+	}{
+		{
+			"gain map",
+			append([]byte{0, 0, 0, 0}, append(irefEntry("auxl", 2, 1), append(irefEntry("cdsc", 3, 2), irefEntry("cdsc", 4, 1)...)...)...),
+			map[string]map[uint32][]uint32{"auxl": {2: {1}}, "cdsc": {3: {2}, 4: {1}}},
+			false,
+		},
+		{"32 bit item IDs", append([]byte{1, 0, 0, 0}, version1...), map[string]map[uint32][]uint32{"cdsc": {0x10000: {7}}}, false},
+		{"several targets", append([]byte{0, 0, 0, 0}, irefEntry("thmb", 5, 1, 2)...), map[string]map[uint32][]uint32{"thmb": {5: {1, 2}}}, false},
+		{"truncated", append([]byte{0, 0, 0, 0}, irefEntry("cdsc", 3, 2)[:11]...), nil, true},
+		{"no header", []byte{0, 0}, nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseIref(test.data)
+		if (err != nil) != test.fail {
+			t.Errorf("%s: parseIref error %v, want failure %v", test.name, err, test.fail)
+			continue
+		}
+		if !test.fail && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parseIref = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestHeifExifItem(t *testing.T) {
+	gainMap := map[string]map[uint32][]uint32{"auxl": {2: {1}}, "cdsc": {3: {2}, 4: {1}}}
+	tests := []struct {
+		name       string
+		types      map[uint32]string
+		references map[string]map[uint32][]uint32
+		primary    uint32
+		want       uint32
+		ok         bool
+	}{
+		{"gain map Exif has the lower ID", map[uint32]string{1: "hvc1", 2: "hvc1", 3: "Exif", 4: "Exif"}, gainMap, 1, 4, true},
+		{"primary not named", map[uint32]string{1: "hvc1", 2: "hvc1", 3: "Exif", 4: "Exif"}, gainMap, 0, 4, true},
+		{"only the gain map has Exif", map[uint32]string{1: "hvc1", 2: "hvc1", 3: "Exif"}, gainMap, 1, 0, false},
+		{"no references", map[uint32]string{1: "hvc1", 6: "Exif", 5: "Exif"}, nil, 1, 5, true},
+		{"no Exif", map[uint32]string{1: "hvc1"}, nil, 1, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := heifExifItem(test.types, test.references, test.primary)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: heifExifItem = %v, %v, want %v, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestGainMapHEICExifItem(t *testing.T) {
+	// gainmap.heic has primary image 1, gain map 2 as its auxiliary image, Exif 3 describing the gain map and Exif 4 describing the photo
+	data, err := os.ReadFile(filepath.Join("testdata", "gainmap.heic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := readBoxes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, ok := findBox(top, "meta")
+	if !ok {
+		t.Fatal("no meta box")
+	}
+	children, err := readBoxes(meta.Data[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	iinf, _ := findBox(children, "iinf")
+	iref, _ := findBox(children, "iref")
+	types, err := parseIinf(iinf.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	references, err := parseIref(iref.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := heifExifItem(types, references, 1); id != 4 || !ok {
+		t.Errorf("heifExifItem = %v, %v, want the photo's Exif 4", id, ok)
+	}
+}
+
+func TestAVIFRenames(t *testing.T) {
+	// export.avif has the layout of gainmap.heic under the avif brand, its photo was taken 2022:07:08 09:10:11
+	dir := t.TempDir()
+	copyTestdata(t, dir, "export.avif", "export.avif")
+	copyTestdata(t, dir, "export.avif", "trip/IMG_0001.AVIF")
+	// .heif files are read the same way
+	copyTestdata(t, dir, "gainmap.heic", "edits/IMG_0002.heif")
+	mustRunMain(t, dir)
+	assertFiles(t, dir, "2022-07-08 09.10.11.avif", "edits/2022-07-08 09.10.11.heif", "trip/2022-07-08 09.10.11.AVIF")
+}
+
+// exifItemPayload is the content of a HEIF Exif item: the offset of the Tiff header after the Exif marker, the marker, then the Tiff
+func exifItemPayload(tiff []byte) []byte {
+	return append(append([]byte{0, 0, 0, 6}, "Exif\x00\x00"...), tiff...)
+}
+
+func TestHeifExif(t *testing.T) {
+	// gainmap.heic keeps its Exif items in mdat, idat.heic the same items in the idat box of meta.  idat.heic is synthetic: phones write Exif into mdat, so it was built box by box (ftyp, meta with iinf, iloc construction method 1 and idat) to the HEIF layout some editors write, with no image data so it stays a few hundred bytes
+	mdat, err := os.ReadFile(filepath.Join("testdata", "gainmap.heic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idat, err := os.ReadFile(filepath.Join("testdata", "idat.heic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	brokenIloc := append([]byte{}, mdat...)
+	brokenIloc[bytes.Index(brokenIloc, []byte("iloc"))+4] = 9
+	outside := append([]byte{}, mdat...)
+	outside = outside[:len(outside)-20]
+	tests := []struct {
+		name string
+		data []byte
+		want time.Time
+		fail bool
+	}{
+		{"Exif in mdat", mdat, time.Date(2022, 7, 8, 9, 10, 11, 0, time.UTC), false},
+		{"Exif in idat", idat, time.Date(2022, 7, 8, 9, 10, 11, 0, time.UTC), false},
+		{"unknown iloc version", brokenIloc, time.Time{}, true},
+		{"Exif item cut off", outside, time.Time{}, true},
+		{"no meta box", atomBytes("ftyp", []byte("heic")), time.Time{}, true},
+		{"not a HEIF file", jpegWithExif(exifTiff("", "2021:01:02 03:04:05")), time.Time{}, true},
+	}
+	for _, test := range tests {
+		tiffData, err := heifExif(test.data)
+		if (err != nil) != test.fail {
+			t.Errorf("%s: heifExif error %v, want failure %v", test.name, err, test.fail)
+			continue
+		}
+		if test.fail {
+			continue
+		}
+		x, err := exif.Decode(bytes.NewReader(tiffData))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got, err := exifTime(x, test.name); err != nil || !got.Time.Equal(test.want) {
+			t.Errorf("%s: Exif date %v, %v, want %v", test.name, got.Time, err, test.want)
+		}
+	}
+}
+
+func TestScanExif(t *testing.T) {
+	tiff := exifTiff("", "2021:01:02 03:04:05")
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+		ok   bool
+	}{
+		{"after broken boxes", append(atomBytes("ftyp", []byte("heic")), append([]byte{0xFF, 0xFF, 0xFF, 0xFF, 'm', 'e', 't', 'a'}, exifItemPayload(tiff)...)...), tiff, true},
+		{"marker without a Tiff first", append([]byte("Exif\x00\x00not a tiff"), exifItemPayload(tiff)...), tiff, true},
+		{"marker without a Tiff only", []byte("Exif\x00\x00not a tiff"), nil, false},
+		{"no marker", tiff, nil, false},
+	}
+	for _, test := range tests {
+		got, ok := scanExif(test.data)
+		if ok != test.ok || !bytes.Equal(got, test.want) {
+			t.Errorf("%s: scanExif = %d bytes, %v, want %d bytes, %v", test.name, len(got), ok, len(test.want), test.ok)
+		}
+	}
+}
+
+func TestHEICRenames(t *testing.T) {
+	dir := t.TempDir()
+	copyTestdata(t, dir, "gainmap.heic", "mdat/IMG_0001.HEIC")
+	copyTestdata(t, dir, "idat.heic", "idat/IMG_0002.HEIC")
+	// a JPEG saved with the extension of a HEIC is decoded as it is
+	writeTestFile(t, dir, "jpeg/IMG_0003.HEIC", jpegWithExif(exifTiff("", "2021:01:02 03:04:05")))
+	// boxes which can not be parsed leave finding the Exif marker
+	writeTestFile(t, dir, "scanned/IMG_0004.HEIC", append(atomBytes("ftyp", []byte("heic")), append([]byte{0xFF, 0xFF, 0xFF, 0xFF, 'm', 'e', 't', 'a'}, exifItemPayload(exifTiff("", "2020:05:06 07:08:09"))...)...))
+	writeTestFile(t, dir, "IMG_0005.HEIC", atomBytes("ftyp", []byte("heic")))
+	output, _ := runMain(t, dir)
+	assertFiles(t, dir, "IMG_0005.HEIC", "idat/2022-07-08 09.10.11.HEIC", "jpeg/2021-01-02 03.04.05.HEIC", "mdat/2022-07-08 09.10.11.HEIC", "scanned/2020-05-06 07.08.09.HEIC")
+	if want := "Could not find Exif in " + filepath.Join(dir, "IMG_0005.HEIC"); !strings.Contains(output, want) {
+		t.Errorf("output lacks %q:\n%s", want, output)
+	}
+}
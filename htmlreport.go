@@ -0,0 +1,88 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"time"
+)
+
+// htmlReportTemplate is the page -html-report writes, plain enough to open in any browser and share
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Media rename report for {{.Root}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+.counts span { display: inline-block; margin-right: 1em; padding: .3em .8em; border-radius: .3em; background: #eee; }
+table { border-collapse: collapse; width: 100%; margin-top: 1em; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; }
+th { background: #f5f5f5; }
+tr.renamed td.status { color: #17702b; }
+tr.moved td.status, tr.linked td.status { color: #1a4f9c; }
+tr.skipped td.status { color: #777; }
+tr.failed td.status { color: #b3261e; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Media rename report for {{.Root}}</h1>
+<p>{{.Date}}</p>
+<p class="counts"><span>Renamed {{.Renamed}}</span><span>Moved {{.Moved}}</span>{{if .Linked}}<span>Linked {{.Linked}}</span>{{end}}<span>Skipped {{.Skipped}}</span><span>Failed {{.Failed}}</span><span>Total {{len .Rows}}</span></p>
+<table>
+<tr><th>Original</th><th>New</th><th>Date source</th><th>Status</th></tr>
+{{range .Rows}}<tr class="{{.Status}}"><td>{{.Original}}</td><td>{{.New}}</td><td>{{.Source}}</td><td class="status">{{.Status}}{{if .Detail}} ({{.Detail}}){{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// htmlReportRow is one file of the -html-report table
+type htmlReportRow struct {
+	Original string
+	New      string
+	Source   string
+	Status   string
+	Detail   string
+}
+
+// writeHTMLReport renders the summary and every file's result as a static HTML page.  The date source of each file is taken from mediaFiles
+func writeHTMLReport(file string, root string, mediaFiles []*mediaFile) error {
+	sources := make(map[string]string)
+	for _, mf := range mediaFiles {
+		sources[mf.Path] = mf.Source
+	}
+	page := struct {
+		Root                                    string
+		Date                                    string
+		Renamed, Moved, Linked, Skipped, Failed int
+		Rows                                    []htmlReportRow
+	}{
+		Root:    root,
+		Date:    time.Now().Format("2006-01-02 15:04:05"),
+		Renamed: results.count(statusRenamed),
+		Moved:   results.count(statusMoved),
+		Linked:  results.count(statusLinked),
+		Skipped: results.count(statusSkipped),
+		Failed:  results.count(statusFailed),
+	}
+	results.Lock()
+	for _, result := range results.Items {
+		row := htmlReportRow{Original: result.Path, New: result.NewPath, Source: sources[result.Path], Status: result.Status, Detail: result.Reason}
+		if result.Err != nil {
+			row.Detail = result.Err.Error()
+		}
+		page.Rows = append(page.Rows, row)
+	}
+	results.Unlock()
+
+	fd, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	if err := htmlReportTemplate.Execute(fd, page); err != nil {
+		return err
+	}
+	return fd.Close()
+}
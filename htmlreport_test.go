@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+	t.Cleanup(func() { results = runResults{} })
+	results = runResults{}
+	dir := t.TempDir()
+	renamed := &mediaFile{Path: filepath.Join(dir, "IMG_0001.jpg"), mediaTime: mediaTime{Source: "DateTimeOriginal"}}
+	results.add(fileResult{Path: renamed.Path, NewPath: filepath.Join(dir, "2021-05-01 12.30.00.jpg"), Status: statusRenamed})
+	results.add(fileResult{Path: filepath.Join(dir, "<b>odd</b>.jpg"), Status: statusSkipped, Reason: reasonNoDate})
+	results.add(fileResult{Path: filepath.Join(dir, "broken.jpg"), Status: statusFailed, Err: errors.New("Could not exif.Decode broken.jpg: EOF")})
+	report := filepath.Join(dir, "report.html")
+	if err := writeHTMLReport(report, dir, []*mediaFile{renamed}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		"<title>Media rename report for " + dir + "</title>",
+		"<span>Renamed 1</span><span>Moved 0</span><span>Skipped 1</span><span>Failed 1</span><span>Total 3</span>",
+		`<tr class="renamed"><td>` + renamed.Path + `</td><td>` + filepath.Join(dir, "2021-05-01 12.30.00.jpg") + `</td><td>DateTimeOriginal</td><td class="status">renamed</td></tr>`,
+		// names are escaped, not rendered as markup
+		`<tr class="skipped"><td>` + filepath.Join(dir, "&lt;b&gt;odd&lt;/b&gt;.jpg") + `</td><td></td><td></td><td class="status">skipped (no-date)</td></tr>`,
+		`<td class="status">failed (Could not exif.Decode broken.jpg: EOF)</td>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("report lacks %s\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "Linked") {
+		t.Errorf("report counts links without any")
+	}
+}
+
+func TestHTMLReportRun(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("2021:05:02 08:00:00", "")))
+	writeTestFile(t, dir, "2021-05-03 09.00.00.jpg", jpegWithExif(exifTiff("", "2021:05:03 09:00:00")))
+	report := filepath.Join(root, "report.html")
+	mustRunMain(t, "-html-report", report, dir)
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := string(data)
+	for _, want := range []string{
+		"<span>Renamed 2</span><span>Moved 0</span><span>Skipped 1</span><span>Failed 0</span><span>Total 3</span>",
+		"<td>" + filepath.Join(dir, "IMG_0001.jpg") + "</td><td>" + filepath.Join(dir, "2021-05-01 12.30.00.jpg") + "</td><td>DateTimeOriginal</td>",
+		"<td>" + filepath.Join(dir, "IMG_0002.jpg") + "</td><td>" + filepath.Join(dir, "2021-05-02 08.00.00.jpg") + "</td><td>DateTime</td>",
+		`<td class="status">skipped (already-formatted)</td>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("report lacks %s\n%s", want, page)
+		}
+	}
+	if rows := strings.Count(page, "<tr class="); rows != 3 {
+		t.Errorf("report has %d rows, want 3", rows)
+	}
+}
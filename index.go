@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// indexEntry is what -build-index stores about one media file.  Size and ModTime tell whether the file changed since
+type indexEntry struct {
+	Size     int64     `json:"size"`
+	ModTime  int64     `json:"modTime"`
+	Time     time.Time `json:"time"`
+	Zoned    bool      `json:"zoned,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	DateOnly bool      `json:"dateOnly,omitempty"`
+	Value    string    `json:"value,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	SHA256   string    `json:"sha256"`
+}
+
+// mediaIndex maps paths relative to Root to what was read from them
+type mediaIndex struct {
+	sync.Mutex
+	Root  string                `json:"root"`
+	Files map[string]indexEntry `json:"files"`
+}
+
+// fileSHA256 returns the hex encoded sha256 of a file's contents
+func fileSHA256(file string) (string, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// indexKey is the path of file relative to the index root
+func (idx *mediaIndex) indexKey(file string) (string, error) {
+	return filepath.Rel(idx.Root, file)
+}
+
+// buildIndex reads the capture time and hash of every media file
+func buildIndex(root string, mediaFiles []*mediaFile) (*mediaIndex, error) {
+	idx := &mediaIndex{Root: filepath.Clean(root), Files: make(map[string]indexEntry)}
+	var firstErr error
+	runJobs(mediaFiles, func(mf *mediaFile) {
+		info, err := os.Stat(mf.Path)
+		var hash string
+		if err == nil {
+			hash, err = fileSHA256(mf.Path)
+		}
+		key, errKey := idx.indexKey(mf.Path)
+		if err == nil {
+			err = errKey
+		}
+		if err != nil {
+			idx.Lock()
+			if firstErr == nil {
+				firstErr = errors.New("Could not index " + mf.Path + ": " + err.Error())
+			}
+			idx.Unlock()
+			return
+		}
+		readMediaTime(mf)
+		entry := indexEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Time: mf.Time, Zoned: mf.Zoned, Source: mf.Source, DateOnly: mf.DateOnly, Value: mf.Value, Comment: mf.Comment, SHA256: hash}
+		if mf.Err != nil {
+			entry.Error = mf.Err.Error()
+		}
+		idx.Lock()
+		idx.Files[key] = entry
+		idx.Unlock()
+	})
+	return idx, firstErr
+}
+
+func (idx *mediaIndex) write(file string) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// loadIndex reads an index written by -build-index
+func loadIndex(file string) (*mediaIndex, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	idx := &mediaIndex{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, errors.New("Could not parse index " + file + ": " + err.Error())
+	}
+	return idx, nil
+}
+
+// lookup fills in mf from the index and reports whether it could.  Entries of files whose size or modification time changed since are stale and ignored
+func (idx *mediaIndex) lookup(mf *mediaFile) bool {
+	key, err := idx.indexKey(mf.Path)
+	if err != nil {
+		return false
+	}
+	idx.Lock()
+	entry, ok := idx.Files[key]
+	idx.Unlock()
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(mf.Path)
+	if err != nil || info.Size() != entry.Size || info.ModTime().UnixNano() != entry.ModTime {
+		return false
+	}
+	mf.mediaTime = mediaTime{Time: entry.Time, Zoned: entry.Zoned, Source: entry.Source, DateOnly: entry.DateOnly, Value: entry.Value}
+	mf.Comment = entry.Comment
+	switch entry.Error {
+	case "":
+	case errNoDate.Error():
+		mf.Err = errNoDate
+	default:
+		mf.Err = errors.New(entry.Error)
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndexLookupStaleness(t *testing.T) {
+	startTestWorkers.Do(func() { startWorkers(2) })
+	dir := t.TempDir()
+	file := writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	idx, err := buildIndex(dir, []*mediaFile{{Path: file}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := idx.Files["IMG_0001.jpg"]
+	if entry.Source != "DateTimeOriginal" || entry.Time.Format(exifDateLayout) != "2021:05:01 12:30:00" || len(entry.SHA256) != 64 {
+		t.Fatalf("indexed %+v", entry)
+	}
+	tests := []struct {
+		name   string
+		change func()
+		want   bool
+	}{
+		{"unchanged", func() {}, true},
+		{"touched", func() {
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(file, later, later); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"resized", func() {
+			if err := os.WriteFile(file, []byte("edited"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"removed", func() { os.Remove(file) }, false},
+	}
+	for _, test := range tests {
+		test.change()
+		mf := &mediaFile{Path: file}
+		if got := idx.lookup(mf); got != test.want {
+			t.Errorf("%s: lookup = %v, want %v", test.name, got, test.want)
+		}
+		if test.want && !mf.Time.Equal(entry.Time) {
+			t.Errorf("%s: lookup gave %v, want %v", test.name, mf.Time, entry.Time)
+		}
+	}
+}
+
+func TestBuildAndUseIndex(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	indexFile := filepath.Join(root, "index.json")
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	edited := writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	mustRunMain(t, "-build-index", indexFile, dir)
+	assertFiles(t, dir, "IMG_0001.jpg", "IMG_0002.jpg")
+
+	// an index entry differing from the file shows the index was used instead of reading it
+	idx, err := loadIndex(indexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := idx.Files["IMG_0001.jpg"]
+	entry.Time = time.Date(2019, 1, 1, 9, 0, 0, 0, time.UTC)
+	idx.Files["IMG_0001.jpg"] = entry
+	if err := idx.write(indexFile); err != nil {
+		t.Fatal(err)
+	}
+	// the edited file is stale in the index and read again
+	if err := os.WriteFile(edited, jpegWithExif(exifTiff("", "2021:05:03 10:00:00")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mustRunMain(t, "-use-index", indexFile, dir)
+	assertFiles(t, dir, "2019-01-01 09.00.00.jpg", "2021-05-03 10.00.00.jpg")
+}
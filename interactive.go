@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// renamePrompt asks before every rename with -interactive.  Workers take turns so only one question is asked at a time
+type renamePrompt struct {
+	sync.Mutex
+	in  *bufio.Reader
+	out io.Writer
+	// all is set once a rename is answered with a, every later one is done without asking
+	all bool
+	// closed is set when the input ended, every later rename is declined
+	closed bool
+}
+
+// prompt is nil unless -interactive is set
+var prompt *renamePrompt
+
+func newRenamePrompt() *renamePrompt {
+	return &renamePrompt{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+}
+
+// confirm asks whether oldPath is to be renamed to newPath, reading y (yes), n (no) or a (yes to this and all the rest).  Without -interactive every rename is confirmed
+func (p *renamePrompt) confirm(oldPath string, newPath string) bool {
+	if p == nil {
+		return true
+	}
+	p.Lock()
+	defer p.Unlock()
+	if p.all {
+		return true
+	}
+	if p.closed {
+		return false
+	}
+	oldName, newName := logNames(oldPath, newPath)
+	for {
+		fmt.Fprint(p.out, "Rename "+oldName+" to "+newName+"? [y]es, [n]o, [a]ll: ")
+		line, err := p.in.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		case "a", "all":
+			p.all = true
+			return true
+		}
+		if err != nil {
+			fmt.Fprintln(p.out)
+			p.closed = true
+			return false
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// reportRecord is what -report writes for one file
+type reportRecord struct {
+	Path    string `json:"path"`
+	OldName string `json:"oldName"`
+	NewName string `json:"newName,omitempty"`
+	NewPath string `json:"newPath,omitempty"`
+	Status  string `json:"status"`
+	Source  string `json:"source,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// jsonReport is the file -report writes
+type jsonReport struct {
+	Root    string         `json:"root"`
+	Date    string         `json:"date"`
+	Summary map[string]int `json:"summary"`
+	Files   []reportRecord `json:"files"`
+}
+
+// writeJSONReport writes every file's result as JSON for auditing.  The date source of each file is taken from mediaFiles
+func writeJSONReport(file string, root string, mediaFiles []*mediaFile) error {
+	read := make(map[string]*mediaFile)
+	for _, mf := range mediaFiles {
+		read[mf.Path] = mf
+	}
+	report := jsonReport{
+		Root:    root,
+		Date:    time.Now().Format(time.RFC3339),
+		Summary: make(map[string]int),
+		Files:   []reportRecord{},
+	}
+	for _, status := range []string{statusRenamed, statusMoved, statusLinked, statusSkipped, statusFailed} {
+		report.Summary[status] = results.count(status)
+	}
+	results.Lock()
+	for _, result := range results.Items {
+		record := reportRecord{Path: result.Path, OldName: filepath.Base(result.Path), NewPath: result.NewPath, Status: result.Status, Reason: result.Reason}
+		if result.NewPath != "" {
+			record.NewName = filepath.Base(result.NewPath)
+		}
+		if mf, ok := read[result.Path]; ok {
+			record.Source, record.Value = mf.Source, mf.Value
+		}
+		if result.Err != nil {
+			record.Error = result.Err.Error()
+		}
+		report.Files = append(report.Files, record)
+	}
+	results.Unlock()
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
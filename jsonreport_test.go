@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestJSONReport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "photos")
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "2021-05-02 08.00.00.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	writeTestFile(t, dir, "no date.jpg", jpegWithExif(exifTiff("", "")))
+	writeTestFile(t, dir, "broken.jpg", []byte("not a photo"))
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	mustRunMain(t, "-report", reportFile, dir)
+	data, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report jsonReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].OldName < report.Files[j].OldName })
+	want := []reportRecord{
+		{OldName: "2021-05-02 08.00.00.jpg", Status: statusSkipped, Reason: "already-formatted"},
+		{OldName: "IMG_0001.jpg", NewName: "2021-05-01 12.30.00.jpg", Status: statusRenamed, Source: "DateTimeOriginal", Value: "2021:05:01 12:30:00"},
+		{OldName: "broken.jpg", Status: statusFailed, Error: "Could not exif.Decode " + filepath.Join(dir, "broken.jpg") + ": EOF"},
+		{OldName: "no date.jpg", Status: statusSkipped, Reason: "no-date"},
+	}
+	if len(report.Files) != len(want) {
+		t.Fatalf("report lists %d files, want %d: %+v", len(report.Files), len(want), report.Files)
+	}
+	for i, record := range report.Files {
+		if record.Path != filepath.Join(dir, record.OldName) {
+			t.Errorf("%s: path %s", record.OldName, record.Path)
+		}
+		if record.NewName != "" && record.NewPath != filepath.Join(dir, record.NewName) {
+			t.Errorf("%s: new path %s", record.OldName, record.NewPath)
+		}
+		record.Path, record.NewPath = "", ""
+		if record != want[i] {
+			t.Errorf("record %+v, want %+v", record, want[i])
+		}
+	}
+	for status, count := range map[string]int{statusRenamed: 1, statusSkipped: 2, statusFailed: 1, statusMoved: 0} {
+		if report.Summary[status] != count {
+			t.Errorf("summary counts %d %s, want %d", report.Summary[status], status, count)
+		}
+	}
+}
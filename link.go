@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Values of -dedupe-link
+const (
+	linkSymlink  = "symlink"
+	linkHardlink = "hardlink"
+)
+
+// dedupeLink is set by -dedupe-link, duplicates with identical content are then replaced in place by a link to the kept file instead of being moved
+var dedupeLink string
+
+// linkPlan splits a dedupe plan into the groups of identical files -dedupe-link replaces by links and the rest, which are moved as usual
+func linkPlan(plan []dedupeAction) (link []dedupeAction, move []dedupeAction) {
+	for _, action := range plan {
+		if dedupeLink != "" && action.SHA256 != "" {
+			link = append(link, action)
+		} else {
+			move = append(move, action)
+		}
+	}
+	return
+}
+
+// linkInPlace replaces file with a link to target.  Symlinks are relative so the folder can be moved as a whole, a hardlink across volumes falls back to a symlink.  The link is made under a temporary name and renamed over file so file is never missing
+func linkInPlace(file string, target string) (string, error) {
+	temp := filepath.Join(filepath.Dir(file), ".mediaRenamerToTimestamp-link-"+filepath.Base(file))
+	kind := dedupeLink
+	var err error
+	if kind == linkHardlink {
+		err = os.Link(target, temp)
+		if errors.Is(err, syscall.EXDEV) {
+			log.Println("Could not hardlink " + file + " to " + target + " across volumes, linking it with a symlink")
+			kind = linkSymlink
+		}
+	}
+	if kind == linkSymlink {
+		relative, errRel := filepath.Rel(filepath.Dir(file), target)
+		if errRel != nil {
+			relative = target
+		}
+		err = os.Symlink(relative, temp)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(temp, file); err != nil {
+		os.Remove(temp)
+		return "", err
+	}
+	return kind, nil
+}
+
+// linkDuplicates replaces the duplicates of every group of a plan by links to the kept file, under the name the kept file was renamed to during the run
+func linkDuplicates(plan []dedupeAction) {
+	finalPaths := make(map[string]string)
+	results.Lock()
+	for _, result := range results.Items {
+		if result.Status == statusRenamed {
+			finalPaths[result.Path] = result.NewPath
+		}
+	}
+	results.Unlock()
+	for _, action := range plan {
+		keeper := action.Keep.Path
+		if final, ok := finalPaths[keeper]; ok {
+			keeper = final
+		}
+		for _, mf := range action.Remove {
+			result := fileResult{Path: mf.Path}
+			if linked, errStat := os.Stat(mf.Path); errStat == nil {
+				if kept, errStat := os.Stat(keeper); errStat == nil && os.SameFile(linked, kept) {
+					// hardlinked by an earlier run
+					results.add(result.skipped(reasonLink))
+					continue
+				}
+			}
+			kind, err := linkInPlace(mf.Path, keeper)
+			if err != nil {
+				err = errors.New("Could not link duplicate " + mf.Path + " to " + keeper + ": " + err.Error())
+				stdErr.Println(err.Error())
+				results.add(result.failed(err))
+				continue
+			}
+			fileLog.Println("Replaced duplicate " + mf.Path + " with a " + kind + " to " + keeper)
+			result.Status = statusLinked
+			result.Reason = reasonDuplicate
+			results.add(result)
+		}
+	}
+}
+
+// linksIntoRoot reports whether file is a symlink to a file under root, such as a duplicate -dedupe-link replaced.  Those are left alone, their target is renamed instead
+func linksIntoRoot(root string, file string) bool {
+	info, err := os.Lstat(file)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	target, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return false
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(resolvedRoot, target)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
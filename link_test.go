@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkPlan(t *testing.T) {
+	restoreAfterTest(t, &dedupeLink)
+	identical := dedupeAction{Keep: &mediaFile{Path: "a.jpg"}, SHA256: "abc"}
+	byFormat := dedupeAction{Keep: &mediaFile{Path: "b.heic"}}
+	tests := []struct {
+		mode       string
+		link, move int
+	}{
+		{"", 0, 2},
+		{linkSymlink, 1, 1},
+		{linkHardlink, 1, 1},
+	}
+	for _, test := range tests {
+		dedupeLink = test.mode
+		link, move := linkPlan([]dedupeAction{identical, byFormat})
+		if len(link) != test.link || len(move) != test.move {
+			t.Errorf("-dedupe-link %q: linkPlan = %d linked, %d moved, want %d, %d", test.mode, len(link), len(move), test.link, test.move)
+		}
+	}
+}
+
+func TestDedupeLink(t *testing.T) {
+	const kept = "2021-05-01 12.30.00.jpg"
+	for _, mode := range []string{linkSymlink, linkHardlink} {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+			writeTestFile(t, dir, "IMG_0001.jpg", photo)
+			writeTestFile(t, dir, "IMG_0001 copy.jpg", photo)
+			writeTestFile(t, dir, "trip/IMG_0001.jpg", photo)
+			// the first run renames the keeper and links the rest to its new name, the second finds nothing to do
+			for run := 0; run < 2; run++ {
+				mustRunMain(t, "-dedupe-link", mode, dir)
+				assertFiles(t, dir, kept, "IMG_0001.jpg", "trip/IMG_0001.jpg")
+				keeper, err := os.Stat(filepath.Join(dir, kept))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for duplicate, target := range map[string]string{"IMG_0001.jpg": kept, "trip/IMG_0001.jpg": "../" + kept} {
+					path := filepath.Join(dir, duplicate)
+					info, err := os.Lstat(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if mode == linkSymlink {
+						if link, err := os.Readlink(path); err != nil || link != filepath.FromSlash(target) {
+							t.Errorf("run %d: %s links to %q, %v, want %q", run+1, duplicate, link, err, target)
+						}
+						continue
+					}
+					if info.Mode()&os.ModeSymlink != 0 || !os.SameFile(info, keeper) {
+						t.Errorf("run %d: %s is not a hardlink of %s", run+1, duplicate, kept)
+					}
+				}
+			}
+		})
+	}
+}
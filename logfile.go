@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// rotatingWriter appends to a log file and, once it would grow past maxSize bytes, shifts it to path.1, path.1 to path.2 and so on, keeping maxBackups old files
+type rotatingWriter struct {
+	sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// newRotatingWriter opens path for appending, a maxSize of 0 never rotates
+func newRotatingWriter(path string, maxSize int64, maxBackups int) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+func (w *rotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if w.maxBackups == 0 {
+		if err := os.Remove(w.path); err != nil {
+			return err
+		}
+		return w.open()
+	}
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		older := w.path + "." + extensions.IntToString(i)
+		if extensions.DoesFileExist(older) {
+			if err := os.Rename(older, w.path+"."+extensions.IntToString(i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// byteSizeUnits are the suffixes parseByteSize accepts, in powers of 1024
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses sizes such as 512, 64KB or 10M
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || size < 0 {
+		return 0, errors.New("Invalid size " + value + ", use a number with an optional KB, MB, GB or TB suffix")
+	}
+	return int64(size * float64(multiplier)), nil
+}
+
+// fileLog logs the lines about single files, such as Renamed ... to ..., which only reach the console with -verbose but always go to -log-file
+var fileLog = log.New(io.Discard, "", log.LstdFlags)
+
+// setupLogging points the log at the console, logFile or both.  quiet drops the progress log from the console but keeps errors, verbose adds the lines about single files
+func setupLogging(logFile string, maxSize string, maxBackups int, quiet bool, verbose bool) error {
+	var console io.Writer = os.Stderr
+	if quiet {
+		console = io.Discard
+	}
+	fileConsole := console
+	if !verbose {
+		fileConsole = io.Discard
+	}
+	if logFile == "" {
+		log.SetOutput(console)
+		fileLog.SetOutput(fileConsole)
+		return nil
+	}
+	size := int64(0)
+	if maxSize != "" {
+		var err error
+		if size, err = parseByteSize(maxSize); err != nil {
+			return errors.New("Invalid -log-max-size: " + err.Error())
+		}
+	}
+	if maxBackups < 0 {
+		return errors.New("Invalid -log-max-backups, it can not be negative")
+	}
+	writer, err := newRotatingWriter(logFile, size, maxBackups)
+	if err != nil {
+		return errors.New("Could not open log file " + logFile + ": " + err.Error())
+	}
+	log.SetOutput(io.MultiWriter(console, writer))
+	fileLog.SetOutput(io.MultiWriter(fileConsole, writer))
+	stdErr.SetOutput(io.MultiWriter(os.Stderr, writer))
+	return nil
+}
+
+// formatByteSize renders a size with the largest unit parseByteSize accepts that keeps it at least 1, e.g. 1.5 GB
+func formatByteSize(size uint64) string {
+	for _, unit := range byteSizeUnits {
+		if len(unit.suffix) == 2 && size >= uint64(unit.multiplier) {
+			return strconv.FormatFloat(float64(size)/float64(unit.multiplier), 'f', 1, 64) + " " + unit.suffix
+		}
+	}
+	return strconv.FormatUint(size, 10) + " B"
+}
+
+// logTemplate is set by -log-template, the line logged for every renamed or moved file with {old}, {new}, {source} and {status} filled in
+var logTemplate string
+
+// logFileLine logs what happened to one file to fileLog, through -log-template when it is set and as defaultLine otherwise.  old and new are names for renames and paths for moves, source is where the date was read from if known
+func logFileLine(defaultLine string, status string, old string, new string, source string) {
+	if logTemplate == "" {
+		fileLog.Println(defaultLine)
+		return
+	}
+	fileLog.Println(strings.NewReplacer("{old}", old, "{new}", new, "{source}", source, "{status}", status).Replace(logTemplate))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.log")
+	w, err := newRotatingWriter(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.file.Close()
+	// every line pushes the log past 10 bytes, only two old files are kept
+	want := map[string]string{"run.log": "fourth\n", "run.log.1": "third\n", "run.log.2": "second\n"}
+	assertFiles(t, dir, "run.log", "run.log.1", "run.log.2")
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("%s holds %q, want %q", name, data, content)
+		}
+	}
+}
+
+func TestRotatingWriterWithoutBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.log")
+	writeTestFile(t, dir, "run.log", []byte("from an earlier run\n"))
+	w, err := newRotatingWriter(path, 25, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("new line\n")); err != nil {
+		t.Fatal(err)
+	}
+	w.file.Close()
+	assertFiles(t, dir, "run.log")
+	if data, _ := os.ReadFile(path); string(data) != "new line\n" {
+		t.Errorf("run.log holds %q, want only the new line", data)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		fail  bool
+	}{
+		{"512", 512, false},
+		{"64KB", 64 << 10, false},
+		{"10m", 10 << 20, false},
+		{"1.5 GB", 3 << 29, false},
+		{"-1", 0, true},
+		{"lots", 0, true},
+	}
+	for _, test := range tests {
+		got, err := parseByteSize(test.value)
+		if (err != nil) != test.fail || got != test.want {
+			t.Errorf("parseByteSize(%q) = %v, %v, want %v, failure %v", test.value, got, err, test.want, test.fail)
+		}
+	}
+}
+
+func TestLogFileRotates(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	logFile := filepath.Join(root, "run.log")
+	for _, name := range []string{"IMG_0001.jpg", "IMG_0002.jpg", "IMG_0003.jpg"} {
+		writeTestFile(t, dir, name, jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	}
+	output := mustRunMain(t, "-log-file", logFile, "-log-max-size", "200", "-log-max-backups", "1", dir)
+	assertFiles(t, root, "photos/2021-05-01 12.30.00-1.jpg", "photos/2021-05-01 12.30.00-2.jpg", "photos/2021-05-01 12.30.00.jpg", "run.log", "run.log.1")
+	for _, name := range []string{"run.log", "run.log.1"} {
+		info, err := os.Stat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s is %d bytes, past -log-max-size", name, info.Size())
+		}
+	}
+	// the console still gets the log
+	if !strings.Contains(output, "Completed in") {
+		t.Errorf("console output lacks the log:\n%s", output)
+	}
+}
+
+func TestLogFileLine(t *testing.T) {
+	restoreAfterTest(t, &logTemplate)
+	saved := fileLog.Writer()
+	t.Cleanup(func() { fileLog.SetOutput(saved) })
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"default", "", "Renamed IMG_0001.jpg to 2021-05-01 12.30.00.jpg"},
+		{"csv", "{status},{old},{new},{source}", "renamed,IMG_0001.jpg,2021-05-01 12.30.00.jpg,DateTimeOriginal"},
+		{"placeholders repeated and unknown kept", "{old} -> {new} ({old}, {when})", "IMG_0001.jpg -> 2021-05-01 12.30.00.jpg (IMG_0001.jpg, {when})"},
+	}
+	for _, test := range tests {
+		var logged bytes.Buffer
+		fileLog.SetOutput(&logged)
+		logTemplate = test.template
+		logFileLine("Renamed IMG_0001.jpg to 2021-05-01 12.30.00.jpg", statusRenamed, "IMG_0001.jpg", "2021-05-01 12.30.00.jpg", "DateTimeOriginal")
+		if got := strings.TrimSuffix(logged.String(), "\n"); !strings.HasSuffix(got, " "+test.want) {
+			t.Errorf("%s: logged %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLogTemplateFollowsVerbose(t *testing.T) {
+	const line = "renamed,IMG_0001.jpg,2021-05-01 12.30.00.jpg,DateTimeOriginal"
+	tests := []struct {
+		name    string
+		verbose bool
+	}{
+		{"quiet console", false},
+		{"verbose console", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			dir := filepath.Join(root, "photos")
+			logFile := filepath.Join(root, "run.log")
+			writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+			args := []string{"-log-file", logFile, "-log-template", "{status},{old},{new},{source}", dir}
+			if test.verbose {
+				args = append([]string{"-verbose"}, args...)
+			}
+			output := mustRunMain(t, args...)
+			if strings.Contains(output, line) != test.verbose {
+				t.Errorf("console shows the templated line: %v, want %v\n%s", !test.verbose, test.verbose, output)
+			}
+			if data, _ := os.ReadFile(logFile); !strings.Contains(string(data), line) {
+				t.Errorf("log file lacks %q:\n%s", line, data)
+			}
+		})
+	}
+}
+
+func TestQuietKeepsFatalErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"missing directory", []string{"-quiet", filepath.Join(dir, "missing")}, "does not exist"},
+		{"invalid option", []string{"-quiet", "-workers", "0", dir}, "-workers"},
+	}
+	for _, test := range tests {
+		output, err := runMain(t, test.args...)
+		if err == nil {
+			t.Errorf("%s: run %q succeeded", test.name, test.args)
+		}
+		if !strings.Contains(output, test.want) {
+			t.Errorf("%s: output lacks %q:\n%s", test.name, test.want, output)
+		}
+	}
+}
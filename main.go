@@ -2,13 +2,14 @@ package main
 
 import (
 	"bytes"
-	"encoding/binary"
-	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -25,7 +26,8 @@ type filesSync struct {
 	Items []string
 }
 
-func RecurseFiles(fileDir string) (files []string, err error) {
+// RecurseFiles lists the files under fileDir.  When skip is given, paths it returns true for are left out and skipped folders are not descended into
+func RecurseFiles(fileDir string, skip func(path string, f os.FileInfo) bool) (files []string, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			return
@@ -40,13 +42,24 @@ func RecurseFiles(fileDir string) (files []string, err error) {
 		return
 	}
 
-	err = filepath.Walk(path, func(path string, f os.FileInfo, errWalk error) (err error) {
+	walk := filepath.Walk
+	if followSymlinks {
+		walk = walkFollowingLinks
+	}
+	err = walk(path, func(path string, f os.FileInfo, errWalk error) (err error) {
 
 		if errWalk != nil {
 			err = errWalk
 			return
 		}
 
+		if skip != nil && skip(path, f) || excluded(fileDir, path) {
+			if f.IsDir() {
+				err = filepath.SkipDir
+			}
+			return
+		}
+
 		if !f.IsDir() {
 			wg.Add(1)
 			syncedItems.Lock()
@@ -65,14 +78,47 @@ func RecurseFiles(fileDir string) (files []string, err error) {
 
 type processJob struct {
 	Func func(string)
-	File string
-	Wg   *sync.WaitGroup
+	// Failed is told when Func panics, the worker then goes on with the next job
+	Failed func(error)
+	File   string
+	Wg     *sync.WaitGroup
 }
 
 var (
 	jobs                           chan processJob
 	fmtDesired                     string
 	attemptRenameToDifferentMinute bool // set to false if you dont want this desire
+	canonicalExtensions            map[string]string
+	displayLocation                *time.Location
+	stdErr                         = log.New(os.Stderr, "", 0)
+	errNoDate                      = errors.New("no date found")
+	requireDate                    bool
+	syncFileTimes                  bool
+)
+
+var (
+	pictureExtensions = []string{
+		"JPG", "TIF", "TIFF", "BMP", "PNG", "JPEG", "GIF", "CR2", "ARW", "HEIC", "NEF", "HEIF", "AVIF", "PSD",
+	}
+	movieExtensions = []string{
+		"MOV", "MP4", "MKV", "WEBM",
+	}
+	// audioExtensions is empty unless -audio-exts is passed so music libraries are not renamed by accident, only MP4 based audio (e.g. M4A voice memos) carries a creation time
+	audioExtensions []string
+	// sidecarExtensions are never processed as media, they are renamed along with the media file sharing their base name
+	sidecarExtensions = []string{
+		"AAE", "SRT",
+	}
+	// editorSidecarExtensions are added to sidecarExtensions by -rename-sidecars: Lightroom and other editors' XMP and camera THM thumbnails
+	editorSidecarExtensions = []string{
+		"XMP", "THM",
+	}
+	// equivalentExtensions groups extensions which are the same format so -canonical-ext can name one member of a group and have the others renamed to it
+	equivalentExtensions = [][]string{
+		{"JPG", "JPEG", "JPE"},
+		{"TIF", "TIFF"},
+		{"HEIC", "HEIF"},
+	}
 )
 
 // mov spec: https://developer.apple.com/standards/qtff-2001.pdf
@@ -87,260 +133,1200 @@ const (
 	compressedMovieAtomType = "cmov"
 )
 
+// getVideoCreationTimeMetadata reads the creation time in the mvhd header of the moov atom.  Atoms around moov, such as the moof fragments and sidx indexes of fragmented MP4 recordings, are skipped and moov may hold other atoms (e.g. mvex) before mvhd
 func getVideoCreationTimeMetadata(videoBuffer io.ReadSeeker) (time.Time, error) {
-	buf := make([]byte, 8)
+	moov, err := findAtom(videoBuffer, movieResourceAtomType)
+	if err != nil {
+		return time.Time{}, errors.New("Did not find movie resource atom (moov): " + err.Error())
+	}
 
-	// Traverse videoBuffer to find movieResourceAtom
-	for {
-		// bytes 1-4 is atom size, 5-8 is type
-		// Read atom
-		if _, err := videoBuffer.Read(buf); err != nil {
-			return time.Time{}, err
+	var header atom
+	err = readAtoms(videoBuffer, moov.Offset, moov.Offset+moov.Size, func(a atom) (bool, error) {
+		switch a.Type {
+		case movieHeaderAtomType:
+			header = a
+			return false, nil
+		case compressedMovieAtomType:
+			return false, errors.New("Compressed video")
+		case referenceMovieAtomType:
+			return false, errors.New("Reference video")
 		}
+		return true, nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if header.Type == "" {
+		return time.Time{}, errors.New("Did not find movie header atom (mvhd)")
+	}
+	// version 1 headers hold 64 bit times, 12 bytes are enough for either version
+	if header.Size > 12 {
+		header.Size = 12
+	}
+	data, err := readAtomData(videoBuffer, header, 12)
+	if err != nil {
+		return time.Time{}, err
+	}
+	appleEpoch, ok := headerCreationTime(data) // Read creation time
+	if !ok {
+		return time.Time{}, errors.New("Truncated movie header atom (mvhd)")
+	}
+
+	return time.Unix(appleEpoch-appleEpochAdjustment, 0).Local(), nil
+}
 
-		if bytes.Equal(buf[4:8], []byte(movieResourceAtomType)) {
-			break // found it!
+// parseCanonicalExtensions reads a comma separated -canonical-ext value.  Each entry is either an extension from equivalentExtensions (e.g. "jpg" renames .JPEG and .JPE files to .jpg) or an explicit "from=to" pair
+func parseCanonicalExtensions(value string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), ".")
+		if entry == "" {
+			continue
+		}
+		if from, to, ok := strings.Cut(entry, "="); ok {
+			from = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(from), "."))
+			to = strings.TrimPrefix(strings.TrimSpace(to), ".")
+			if from == "" || to == "" {
+				return nil, errors.New("Invalid -canonical-ext mapping: " + entry)
+			}
+			mapping[from] = to
+			continue
 		}
+		found := false
+		for _, group := range equivalentExtensions {
+			if utils.InArray(strings.ToUpper(entry), group) {
+				for _, ext := range group {
+					mapping[ext] = entry
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("No equivalent extensions known for " + entry + ", use from=to to map it explicitly")
+		}
+	}
+	return mapping, nil
+}
 
-		atomSize := binary.BigEndian.Uint32(buf) // check size of atom
-		videoBuffer.Seek(int64(atomSize)-8, 1)   // jump over data and set seeker at beginning of next atom
+// outputExtension returns the extension (with its dot) a file with existingExt should be renamed with
+func outputExtension(existingExt string) string {
+	if canonical, ok := canonicalExtensions[strings.ToUpper(strings.TrimPrefix(existingExt, "."))]; ok {
+		return applyExtensionCase("." + canonical)
 	}
+	return applyExtensionCase(existingExt)
+}
 
-	// read next atom
-	if _, err := videoBuffer.Read(buf); err != nil {
-		return time.Time{}, err
+// mediaTime is a capture time read from a file's metadata
+type mediaTime struct {
+	Time  time.Time
+	Zoned bool // false when the metadata only holds a wall clock reading without any zone, Time is then left in UTC
+	// Source names the metadata the time was read from, e.g. DateTimeOriginal or mvhd
+	Source string
+	// DateOnly is set when the metadata holds the day but not the time of day, Time is then midnight
+	DateOnly bool
+	// Value is the text the time was parsed from when the metadata stores it as text
+	Value string
+}
+
+// getMediaTime returns the capture time stored in the metadata of fileWork and, for pictures, the decoded Exif.  errNoDate is returned for pictures without any date Exif fields
+func getMediaTime(fileWork string) (mediaTime, *exif.Exif, error) {
+	extUpper := strings.ToUpper(strings.TrimPrefix(filepath.Ext(fileWork), "."))
+
+	// Movie files
+
+	if utils.InArray(extUpper, movieExtensions) || utils.InArray(extUpper, audioExtensions) {
+		defer traceStage(fileWork, stageDecode, time.Now())
+		if djiSRT {
+			if srt, ok := djiSRTFile(fileWork); ok {
+				if mt, err := getDJISRTTime(srt); err == nil {
+					return mt, nil, nil
+				}
+			}
+		}
+		fd, err := os.Open(fileWork)
+		if err != nil {
+			return mediaTime{}, nil, errors.New("Could not Open movie file " + fileWork + ": " + err.Error())
+		}
+		var timeInfo time.Time
+		var source string
+		if utils.InArray(extUpper, matroskaExtensions) {
+			timeInfo, err = getMatroskaCreationTime(fd)
+			source = sourceMatroska
+		} else {
+			timeInfo, source, err = getMovieTime(fd)
+			if err == nil && source == sourceTkhd {
+				fileLog.Println(fileWork + " has no usable movie header (mvhd), using the creation time of its track header (tkhd)")
+			}
+		}
+		fd.Close()
+		if err != nil {
+			return mediaTime{}, nil, errors.New("Could not Read timestamp on movie file " + fileWork + ": " + err.Error())
+		}
+		return mediaTime{Time: timeInfo, Zoned: true, Source: source}, nil, nil
 	}
 
-	atomType := string(buf[4:8]) // skip size and read type
-	switch atomType {
-	case movieHeaderAtomType:
-		// read next atom
-		if _, err := videoBuffer.Read(buf); err != nil {
-			return time.Time{}, err
+	// Picture files
+
+	if !utils.InArray(extUpper, containerExtensions) {
+		return getExifTime(fileWork, extUpper)
+	}
+	readStart := time.Now()
+	data, err := os.ReadFile(fileWork)
+	traceStage(fileWork, stageRead, readStart)
+	if err != nil {
+		return mediaTime{}, nil, errors.New("Could not ReadFile" + fileWork + ": " + err.Error())
+	}
+	defer traceStage(fileWork, stageDecode, time.Now())
+	if utils.InArray(extUpper, gifExtensions) {
+		mt, err := gifTime(data, fileWork)
+		return mt, nil, err
+	}
+	if utils.InArray(extUpper, bmpExtensions) {
+		mt, err := bmpTime(data, fileWork)
+		return mt, nil, err
+	}
+	reader := bytes.NewReader(data)
+	if utils.InArray(extUpper, heifExtensions) {
+		tiffData, err := heifExif(data)
+		if err != nil {
+			// HEIC exports which are JPEGs under the hood still decode as they are
+			if !bytes.HasPrefix(data, jpegStart) {
+				var ok bool
+				if tiffData, ok = scanExif(data); !ok {
+					return mediaTime{}, nil, errors.New("Could not find Exif in " + fileWork + ": " + err.Error())
+				}
+			}
+		}
+		if tiffData != nil {
+			reader = bytes.NewReader(tiffData)
+		}
+	}
+	if utils.InArray(extUpper, psdExtensions) {
+		tiffData, err := psdExif(data)
+		if err != nil {
+			return mediaTime{}, nil, errors.New("Could not find Exif in " + fileWork + ": " + err.Error())
 		}
+		reader = bytes.NewReader(tiffData)
+	}
+	if utils.InArray(extUpper, pngExtensions) {
+		if tiffData, ok := pngExif(data); ok {
+			reader = bytes.NewReader(tiffData)
+		}
+	}
+	mt, x, err := decodeExifTime(reader, fileWork)
+	if err != nil && utils.InArray(extUpper, pngExtensions) {
+		if textTime, ok := pngTextTime(data); ok {
+			return textTime, nil, nil
+		}
+	}
+	return mt, x, err
+}
 
-		// byte 1 is version, byte 2-4 is flags, 5-8 Creation time
-		appleEpoch := int64(binary.BigEndian.Uint32(buf[4:])) // Read creation time
+// containerExtensions are the picture formats whose Exif, if any, is found by parsing the whole file, the others are JPEG or Tiff based and decoded from the open file
+var containerExtensions = append(append(append(append(append([]string{}, gifExtensions...), bmpExtensions...), heifExtensions...), psdExtensions...), pngExtensions...)
 
-		return time.Unix(appleEpoch-appleEpochAdjustment, 0).Local(), nil
-	case compressedMovieAtomType:
-		return time.Time{}, errors.New("Compressed video")
-	case referenceMovieAtomType:
-		return time.Time{}, errors.New("Reference video")
-	default:
-		return time.Time{}, errors.New("Did not find movie header atom (mvhd)")
+// getExifTime decodes the Exif of a JPEG or Tiff based picture straight from the file, so only the blocks goexif reads are loaded instead of the whole file.  goexif still reads Tiff based files, RAW files included, to the end as their IFDs may be anywhere
+func getExifTime(fileWork string, extUpper string) (mediaTime, *exif.Exif, error) {
+	readStart := time.Now()
+	fd, err := os.Open(fileWork)
+	traceStage(fileWork, stageRead, readStart)
+	if err != nil {
+		return mediaTime{}, nil, errors.New("Could not Open " + fileWork + ": " + err.Error())
+	}
+	decodeStart := time.Now()
+	mt, x, err := decodeExifTime(fd, fileWork)
+	fd.Close()
+	traceStage(fileWork, stageDecode, decodeStart)
+	// RAW files goexif cannot read a date from still carry it in their embedded JPEG preview, only then is the whole file read
+	if err != nil && utils.InArray(extUpper, rawExtensions) {
+		if data, errRead := os.ReadFile(fileWork); errRead == nil {
+			if previewTime, previewExif, ok := embeddedJPEGTime(data, fileWork); ok {
+				return previewTime, previewExif, nil
+			}
+		}
+	}
+	return mt, x, err
+}
+
+// decodeExifTime decodes the Exif read from r and returns the capture time it holds
+func decodeExifTime(r io.Reader, fileWork string) (mediaTime, *exif.Exif, error) {
+	x, err := exif.Decode(r)
+	if err != nil {
+		return mediaTime{}, x, errors.New("Could not exif.Decode " + fileWork + ": " + err.Error())
+	}
+	x = primaryExif(x, fileWork)
+	if exifDebug {
+		log.Println(exifDebugReport(x, fileWork))
+	}
+	mt, err := exifTime(x, fileWork)
+	return mt, x, err
+}
+
+// displayTime returns the time a file is named after.  Times with a known zone are converted to -display-tz when it is set, wall clock readings are left as they are
+func displayTime(mt mediaTime) time.Time {
+	if displayLocation != nil && mt.Zoned {
+		return mt.Time.In(displayLocation)
+	}
+	return mt.Time
+}
+
+// sourceLocation is set by -source-tz, the zone camera clocks without a recorded zone were set to
+var sourceLocation *time.Location
+
+// zoneWallClock places a wall clock reading in -source-tz.  time.Date applies the zone's rules for that very date, so readings on either side of a daylight saving change get the offset in force when they were taken instead of one fixed offset
+func zoneWallClock(mt mediaTime) mediaTime {
+	if sourceLocation == nil || mt.Zoned || mt.DateOnly {
+		return mt
+	}
+	t := mt.Time
+	mt.Time = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), sourceLocation)
+	mt.Zoned = true
+	return mt
+}
+
+// captureInstant returns the moment a media time refers to.  Wall clock readings without a zone are taken as local time, the zone the camera clock was most likely set to
+func captureInstant(mt mediaTime) time.Time {
+	if mt.Zoned {
+		return mt.Time
+	}
+	t := mt.Time
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+// syncFileTime sets the access and modification times of file to its capture time when -sync-file-times is passed
+func syncFileTime(file string, mt mediaTime) {
+	if !syncFileTimes {
+		return
+	}
+	instant := captureInstant(mt)
+	if err := os.Chtimes(file, instant, instant); err != nil {
+		stdErr.Println("Could not set file times of " + file + ": " + err.Error())
+	}
+}
+
+// dirLocks holds a *sync.Mutex per folder files are renamed into
+var dirLocks sync.Map
+
+// lockDir locks dir against renames by other workers and returns the function unlocking it
+func lockDir(dir string) func() {
+	lock, _ := dirLocks.LoadOrStore(filepath.Clean(dir), &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// renameWithCollision renames fileWork to potentialName+ext inside dir and returns the new path.  When the name is taken, a -1, -2... suffix (see -collision-format) is tried up to collisionLimit
+func renameWithCollision(fileWork string, dir string, potentialName string, ext string) (string, error) {
+	// workers renaming into the same folder take turns so two of them never pick the same free name
+	unlock := lockDir(dir)
+	defer unlock()
+	for i := 0; i < collisionLimit(); i++ {
+		candidateName := potentialName
+		if i > 0 {
+			if !attemptRenameToDifferentMinute {
+				break
+			}
+			// In a case of old scanned photos, you could have exif of approx dates, so this is a colision handler if you had 15000 images in one directory with the same exif Date
+			candidateName = potentialName + collisionSuffix(i)
+		}
+		newName := filepath.Join(dir, candidateName+ext)
+		if newName == fileWork {
+			return fileWork, nil
+		}
+		if caseVariant(newName, fileWork) {
+			// on case-insensitive file systems a name differing only in case is the file itself, not a collision
+			fileLog.Println(fileWork + " and " + filepath.Base(newName) + " differ only in case, renaming through a temporary name")
+			if err := renameCaseOnly(fileWork, newName); err != nil {
+				return "", err
+			}
+			return newName, nil
+		}
+		if extensions.DoesFileExist(newName) || sidecarTargetTaken(fileWork, newName) {
+			continue
+		}
+		if err := moveFile(fileWork, newName); err != nil {
+			return "", err
+		}
+		return newName, nil
+	}
+	return "", errors.New(potentialName + ext + " already exists")
+}
+
+// sidecarTargetTaken reports whether renaming fileWork to newName would leave one of its sidecars behind because the sidecar's new name is taken
+func sidecarTargetTaken(fileWork string, newName string) bool {
+	oldBase := strings.TrimSuffix(fileWork, filepath.Ext(fileWork))
+	newBase := strings.TrimSuffix(newName, filepath.Ext(newName))
+	if oldBase == newBase {
+		return false
+	}
+	for _, ext := range sidecarExtensions {
+		for _, sidecarExt := range []string{"." + ext, "." + strings.ToLower(ext)} {
+			if extensions.DoesFileExist(oldBase+sidecarExt) && extensions.DoesFileExist(newBase+sidecarExt) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renameSidecars renames edit sidecars (e.g. the IMG_1234.AAE iOS writes next to an edited IMG_1234.HEIC) so they keep the base name of the media file they belong to
+func renameSidecars(fileWork string, newName string) {
+	oldBase := strings.TrimSuffix(fileWork, filepath.Ext(fileWork))
+	newBase := strings.TrimSuffix(newName, filepath.Ext(newName))
+	for _, ext := range sidecarExtensions {
+		for _, sidecarExt := range []string{"." + ext, "." + strings.ToLower(ext)} {
+			sidecar := oldBase + sidecarExt
+			if !extensions.DoesFileExist(sidecar) {
+				continue
+			}
+			target := newBase + sidecarExt
+			if extensions.DoesFileExist(target) {
+				stdErr.Println("Could not rename sidecar: " + sidecar + ": " + filepath.Base(target) + " already exists")
+				continue
+			}
+			if err := moveFile(sidecar, target); err != nil {
+				stdErr.Println("Could not rename sidecar: " + sidecar + ": " + err.Error())
+				continue
+			}
+			fileLog.Println("Renamed sidecar " + filepath.Base(sidecar) + " to " + filepath.Base(target))
+		}
+	}
+}
+
+// mediaFile is a file queued for renaming along with the capture time read from its metadata
+type mediaFile struct {
+	Path string
+	mediaTime
+	Err error
+	// Comment is the Exif UserComment of pictures
+	Comment string
+	// Make and Model are the Exif Make and Model of pictures, the camera {make} and {model} render
+	Make  string
+	Model string
+	// Seq is the number {seq} renders, given out in capture order
+	Seq int
+	// Country is where the GPS position of a picture is, read for -organize-by-location
+	Country string
+}
+
+func readMediaTime(mf *mediaFile) {
+	var x *exif.Exif
+	mf.mediaTime, x, mf.Err = getMediaTime(mf.Path)
+	if x != nil {
+		mf.Comment = userComment(x)
+		mf.Make, mf.Model = exifText(x, exif.Make), exifText(x, exif.Model)
+		if locationRoot != "" {
+			mf.Country = exifCountry(x)
+		}
+	}
+}
+
+// targetName returns the name (without extension) and extension a media file should have
+func targetName(mf *mediaFile) (string, string) {
+	return renderName(mediaFormat(mf), displayTime(mf.mediaTime), mf), outputExtension(filepath.Ext(mf.Path))
+}
+
+// needsRename reports whether a media file with a capture time is not named after it yet
+func needsRename(mf *mediaFile) bool {
+	if mf.Err != nil {
+		return false
+	}
+	existingExt := filepath.Ext(mf.Path)
+	potentialName, ext := targetName(mf)
+	fileName := strings.TrimSuffix(filepath.Base(mf.Path), existingExt)
+	// a collision suffix an earlier run gave is kept as long as the name before it is still right, so repeated runs do not pile up suffixes
+	if trimmed, ok := trimCollisionSuffix(fileName); ok && trimmed == potentialName {
+		fileName = trimmed
+	}
+	return fileName != potentialName || ext != existingExt || targetDir(mf) != filepath.Dir(mf.Path)
+}
+
+// processFile renames one media file after its capture time and reports what was done
+func processFile(mf *mediaFile) fileResult {
+	fileWork := mf.Path
+	result := fileResult{Path: fileWork}
+	if mf.Err != nil {
+		if mf.Err == errNoDate && !requireDate {
+			return result.skipped(reasonNoDate)
+		}
+		if mf.Err == errNoDate {
+			err := errors.New("Could not find a date in " + fileWork)
+			stdErr.Println(err.Error())
+			return result.failed(err)
+		}
+		stdErr.Println(mf.Err.Error())
+		return result.failed(mf.Err)
+	}
+
+	if !needsRename(mf) {
+		syncFileTime(fileWork, mf.mediaTime)
+		return result.skipped(reasonFormatted)
+	}
+	potentialName, ext := targetName(mf)
+	dir := targetDir(mf)
+	if first := filepath.Join(dir, potentialName+ext); !results.producedInRun(first) {
+		if reason := existingTargetSkip(fileWork, first); reason != "" {
+			fileLog.Println("Skipping " + filepath.Base(fileWork) + ", " + filepath.Base(first) + " already exists")
+			return result.skipped(reason)
+		}
+	}
+	if !prompt.confirm(fileWork, filepath.Join(dir, potentialName+ext)) {
+		return result.skipped(reasonDeclined)
+	}
+	renameStart := time.Now()
+	err := os.MkdirAll(dir, 0755)
+	newName := ""
+	if err == nil {
+		newName, err = renameWithCollision(fileWork, dir, potentialName, ext)
+	}
+	traceStage(fileWork, stageRename, renameStart)
+	if err != nil {
+		stdErr.Println("Could not rename: " + fileWork + ": " + err.Error())
+		return result.failed(err)
+	}
+	if newName == fileWork {
+		syncFileTime(fileWork, mf.mediaTime)
+		return result.skipped(reasonFormatted)
 	}
+	oldLogName, newLogName := logNames(fileWork, newName)
+	logFileLine("Renamed "+oldLogName+" to "+newLogName, statusRenamed, oldLogName, newLogName, mf.Source)
+	syncFileTime(newName, mf.mediaTime)
+	renameSidecars(fileWork, newName)
+	result.NewPath = newName
+	result.Status = statusRenamed
+	return result
+}
+
+// runJobs hands every media file to the worker pool and waits until fn has run for all of them
+func runJobs(mediaFiles []*mediaFile, fn func(*mediaFile)) {
+	var wg sync.WaitGroup
+	wg.Add(len(mediaFiles))
+	go func() {
+		for _, mf := range mediaFiles {
+			mf := mf
+			jobs <- processJob{
+				Wg:   &wg,
+				File: mf.Path,
+				Func: func(string) {
+					fn(mf)
+				},
+				Failed: func(err error) {
+					mf.Err = err
+				},
+			}
+		}
+	}()
+	wg.Wait()
 }
 
 func init() {
 	attemptRenameToDifferentMinute = true
-	numConcurrent := 100
 	jobs = make(chan processJob)
+}
+
+// startWorkers starts the pool of workers runJobs hands media files to
+func startWorkers(numConcurrent int) {
 	for i := 0; i < numConcurrent; i++ {
 		go worker(i)
 	}
 }
 
 func worker(idx int) {
+	for job := range jobs {
+		runJob(job)
+	}
+}
+
+// runJob runs one job and marks it done.  A panic, such as a parser tripping over a malformed file, is logged and fails the job instead of ending the worker and leaving runJobs waiting forever
+func runJob(job processJob) {
+	defer job.Wg.Done()
 	defer func() {
 		if r := recover(); r != nil {
-			return
+			err := errors.New("Could not process " + job.File + ": panic: " + fmt.Sprint(r))
+			stdErr.Println(err.Error())
+			if job.Failed != nil {
+				job.Failed(err)
+			}
 		}
 	}()
-
-	for job := range jobs {
-		job.Func(job.File)
-		job.Wg.Done()
-	}
+	job.Func(job.File)
 }
 
 func main() {
-	potentialPath := os.Args[1]
-	if len(os.Args) == 3 {
-		fmtDesired = os.Args[2]
-	} else {
+	canonicalExt := flag.String("canonical-ext", "", "Comma separated extensions to normalize equivalent extensions to on rename, e.g. jpg,tiff renames .JPEG to .jpg and .TIF to .tiff.  Explicit from=to pairs are also accepted")
+	preferFormat := flag.String("prefer-format", "", "Comma separated format priority, e.g. heic,jpg.  Files in the same directory sharing a name and capture time but differing in extension keep only the most preferred one, the others are moved to a "+duplicatesDirName+" folder")
+	displayTZ := flag.String("display-tz", "", "IANA time zone, e.g. America/New_York, every capture time with a known zone (videos, photos with offset Exif tags) is converted to before naming")
+	reportSkippedReasons := flag.Bool("report-skipped-reasons", false, "After the summary, count skipped files by the reason they were skipped")
+	repair := flag.Bool("repair", false, "Only rename files whose names are a date followed by a chain of collision suffixes (e.g. -1-1-1) left by repeated runs, back to the name their metadata gives")
+	trust := flag.String("trust", "exif", "Which photo time wins when several are recorded: exif for the camera clock, gps-time for the UTC time of the GPS fix (for cameras whose clock is never set)")
+	flag.StringVar(&imageTemplate, "image-template", "", "Naming format for pictures, defaults to the format argument")
+	flag.StringVar(&videoTemplate, "video-template", "", "Naming format for videos, e.g. VID_20060102_150405, defaults to the format argument")
+	flag.StringVar(&audioTemplate, "audio-template", "", "Naming format for audio files, defaults to the format argument")
+	pictureExts := flag.String("picture-exts", strings.Join(pictureExtensions, ","), "Comma separated picture extensions to process, replacing the defaults, e.g. jpg,dng,raf")
+	movieExts := flag.String("movie-exts", strings.Join(movieExtensions, ","), "Comma separated movie extensions to process, replacing the defaults, e.g. mov,mp4")
+	audioExts := flag.String("audio-exts", "", "Comma separated audio extensions to process, e.g. m4a.  Only MP4 based audio is supported")
+	flag.BoolVar(&exifDebug, "exif-debug", false, "Print every Exif field of each picture as read by the typed accessors and after the JSON round trip the date fallback uses, flagging fields which differ")
+	backup := flag.Bool("backup", false, "Copy the directory to a sibling \"<directory>"+backupDirSuffix+"\" folder before renaming.  The backup is removed when the media file counts still match after the run and kept otherwise")
+	noBackup := flag.Bool("no-backup", false, "Never copy the directory before renaming, not even for -canonical, and skip the file count check after the run")
+	flag.StringVar(&backupLocation, "backup-dir", "", "Folder to copy the directory to before renaming, e.g. on a larger or faster drive, instead of the sibling \"<directory>"+backupDirSuffix+"\" folder.  Implies -backup")
+	backupProcessedOnly := flag.Bool("backup-processed-only", false, "With -backup, only copy the files which are going to be renamed instead of the whole directory")
+	flag.BoolVar(&requireDate, "require-date", false, "Treat media files without an extractable date as failures instead of skipping them, exiting with status 1 when any are found")
+	flag.BoolVar(&syncFileTimes, "sync-file-times", false, "Set the modification and access times of every media file with a date to its capture time, so file managers sorting by date agree with the names")
+	atomic := flag.Bool("atomic", false, "Rename all or nothing: every file is first moved to a temporary name and only once all of them are moved and no final name is taken are they given their final names.  Any failure puts every file back under its original name")
+	flag.BoolVar(&summaryOnMismatch, "summary-on-mismatch", false, "With -backup, when the media file counts do not match after the run, list which backed up files are missing from the directory and which files in it are not in the backup")
+	restoreOnMismatch := flag.Bool("restore-on-mismatch", false, "With -backup, when the media file counts do not match after the run, undo it by restoring the renamed files from the backup")
+	flag.StringVar(&quarantineDir, "quarantine-dir", "", "Folder to move media files that fail or have no date into, keeping their path relative to the processed directory, so only renamed files are left behind")
+	emitPlan := flag.String("emit-plan", "", "Write every rename, move and skip the run would do as JSON to this file and exit without changing anything")
+	undo := flag.String("undo", "", "Rename every file listed in a rename manifest (the "+renameManifestName+" -backup writes) back to its old name instead of scanning a directory.  Files changed since are reported")
+	applyPlan := flag.String("apply-plan", "", "Execute a plan written by -emit-plan instead of scanning a directory.  Operations whose source is gone or whose target is taken fail and are left alone")
+	logFile := flag.String("log-file", "", "Also write the log to this file")
+	logMaxSize := flag.String("log-max-size", "", "With -log-file, rotate the file once it would grow past this size, e.g. 10MB")
+	logMaxBackups := flag.Int("log-max-backups", 3, "With -log-max-size, how many rotated log files (<file>.1, <file>.2...) to keep")
+	quiet := flag.Bool("quiet", false, "Do not print progress to the console, errors are still printed")
+	verbose := flag.Bool("verbose", false, "Also print a line for every file renamed, moved or skipped to the console, they are always written to -log-file")
+	flag.IntVar(&progressEvery, "progress-every", 100, "Log how many media files were processed out of the total, with an estimate of the time left, every this many files.  0 turns it off")
+	flag.BoolVar(&goproMetadata, "gopro", false, "When a video's mvhd creation time is missing or implausible (before 2005 or in the future), use the GPS time GoPro cameras store in the GPMF udta metadata")
+	flag.BoolVar(&skipIfExists, "skip-if-exists", false, "Skip a file instead of numbering it when the name it would get belongs to a file which was there before the run, for incremental imports into a library")
+	flag.BoolVar(&skipIfTargetLarger, "skip-if-target-larger", false, "Like -skip-if-exists but only skip when the existing file is at least as large as the new one")
+	flag.StringVar(&devicePrefix, "device-prefix", "", "Text put in front of every new name, e.g. phoneA_, so files from several devices merged into one library stay apart")
+	buildIndexFile := flag.String("build-index", "", "Read the capture time and sha256 of every media file once, save them to this file and exit without renaming")
+	useIndex := flag.String("use-index", "", "Take capture times from an index written by -build-index instead of reading the files again.  Files whose size or modification time changed are read again")
+	minFree := flag.String("min-free", "0", "With -backup, space to leave free on the backup volume, e.g. 5GB.  The run stops before copying anything when the backup would not fit with this margin")
+	flag.StringVar(&sequenceState, "sequence-state", "", "File keeping the last {seq} number used so the next run continues counting from it.  It is locked while a run uses it")
+	force := flag.Bool("force", false, "Read the metadata of files which are already named like a date too and rename those whose name does not match it")
+	flag.StringVar(&logTemplate, "log-template", "", "Line logged for every renamed or moved file, with {old} and {new} (names, or paths for moves), {source} (where the date was read from) and {status} filled in, e.g. \"{status},{old},{new},{source}\".  Defaults to the usual Renamed ... to ... lines, like them it reaches the console only with -verbose")
+	flag.BoolVar(&djiSRT, "dji-srt", false, "Name videos with a .SRT subtitle file next to them, as DJI drones write, after the first timestamp in it.  It holds the local recording time where the clip's mvhd is often UTC")
+	flag.BoolVar(&explain, "explain", false, "Log why every file was renamed, skipped, moved or failed: where its date was read from, the raw value, the name it was due and what happened to that name")
+	tz := flag.String("tz", "", "IANA time zone, e.g. America/New_York, to name every file in: photo times without a recorded zone are taken as local time there and video and zoned photo times are converted to it.  Short for -source-tz and -display-tz with the same zone")
+	sourceTZ := flag.String("source-tz", "", "IANA time zone, e.g. Europe/Berlin, the camera clock was set to.  Photo times without a recorded zone are taken as local time there, with the daylight saving rules of their date, so -display-tz converts them too")
+	renormalizeTZ := flag.Bool("renormalize-tz", false, "With -display-tz, rename already named files whose capture time has a known zone to that time in the display zone, for libraries named in different zones over the years.  Implies -force")
+	dateSourceReport := flag.Bool("date-source-report", false, "After reading the metadata, count files by where their date came from, e.g. DateTimeOriginal, GPS or mvhd")
+	flag.StringVar(&dateOnlyFormat, "date-only-format", "", "Naming format for files whose metadata holds only a day, e.g. 2006-01-02, so they are not mistaken for photos taken at midnight.  By default they use the format argument")
+	flag.StringVar(&collisionFormat, "collision-format", collisionFormat, "Suffix given to files bound for a taken name, a fmt verb for the number such as _%03d for _001, _002... which sort properly past 9.  A zero padded width also limits how many files can share a name")
+	flag.StringVar(&dateOnlyCollision, "date-only-collision", "", "How files whose metadata holds only a day and collide at midnight are named: spread gives them consecutive seconds 00.00.00, 00.00.01... in capture order, by default they get -1, -2... suffixes")
+	safeCharset := flag.String("safe-charset", "", "Only use characters the target file systems all accept in names: ntfs, exfat, portable (A-Z a-z 0-9 . _ -) or custom:<chars> for ASCII letters and digits plus chars.  Others are replaced by -safe-substitute")
+	flag.StringVar(&safeSubstitute, "safe-substitute", safeSubstitute, "With -safe-charset, what replaces characters the charset does not allow, may be empty to drop them")
+	flag.BoolVar(&includeBackups, "include-backups", false, "Also rename the files in \"<directory>"+backupDirSuffix+"\" and \"<directory>"+failedRunDirSuffix+"\" folders, which are otherwise skipped, or in the backup the path points at")
+	flag.BoolVar(&asciiSafe, "ascii-safe", false, "Spell the text {dir}, {comment}, {make} and {model} put in names in ASCII, e.g. Zürich as Zurich, for file systems and sync tools which choke on other characters.  The time is left as it is")
+	flag.StringVar(&untransliterable, "on-untransliterable", untransliterable, "With -ascii-safe, what becomes of characters without an ASCII spelling such as emoji: strip drops them, replace puts _ in their place")
+	flag.IntVar(&maxErrorDetails, "max-error-details", maxErrorDetails, "How many failures keep their full error for the end of run reports, later ones are only counted by kind")
+	pick := flag.String("pick", "preferred", "Which of several recorded times a file is named after: preferred takes them in a fixed order (DateTimeOriginal, DateTimeDigitized, DateTime), earliest takes the earliest plausible of all Exif dates, the GPS time and for videos the mvhd and GoPro times, as editors update the later ones when saving")
+	preflight := flag.Bool("preflight", false, "Only check the path, naming formats, extension lists, locks and, with -backup, the room for the backup, then exit 0 when all is well or 1 listing every problem found.  Nothing is read or changed")
+	canonical := flag.Bool("canonical", false, "Organize the directory in one pass: back it up once, move files with identical content (then, with -prefer-format, less preferred formats) to "+duplicatesDirName+", and rename the rest after their capture time into YYYY/MM folders under the directory, all or nothing as with -atomic")
+	organizeByLocation := flag.Bool("organize-by-location", false, "Rename files into a folder under the directory named after the country of their GPS position, "+unknownLocation+" for files without one.  Countries are looked up offline in a table of bounding boxes")
+	workers := flag.Int("workers", runtime.NumCPU(), "How many files are read and renamed at the same time")
+	flag.BoolVar(&bmpModTime, "bmp-mtime", false, "Name BMP images, which hold no metadata, after their file modification time instead of skipping them as having no date")
+	renameEditorSidecars := flag.Bool("rename-sidecars", false, "Also rename .XMP sidecars (Lightroom, darktable...) and .THM thumbnails along with the media file sharing their base name, like .AAE and .SRT files")
+	flag.StringVar(&dedupeLink, "dedupe-link", "", "Replace files with identical content (same capture time, size and sha256) anywhere under the directory by a link to the one kept, the first by path: symlink or hardlink.  The links point at the kept file's new name")
+	traceFile := flag.String("trace", "", "Write how long reading, decoding and renaming took for every file to this CSV file, slowest first, to find the files dominating a run")
+	preset := flag.String("preset", "", "Use a named naming format instead of passing one: "+presetUsage())
+	since := flag.String("since", "", "Only rename files taken at or after this time: RFC 3339, the naming format or a day such as 2021-01-01.  Other files are skipped as out of range")
+	until := flag.String("until", "", "Only rename files taken at or before this time, like -since.  A day reaches to its end")
+	flag.Var(&excludePatterns, "exclude", "Leave files and folders matching a glob alone, they are neither renamed nor backed up.  The glob is matched against the path relative to the directory and, without a slash, against the name alone.  May be given more than once")
+	flag.BoolVar(&followSymlinks, "follow-symlinks", false, "Descend into symlinked folders and rename symlinks to files outside the directory, which are otherwise skipped.  Every folder is walked once however many links lead to it, so links pointing back up the tree do not loop")
+	lowercaseExt := flag.Bool("lowercase-ext", false, "Give every renamed file a lower case extension, e.g. .jpg for .JPG, so files from different cameras are consistent.  Files already named are renamed if their extension is not lower case yet")
+	uppercaseExt := flag.Bool("uppercase-ext", false, "Give every renamed file an upper case extension, e.g. .JPG for .jpg, like -lowercase-ext")
+	flag.BoolVar(&parseFilenameDates, "parse-filename-date", false, "Name media files whose metadata holds no date after a date in their name, e.g. IMG-20210501-WA0001.jpg or Screenshot_20210501_123000.png.  Files without one are skipped as usual")
+	filenameDateRegex := flag.String("filename-date-regex", "", "With -parse-filename-date, a regular expression tried before the built in ones, with named groups year, month and day and optionally hour, minute and second, e.g. \"PXL_(?P<year>\\d{4})(?P<month>\\d{2})(?P<day>\\d{2})\"")
+	interactive := flag.Bool("interactive", false, "Ask before every rename, showing the old and new name: y renames the file, n leaves it alone and a renames it and every later file without asking.  Files are declined once the input ends")
+	flatten := flag.Bool("flatten", false, "Rename the media files of every subfolder into the directory itself, so the whole library ends up in one folder sorted by name.  Names taken in the directory get collision suffixes as usual")
+	strict := flag.Bool("strict", false, "Exit with status 1 when any file failed or, with -backup, the media file counts do not match after the run, so scripts notice")
+	datePriority := flag.String("date-priority", "", "Comma separated order in which the Exif date tags are tried, e.g. DateTimeDigitized,DateTimeOriginal for scanners.  Tags left out are not used, CreateDate and ModifyDate are accepted for DateTimeDigitized and DateTime.  Defaults to DateTimeOriginal,DateTimeDigitized,DateTime")
+	tree := flag.String("tree", "", "Rename files into dated folders under the directory, e.g. %Y/%Y-%m for 2021/2021-05/2021-05-01 12.30.00.jpg.  Tokens: %Y year, %y two digit year, %m month, %d day, %H hour, %B month name, %b short month name, %j day of the year")
+	moveTo := flag.String("move-to", "", "Rename files into the dated folders of -tree under this folder instead of the directory, "+defaultTree+" when -tree is not given")
+	flag.BoolVar(&verifyBackup, "verify-backup", false, "With -backup, hash every copied file and its source with sha256 and stop the run before renaming anything when a copy differs")
+	keepOriginalName := flag.Bool("keep-original-name", false, "Keep the name a file had before it was renamed in parentheses after the new one, e.g. 2021-05-01 12.30.00 (IMG_1234).jpg.  Same as ending every naming format with \" ({original})\"")
+	jsonReportFile := flag.String("report", "", "After the run, write every file's path, old and new name, date source, status, skip reason and error to this JSON file")
+	htmlReport := flag.String("html-report", "", "After the run, write the summary and a table of every file (original name, new name, date source, status) to this HTML file")
+	dedupe := flag.Bool("dedupe", false, "Move files with identical content (same size and sha256, and same capture time when one is read) anywhere under the directory to a "+duplicatesDirName+" folder, keeping the first by path, before renaming.  Logs the space the duplicates take")
+	verify := flag.Bool("verify", false, "Rename nothing, read every media file again and report those whose name does not match the capture time in their metadata.  Exits with status 1 when any does not")
+	dedupeReport := flag.String("dedupe-report", "", "Hash the media files, write every group of files with identical content to this CSV file (group, sha256, keep or duplicate, size, path) and exit without moving anything")
+	dedupeDryRun := flag.Bool("dedupe-dry-run", false, "With -prefer-format, -dedupe, -dedupe-link or -canonical, only list which files deduping would keep and move and why, then exit without changing anything")
+	flag.Parse()
+	if err := setupLogging(*logFile, *logMaxSize, *logMaxBackups, *quiet, *verbose); err != nil {
+		stdErr.Fatal(err.Error())
+	}
+	if *applyPlan != "" {
+		startApply := time.Now()
+		operations, err := readRenamePlan(*applyPlan)
+		if err != nil {
+			stdErr.Fatal(err.Error())
+		}
+		log.Println("Applying " + extensions.IntToString(len(operations.Operations)) + " operations planned for " + operations.Root)
+		applyRenamePlan(operations)
+		log.Println(results.summary())
+		if overflow := results.errorOverflow(); overflow != "" {
+			log.Println(overflow)
+		}
+		log.Println(logger.TimeTrack(startApply, "Completed in"))
+		return
+	}
+	if *undo != "" {
+		startUndo := time.Now()
+		manifest, err := readRenameManifest(*undo)
+		if err != nil {
+			stdErr.Fatal(err.Error())
+		}
+		log.Println("Undoing " + extensions.IntToString(len(manifest.Entries)) + " renames and moves in " + manifest.Root)
+		undoRenames(manifest)
+		log.Println(results.summary())
+		log.Println(logger.TimeTrack(startUndo, "Completed in"))
+		return
+	}
+	if flag.NArg() < 1 {
+		stdErr.Fatal("Please pass your media directory to process")
+	}
+	potentialPath := flag.Arg(0)
+	switch {
+	case *preset != "" && flag.NArg() == 2:
+		stdErr.Fatal("Pass either -preset or a format argument, not both")
+	case *preset != "":
+		layout, ok := presetLayout(*preset)
+		if !ok {
+			stdErr.Fatal("Unknown -preset " + *preset + ", use one of " + presetNames())
+		}
+		fmtDesired = layout
+	case flag.NArg() == 2:
+		fmtDesired = flag.Arg(1)
+	default:
 		fmtDesired = "2006-01-02 15.04.05"
 	}
 	startEntireProcess := time.Now()
-	stdErr := log.New(os.Stderr, "", 0)
-	if len(os.Args) < 2 {
-		log.Fatal("Please pass your MP3 directory to process")
-	}
 	var directoryToIterate string
-	var processJobs []processJob
-	var wg sync.WaitGroup
+	var mediaFiles []*mediaFile
+
+	if *keepOriginalName {
+		fmtDesired = withOriginalName(fmtDesired)
+		imageTemplate = withOriginalName(imageTemplate)
+		videoTemplate = withOriginalName(videoTemplate)
+		audioTemplate = withOriginalName(audioTemplate)
+		dateOnlyFormat = withOriginalName(dateOnlyFormat)
+	}
+
+	// option problems are collected so they are all reported at once
+	var problems []string
+	var err error
+	canonicalExtensions, err = parseCanonicalExtensions(*canonicalExt)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if sequenceState != "" && !usesSequence() {
+		problems = append(problems, "-sequence-state needs {seq} in the naming format")
+	}
+	preferredFormats = parseExtensionList(*preferFormat)
+	if *dedupeDryRun && len(preferredFormats) == 0 && !*canonical {
+		problems = append(problems, "-dedupe-dry-run needs -prefer-format")
+	}
+	if *renameEditorSidecars {
+		sidecarExtensions = append(sidecarExtensions, editorSidecarExtensions...)
+	}
+	pictureExtensions = parseExtensionList(*pictureExts)
+	movieExtensions = parseExtensionList(*movieExts)
+	audioExtensions = parseExtensionList(*audioExts)
+	if minFreeBytes, err = parseByteSize(*minFree); err != nil {
+		problems = append(problems, "Invalid -min-free: "+err.Error())
+	}
+	if safeCharAllowed, err = parseSafeCharset(*safeCharset); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, r := range safeSubstitute {
+		if safeCharAllowed != nil && !safeCharAllowed(r) || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			problems = append(problems, "Invalid -safe-substitute "+safeSubstitute+", it can not hold letters, digits or characters -safe-charset does not allow")
+			break
+		}
+	}
+	if devicePrefix != sanitizeNameComponent(devicePrefix) {
+		problems = append(problems, "Invalid -device-prefix "+devicePrefix+", it can not hold path separators, characters unsafe in file names or leading and trailing spaces")
+	}
+	if dateOnlyCollision != "" && dateOnlyCollision != "spread" {
+		problems = append(problems, "Invalid -date-only-collision "+dateOnlyCollision+", use spread")
+	}
+	if untransliterable != untransliterableStrip && untransliterable != untransliterableReplace {
+		problems = append(problems, "Invalid -on-untransliterable "+untransliterable+", use strip or replace")
+	}
+	switch *pick {
+	case "preferred":
+	case "earliest":
+		pickEarliest = true
+	default:
+		problems = append(problems, "Invalid -pick "+*pick+", use preferred or earliest")
+	}
+	switch *trust {
+	case "exif":
+	case "gps-time":
+		trustGPSTime = true
+	default:
+		problems = append(problems, "Invalid -trust "+*trust+", use exif or gps-time")
+	}
+	if dedupeLink != "" && dedupeLink != linkSymlink && dedupeLink != linkHardlink {
+		problems = append(problems, "Invalid -dedupe-link "+dedupeLink+", use symlink or hardlink")
+	}
+	if dedupeLink != "" && *emitPlan != "" {
+		problems = append(problems, "-dedupe-link can not be combined with -emit-plan, plans only move duplicates")
+	}
+	if err := checkCollisionFormat(collisionFormat); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		trailingSuffixRegexp, suffixChainRegexp = compileCollisionRegexps()
+	}
+	if *workers < 1 {
+		problems = append(problems, "Invalid -workers "+extensions.IntToString(*workers)+", at least 1 is needed")
+	}
+	if *since != "" {
+		if sinceTime, err = parseRangeBound(*since, false); err != nil {
+			problems = append(problems, "Invalid -since "+*since+": "+err.Error())
+		}
+	}
+	if *until != "" {
+		if untilTime, err = parseRangeBound(*until, true); err != nil {
+			problems = append(problems, "Invalid -until "+*until+": "+err.Error())
+		}
+	}
+	if !sinceTime.IsZero() && !untilTime.IsZero() && untilTime.Before(sinceTime) {
+		problems = append(problems, "-until is before -since, no file would be renamed")
+	}
+	if *organizeByLocation && *useIndex != "" {
+		problems = append(problems, "-organize-by-location can not be combined with -use-index, the index holds no GPS positions")
+	}
+	if *filenameDateRegex != "" {
+		if !parseFilenameDates {
+			problems = append(problems, "-filename-date-regex needs -parse-filename-date")
+		} else if err := addFilenameDateRegex(*filenameDateRegex); err != nil {
+			problems = append(problems, "Invalid -filename-date-regex "+*filenameDateRegex+": "+err.Error())
+		}
+	}
+	if *datePriority != "" {
+		if err := setDatePriority(*datePriority); err != nil {
+			problems = append(problems, "Invalid -date-priority "+*datePriority+": "+err.Error())
+		}
+	}
+	if *lowercaseExt && *uppercaseExt {
+		problems = append(problems, "-lowercase-ext can not be combined with -uppercase-ext")
+	} else if *lowercaseExt {
+		extensionCase = extensionLower
+	} else if *uppercaseExt {
+		extensionCase = extensionUpper
+	}
+	if *canonical {
+		if *repair {
+			problems = append(problems, "-canonical can not be combined with -repair")
+		}
+		*backup = true
+		*atomic = true
+	}
+	if *moveTo != "" && *tree == "" {
+		*tree = defaultTree
+	}
+	if *tree != "" {
+		if err := checkTree(*tree); err != nil {
+			problems = append(problems, "Invalid -tree "+*tree+": "+err.Error())
+		}
+		groupTree = *tree
+		if *flatten {
+			problems = append(problems, "-tree and -move-to can not be combined with -flatten")
+		}
+		if *moveTo != "" && *organizeByLocation {
+			problems = append(problems, "-move-to can not be combined with -organize-by-location, the country folders are made under the directory")
+		}
+	}
+	if *flatten && (*canonical || *organizeByLocation) {
+		problems = append(problems, "-flatten can not be combined with -canonical or -organize-by-location, they rename files into subfolders")
+	}
+	if *interactive {
+		if *atomic {
+			problems = append(problems, "-interactive can not be combined with -atomic or -canonical, their renames are planned all at once")
+		}
+		prompt = newRenamePrompt()
+	}
+	if backupLocation != "" {
+		*backup = true
+	}
+	if *noBackup {
+		if *backup && (!*canonical || backupLocation != "") {
+			problems = append(problems, "-no-backup can not be combined with -backup or -backup-dir")
+		}
+		*backup = false
+	}
+	if verifyBackup && !*backup {
+		problems = append(problems, "-verify-backup needs -backup or -backup-dir")
+	}
+	if *tz != "" {
+		if *sourceTZ != "" && *sourceTZ != *tz || *displayTZ != "" && *displayTZ != *tz {
+			problems = append(problems, "-tz sets -source-tz and -display-tz, they can not name other zones")
+		}
+		if _, err := time.LoadLocation(*tz); err != nil {
+			problems = append(problems, "Invalid -tz: "+err.Error())
+		} else {
+			*sourceTZ, *displayTZ = *tz, *tz
+		}
+	}
+	if *renormalizeTZ {
+		if *displayTZ == "" {
+			problems = append(problems, "-renormalize-tz needs -display-tz")
+		}
+		*force = true
+	}
+	if *sourceTZ != "" {
+		sourceLocation, err = time.LoadLocation(*sourceTZ)
+		if err != nil {
+			problems = append(problems, "Invalid -source-tz: "+err.Error())
+		}
+	}
+	if *displayTZ != "" {
+		displayLocation, err = time.LoadLocation(*displayTZ)
+		if err != nil {
+			problems = append(problems, "Invalid -display-tz: "+err.Error())
+		}
+	}
 
+	directoryToIterate = potentialPath
 	lastByte := potentialPath[len(potentialPath)-1:]
 	if lastByte != "\\" && path.IsWindows {
 		directoryToIterate = potentialPath + "\\"
-	} else if lastByte != "/" {
+	} else if lastByte != "/" && !path.IsWindows {
 		directoryToIterate = potentialPath + "/"
 	}
 
 	if path.IsWindows && strings.Index(directoryToIterate, "\\\\") != -1 {
-		log.Fatal("Please only escape your directory path once with \\")
+		problems = append(problems, "Please only escape your directory path once with \\")
 	}
 
-	if extensions.DoesFileExist(directoryToIterate) == false {
-		log.Fatal("Path does not exist or is invalid")
+	pathExists := extensions.DoesFileExist(directoryToIterate)
+	if !pathExists {
+		problems = append(problems, "Path does not exist or is invalid")
+	}
+	if backupLocation != "" && pathExists && insideDir(directoryToIterate, backupLocation) {
+		problems = append(problems, "-backup-dir "+backupLocation+" can not be inside "+directoryToIterate+", the backup would be copied into itself")
 	}
-	pictureExtensions := []string{
-		"JPG", "TIF", "BMP", "PNG", "JPEG", "GIF", "CR2", "ARW", "HEIC", "NEF",
+	if isBackupDir(directoryToIterate) && !includeBackups {
+		problems = append(problems, directoryToIterate+" is a backup, pass -include-backups to rename the files in it")
 	}
-	movieExtensions := []string{
-		"MOV", "MP4",
+	if *preflight {
+		problems = append(problems, formatProblems()...)
+		problems = append(problems, extensionProblems()...)
+		problems = append(problems, lockProblems()...)
+		if *backup && pathExists {
+			problems = append(problems, backupProblems(directoryToIterate, *backupProcessedOnly)...)
+		}
+		if len(problems) > 0 {
+			stdErr.Println(preflightReport(problems))
+			os.Exit(1)
+		}
+		log.Println(preflightReport(problems))
+		return
+	}
+	if len(problems) > 0 {
+		stdErr.Fatal(strings.Join(problems, "\n"))
+	}
+	if *canonical || *tree != "" {
+		groupRoot = filepath.Clean(directoryToIterate)
+	}
+	if *moveTo != "" {
+		groupRoot = filepath.Clean(*moveTo)
+	}
+	if *organizeByLocation {
+		locationRoot = filepath.Clean(directoryToIterate)
+	}
+	if *flatten {
+		flattenRoot = filepath.Clean(directoryToIterate)
+	}
+	if *traceFile != "" {
+		tracing = &fileTrace{}
+	}
+	identicalDedupe := *canonical || *dedupe || dedupeLink != ""
+	startWorkers(*workers)
+	duplicatesDir := filepath.Join(directoryToIterate, duplicatesDirName) + string(filepath.Separator)
+	ignores := newIgnoreMatcher(directoryToIterate)
+	files, _ := RecurseFiles(directoryToIterate, func(path string, f os.FileInfo) bool {
+		return ignores.ignored(path, f.IsDir()) || inQuarantine(path) || f.IsDir() && !includeBackups && isBackupDir(path)
+	})
+	if *buildIndexFile != "" {
+		var indexed []*mediaFile
+		for _, file := range files {
+			if !strings.HasPrefix(file, duplicatesDir) && mediaCategory(file) != "" {
+				indexed = append(indexed, &mediaFile{Path: file})
+			}
+		}
+		log.Println("Indexing " + extensions.IntToString(len(indexed)) + " media files...")
+		idx, err := buildIndex(directoryToIterate, indexed)
+		if err == nil {
+			err = idx.write(*buildIndexFile)
+		}
+		if err != nil {
+			stdErr.Fatal("Could not build index " + *buildIndexFile + ": " + err.Error())
+		}
+		log.Println("Wrote the index of " + extensions.IntToString(len(idx.Files)) + " media files to " + *buildIndexFile)
+		log.Println(logger.TimeTrack(startEntireProcess, "Completed in"))
+		return
+	}
+	var idx *mediaIndex
+	if *useIndex != "" {
+		if idx, err = loadIndex(*useIndex); err != nil {
+			stdErr.Fatal("Could not load index " + *useIndex + ": " + err.Error())
+		}
 	}
-	files, _ := RecurseFiles(directoryToIterate)
 	for _, fileToWorkOn := range files {
-		pieces := strings.Split(fileToWorkOn, ".")
-		ext := strings.ToUpper(pieces[len(pieces)-1:][0])
-		if utils.InArray(ext, pictureExtensions) || utils.InArray(ext, movieExtensions) {
-			pieces := strings.Split(filepath.Base(fileToWorkOn), ".")
-			existingExt := "." + pieces[len(pieces)-1:][0]
-			fileName := strings.ReplaceAll(filepath.Base(fileToWorkOn), existingExt, "")
-			_, err := time.Parse(fmtDesired, fileName)
-			if err == nil {
-				log.Println(fileName + " is in desired date format skipping")
+		if strings.HasPrefix(fileToWorkOn, duplicatesDir) {
+			continue
+		}
+		existingExt := filepath.Ext(fileToWorkOn)
+		if mediaCategory(fileToWorkOn) != "" {
+			if linksIntoRoot(directoryToIterate, fileToWorkOn) {
+				results.add(fileResult{Path: fileToWorkOn, Status: statusSkipped, Reason: reasonLink})
+				continue
+			}
+			if !followSymlinks && linksOutsideRoot(directoryToIterate, fileToWorkOn) {
+				fileLog.Println("Skipping " + fileToWorkOn + ", it is a symlink to a file outside " + directoryToIterate + ", pass -follow-symlinks to rename it")
+				results.add(fileResult{Path: fileToWorkOn, Status: statusSkipped, Reason: reasonExternalLink})
+				continue
+			}
+			fileName := strings.TrimSuffix(filepath.Base(fileToWorkOn), existingExt)
+			if *repair {
+				if !hasSuffixChain(fileName, fileToWorkOn) {
+					results.add(fileResult{Path: fileToWorkOn, Status: statusSkipped, Reason: reasonNotCorrupted})
+					continue
+				}
+				mediaFiles = append(mediaFiles, &mediaFile{Path: fileToWorkOn})
+				continue
+			}
+			formatted := isFormattedName(fileName, fileToWorkOn)
+			// files already named still take part in deduping and syncing file times, processFile leaves their names alone
+			if formatted && outputExtension(existingExt) == existingExt && len(preferredFormats) == 0 && !syncFileTimes && !*force && !identicalDedupe && *dedupeReport == "" && groupRoot == "" && !*organizeByLocation && !*flatten && !*verify {
+				fileLog.Println(fileName + " is in desired date format skipping")
+				results.add(fileResult{Path: fileToWorkOn, Status: statusSkipped, Reason: reasonFormatted})
 				continue
 			}
 
-			processJobs = append(processJobs, processJob{
-				Wg:   &wg,
-				File: fileToWorkOn,
-				Func: func(fileWork string) {
-					pieces := strings.Split(filepath.Base(fileWork), ".")
-					extUpper := strings.ToUpper(pieces[len(pieces)-1:][0])
-					existingExt := "." + pieces[len(pieces)-1:][0]
-
-					// Movie files
-
-					if utils.InArray(extUpper, movieExtensions) {
-						fd, err := os.Open(fileWork)
-						timeInfo, err := getVideoCreationTimeMetadata(fd)
-						fd.Close()
-						if err != nil {
-							stdErr.Println("Could not Read timestamp on movie file " + fileWork + ": " + err.Error())
-							return
-						}
-
-						potentialName := timeInfo.Format(fmtDesired)
-						fileName := strings.ReplaceAll(filepath.Base(fileWork), existingExt, "")
-						if fileName != potentialName {
-							newName := strings.ReplaceAll(fileWork, path.PathSeparator+fileName+existingExt, path.PathSeparator+potentialName+existingExt)
-							err := os.Rename(fileWork, newName)
-							if err != nil {
-								if attemptRenameToDifferentMinute {
-									// In a case of old scanned photos, you could have exif of approx dates, so this is a colision handler if you had 15000 images in one directory with the same exif Date
-									for i := 1; i < colisionMax; i++ {
-										potentialName := potentialName + "-" + extensions.IntToString(i)
-										newName = strings.ReplaceAll(fileWork, path.PathSeparator+fileName+existingExt, path.PathSeparator+potentialName+existingExt)
-										if err := os.Rename(fileWork, newName); err == nil {
-											log.Println("Renamed " + fileName + " to " + potentialName)
-											return
-										}
-									}
-								}
-								stdErr.Println("Could not rename: " + fileWork + ": " + err.Error())
-								return
-							}
-							log.Println("Renamed " + fileName + " to " + potentialName)
-						}
-
-						return
-					}
-
-					// Picture files
-
-					data, err := os.ReadFile(fileWork)
-					if err != nil {
-						stdErr.Println("Could not ReadFile" + fileWork + ": " + err.Error())
-						return
-					}
-					reader := bytes.NewReader(data)
-					x, err := exif.Decode(reader)
-					if err != nil {
-						stdErr.Println("Could not exif.Decode " + fileWork + ": " + err.Error())
-						return
-					}
-					data, err = x.MarshalJSON()
-					if err != nil {
-						stdErr.Println("Could not MarshalJSON " + fileWork + ": " + err.Error())
-						return
-					}
-					exifFields := make(map[string]interface{})
-					json.Unmarshal(data, &exifFields)
-					dateTimeOriginalValue, dateTimeOriginalok := exifFields["DateTimeOriginal"]
-					dateTimeValue, dateTimeok := exifFields["DateTime"]
-					if dateTimeOriginalok {
-						timeInfo, err := time.Parse("2006:01:02 15:04:05", dateTimeOriginalValue.(string))
-						if err != nil {
-							stdErr.Println("Failed to parse DateTimeOriginal Exif Data: " + fileWork + ": " + err.Error())
-							return
-						}
-						potentialName := timeInfo.Format(fmtDesired)
-						fileName := strings.ReplaceAll(filepath.Base(fileWork), existingExt, "")
-						if fileName != potentialName {
-							newName := strings.ReplaceAll(fileWork, path.PathSeparator+fileName+existingExt, path.PathSeparator+potentialName+existingExt)
-							err := os.Rename(fileWork, newName)
-							if err != nil {
-								if attemptRenameToDifferentMinute {
-									// In a case of old scanned photos, you could have exif of approx dates, so this is a colision handler if you had 15000 images in one directory with the same exif Date
-									for i := 1; i < colisionMax; i++ {
-										potentialName := potentialName + "-" + extensions.IntToString(i)
-										newName = strings.ReplaceAll(fileWork, path.PathSeparator+fileName+existingExt, path.PathSeparator+potentialName+existingExt)
-										if err := os.Rename(fileWork, newName); err == nil {
-											log.Println("Renamed " + fileName + " to " + potentialName)
-											return
-										}
-									}
-								}
-								stdErr.Println("Could not rename: " + fileWork + ": " + err.Error())
-								return
-							}
-							log.Println("Renamed " + fileName + " to " + potentialName)
-						}
-					} else if dateTimeok {
-						timeInfo, err := time.Parse("2006:01:02 15:04:05", dateTimeValue.(string))
-						if err != nil {
-							stdErr.Println("Failed to parse DateTime Exif Data: " + fileWork + ": " + err.Error())
-							return
-						}
-						potentialName := timeInfo.Format(fmtDesired)
-						fileName := strings.ReplaceAll(filepath.Base(fileWork), existingExt, "")
-						if fileName != potentialName {
-							newName := strings.ReplaceAll(fileWork, path.PathSeparator+fileName+existingExt, path.PathSeparator+potentialName+existingExt)
-							err := os.Rename(fileWork, newName)
-							if err != nil {
-								if attemptRenameToDifferentMinute {
-									// In a case of old scanned photos, you could have exif of approx dates, so this is a colision handler if you had 15000 images in one directory with the same exif Date
-									for i := 1; i < colisionMax; i++ {
-										potentialName := potentialName + "-" + extensions.IntToString(i)
-										newName = strings.ReplaceAll(fileWork, path.PathSeparator+fileName+existingExt, path.PathSeparator+potentialName+existingExt)
-										if err := os.Rename(fileWork, newName); err == nil {
-											log.Println("Renamed " + fileName + " to " + potentialName)
-											return
-										}
-									}
-								}
-								stdErr.Println("Could not rename: " + fileWork + ": " + err.Error())
-								return
-							}
-							log.Println("Renamed " + fileName + " to " + potentialName)
-						}
-					}
-				},
-			})
+			mediaFiles = append(mediaFiles, &mediaFile{Path: fileToWorkOn})
 		}
 	}
-	wg.Add(len(processJobs))
-	go func() {
-		for _, job := range processJobs {
-			j := job
-			jobs <- j
-		}
-	}()
 
 	log.Println("Waiting on threads to finish reading all your images and media...")
-	wg.Wait()
+	// files skipped by name above take no time, only the media files left to read are counted
+	processed := newProgress(len(mediaFiles))
+	runJobs(mediaFiles, func(mf *mediaFile) {
+		if idx == nil || !idx.lookup(mf) {
+			readMediaTime(mf)
+		}
+		useFilenameDate(mf)
+		if mf.Err == nil {
+			mf.mediaTime = zoneWallClock(mf.mediaTime)
+		}
+		processed.step()
+	})
+	mediaFiles = filterDateRange(mediaFiles)
+	if explain {
+		explainFiles(mediaFiles)
+	}
+	if *dateSourceReport {
+		log.Println(dateSourceBreakdown(mediaFiles))
+	}
+	if *verify {
+		verified := verifyNames(mediaFiles)
+		log.Println(verified.summary())
+		log.Println(logger.TimeTrack(startEntireProcess, "Completed in"))
+		if len(verified.mismatched) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if *dedupeReport != "" {
+		identical := planDedupeIdentical(mediaFiles)
+		if err := writeDedupeReport(*dedupeReport, identical); err != nil {
+			stdErr.Fatal("Could not write dedupe report " + *dedupeReport + ": " + err.Error())
+		}
+		log.Println("Wrote " + extensions.IntToString(len(identical)) + " groups of identical files to " + *dedupeReport + ", nothing has been moved")
+		log.Println(logger.TimeTrack(startEntireProcess, "Completed in"))
+		return
+	}
+	var plan []dedupeAction
+	if identicalDedupe {
+		plan = planDedupeIdentical(mediaFiles)
+	}
+	if len(preferredFormats) > 0 {
+		plan = append(plan, planDedupeAcrossExtensions(dedupeRemaining(plan, mediaFiles))...)
+	}
+	if len(preferredFormats) > 0 || identicalDedupe {
+		if *dedupeDryRun {
+			log.Println(describeDedupePlan(directoryToIterate, plan))
+			log.Println(logger.TimeTrack(startEntireProcess, "Completed in"))
+			return
+		}
+	}
+	if *emitPlan != "" {
+		if sequenceState != "" {
+			if err := loadSequenceState(); err != nil {
+				stdErr.Fatal(err.Error())
+			}
+		}
+		operations, err := buildRenamePlan(directoryToIterate, plan, mediaFiles)
+		if err == nil {
+			err = writeRenamePlan(*emitPlan, operations)
+		}
+		if sequenceState != "" {
+			// the numbers in the plan are taken even though it is applied later
+			if err == nil {
+				err = saveSequenceState()
+			}
+			releaseSequenceState()
+		}
+		if err != nil {
+			stdErr.Fatal("Could not write plan " + *emitPlan + ": " + err.Error())
+		}
+		log.Println("Wrote " + extensions.IntToString(len(operations.Operations)) + " planned operations to " + *emitPlan + ", nothing has been renamed")
+		log.Println(logger.TimeTrack(startEntireProcess, "Completed in"))
+		return
+	}
+
+	backupDir := backupPath(directoryToIterate)
+	originalCount := 0
+	if *backup && !*backupProcessedOnly {
+		log.Println("Backing up " + directoryToIterate + " to " + backupDir)
+		if err := backupDirectory(directoryToIterate, backupDir); err != nil {
+			stdErr.Fatal("Could not back up " + directoryToIterate + ": " + err.Error())
+		}
+		originalCount = countFilteredFiles(directoryToIterate)
+	}
+	// the report still lists the date sources of files deduping moves
+	readFiles := mediaFiles
+	duplicates, duplicateBytes := identicalDuplicates(plan)
+	links, moves := linkPlan(plan)
+	mediaFiles = dedupeRemaining(links, mediaFiles)
+	if len(moves) > 0 {
+		mediaFiles = applyDedupe(directoryToIterate, moves, mediaFiles)
+	}
+	if usesSequence() {
+		if sequenceState != "" {
+			if err := loadSequenceState(); err != nil {
+				stdErr.Fatal(err.Error())
+			}
+		}
+		assignSequence(mediaFiles)
+	}
+	if dateOnlyCollision == "spread" {
+		spreadDateOnly(mediaFiles)
+	}
+
+	var backedUp []string
+	if *backup && *backupProcessedOnly {
+		for _, mf := range mediaFiles {
+			if needsRename(mf) {
+				backedUp = append(backedUp, mf.Path)
+			}
+		}
+		log.Println("Backing up " + extensions.IntToString(len(backedUp)) + " files to be renamed to " + backupDir)
+		if err := backupFiles(directoryToIterate, backupDir, backedUp); err != nil {
+			if sequenceState != "" {
+				releaseSequenceState()
+			}
+			stdErr.Fatal("Could not back up " + directoryToIterate + ": " + err.Error())
+		}
+		originalCount = countFilteredFiles(directoryToIterate)
+	}
+
+	if *atomic {
+		renameAtomically(mediaFiles)
+	} else {
+		// files bound for the same name are renamed one after another by a single worker, in capture order
+		groups := make(map[*mediaFile][]*mediaFile)
+		var leaders []*mediaFile
+		for _, group := range collisionGroups(mediaFiles) {
+			groups[group[0]] = group
+			leaders = append(leaders, group[0])
+		}
+		runJobs(leaders, func(leader *mediaFile) {
+			for _, mf := range groups[leader] {
+				results.add(processFile(mf))
+			}
+		})
+	}
+
+	if len(links) > 0 {
+		linkDuplicates(links)
+	}
+
+	if sequenceState != "" {
+		if err := saveSequenceState(); err != nil {
+			stdErr.Println("Could not save " + sequenceState + ": " + err.Error())
+		}
+		releaseSequenceState()
+	}
+	if quarantineDir != "" {
+		log.Println(quarantineFiles(directoryToIterate, readFiles))
+	}
+
+	log.Println(results.summary())
+	if *flatten {
+		log.Println("Moved " + extensions.IntToString(results.relocated()) + " files up into " + flattenRoot)
+	}
+	if overflow := results.errorOverflow(); overflow != "" {
+		log.Println(overflow)
+	}
+	if tracing != nil {
+		if err := tracing.write(*traceFile); err != nil {
+			stdErr.Println("Could not write trace " + *traceFile + ": " + err.Error())
+		}
+	}
+	if *jsonReportFile != "" {
+		if err := writeJSONReport(*jsonReportFile, directoryToIterate, readFiles); err != nil {
+			stdErr.Println("Could not write report " + *jsonReportFile + ": " + err.Error())
+		}
+	}
+	if *htmlReport != "" {
+		if err := writeHTMLReport(*htmlReport, directoryToIterate, readFiles); err != nil {
+			stdErr.Println("Could not write HTML report " + *htmlReport + ": " + err.Error())
+		}
+	}
+	if *backup {
+		if err := writeRenameManifest(directoryToIterate, backupDir); err != nil {
+			stdErr.Println("Could not write rename manifest to " + backupDir + ": " + err.Error())
+		}
+	}
+	if identicalDedupe {
+		log.Println("Found " + extensions.IntToString(duplicates) + " files with identical content elsewhere, taking " + formatByteSize(duplicateBytes))
+	}
+	if *reportSkippedReasons {
+		log.Println(results.skipReasonBreakdown())
+	}
+	backupMatched := true
+	if *backup {
+		if *backupProcessedOnly {
+			if backupMatched = checkPartialBackup(directoryToIterate, backupDir, originalCount, len(backedUp)); !backupMatched && *restoreOnMismatch {
+				if countFilteredFiles(backupDir) != len(backedUp) {
+					stdErr.Println("Not restoring, " + backupDir + " does not hold every file planned for renaming")
+				} else if err := restorePartialBackup(directoryToIterate, backupDir); err != nil {
+					stdErr.Println("Could not restore " + directoryToIterate + " from " + backupDir + ": " + err.Error())
+				} else {
+					log.Println("Restored the renamed files of " + directoryToIterate + " from " + backupDir)
+				}
+			}
+		} else {
+			if backupMatched = checkBackup(directoryToIterate, backupDir); !backupMatched && *restoreOnMismatch {
+				if countFilteredFiles(backupDir) != originalCount {
+					stdErr.Println("Not restoring, " + backupDir + " does not hold the " + extensions.IntToString(originalCount) + " media files there were before the run")
+				} else if err := restoreBackup(directoryToIterate, backupDir); err != nil {
+					stdErr.Println("Could not restore " + directoryToIterate + " from " + backupDir + ": " + err.Error())
+				} else {
+					log.Println("Restored " + directoryToIterate + " from " + backupDir)
+				}
+			}
+		}
+	}
 	log.Println(logger.TimeTrack(startEntireProcess, "Completed in"))
+	if requireDate && results.count(statusFailed) > 0 {
+		os.Exit(1)
+	}
+	if *strict {
+		if failed := results.count(statusFailed); failed > 0 || !backupMatched {
+			var reasons []string
+			if failed > 0 {
+				reasons = append(reasons, extensions.IntToString(failed)+" files failed")
+			}
+			if !backupMatched {
+				reasons = append(reasons, "the backup did not match")
+			}
+			stdErr.Println("Exiting with status 1 for -strict: " + strings.Join(reasons, " and "))
+			os.Exit(1)
+		}
+	}
 }
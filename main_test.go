@@ -0,0 +1,588 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// runMainEnv makes the test binary run main with the arguments in runMainArgsEnv instead of the tests, see runMain
+const (
+	runMainEnv     = "MEDIARENAMER_TEST_RUN_MAIN"
+	runMainArgsEnv = "MEDIARENAMER_TEST_ARGS"
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		var args []string
+		if err := json.Unmarshal([]byte(os.Getenv(runMainArgsEnv)), &args); err != nil {
+			panic(err)
+		}
+		os.Args = append([]string{os.Args[0]}, args...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the program with args in a child process, as flags and stdErr.Fatal are process wide, and returns what it logged and whether it exited non-zero
+func runMain(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), runMainEnv+"=1", runMainArgsEnv+"="+string(encoded))
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err = cmd.Run()
+	return output.String(), err
+}
+
+// mustRunMain is runMain failing the test when the program exits non-zero
+func mustRunMain(t *testing.T, args ...string) string {
+	t.Helper()
+	output, err := runMain(t, args...)
+	if err != nil {
+		t.Fatalf("run %q failed: %v\n%s", args, err, output)
+	}
+	return output
+}
+
+// writeTestFile writes data to name under dir, creating the folders it needs, and returns its path
+func writeTestFile(t testing.TB, dir string, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// copyTestdata copies the fixture testdata/fixture to name under dir and returns its path
+func copyTestdata(t testing.TB, dir string, fixture string, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeTestFile(t, dir, name, data)
+}
+
+// listFiles returns the paths of the files under dir relative to it, slash separated and sorted
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// assertFiles fails the test unless the files under dir are exactly want
+func assertFiles(t *testing.T, dir string, want ...string) {
+	t.Helper()
+	sort.Strings(want)
+	if got := listFiles(t, dir); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("files in %s:\n got %q\nwant %q", dir, got, want)
+	}
+}
+
+// tiffEntry is a field of an IFD built by buildTiff
+type tiffEntry struct {
+	tag      uint16
+	dataType uint16
+	count    uint32
+	data     []byte
+}
+
+func asciiEntry(tag uint16, value string) tiffEntry {
+	data := append([]byte(value), 0)
+	return tiffEntry{tag, 2, uint32(len(data)), data}
+}
+
+func longEntry(tag uint16, values ...uint32) tiffEntry {
+	data := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], value)
+	}
+	return tiffEntry{tag, 4, uint32(len(values)), data}
+}
+
+func rationalEntry(tag uint16, values ...uint32) tiffEntry {
+	entry := longEntry(tag, values...)
+	entry.dataType, entry.count = 5, uint32(len(values)/2)
+	return entry
+}
+
+// testIFD is an IFD of a Tiff built by buildTiff with the Exif and GPS sub-IFDs it points to
+type testIFD struct {
+	fields []tiffEntry
+	exif   []tiffEntry
+	gps    []tiffEntry
+}
+
+// buildTiff lays out a little endian Tiff holding ifds chained in order
+func buildTiff(ifds ...testIFD) []byte {
+	var out []byte
+	out = append(out, 'I', 'I', 42, 0, 0, 0, 0, 0)
+	// writeIFD appends an IFD with its values after it and returns where it starts and where its next IFD offset is
+	writeIFD := func(fields []tiffEntry) (start int, next int) {
+		fields = append([]tiffEntry{}, fields...)
+		sort.SliceStable(fields, func(i, j int) bool { return fields[i].tag < fields[j].tag })
+		start = len(out)
+		valuesAt := start + 2 + 12*len(fields) + 4
+		var values []byte
+		out = binary.LittleEndian.AppendUint16(out, uint16(len(fields)))
+		for _, field := range fields {
+			out = binary.LittleEndian.AppendUint16(out, field.tag)
+			out = binary.LittleEndian.AppendUint16(out, field.dataType)
+			out = binary.LittleEndian.AppendUint32(out, field.count)
+			if len(field.data) <= 4 {
+				out = append(out, append(append([]byte{}, field.data...), make([]byte, 4-len(field.data))...)...)
+				continue
+			}
+			out = binary.LittleEndian.AppendUint32(out, uint32(valuesAt+len(values)))
+			values = append(values, field.data...)
+			if len(values)%2 == 1 {
+				values = append(values, 0)
+			}
+		}
+		next = len(out)
+		out = append(out, 0, 0, 0, 0)
+		out = append(out, values...)
+		return start, next
+	}
+	// pointer fields are patched once the sub-IFD they point to is written
+	patch := func(ifdStart int, tag uint16, value int) {
+		count := int(binary.LittleEndian.Uint16(out[ifdStart:]))
+		for i := 0; i < count; i++ {
+			field := ifdStart + 2 + 12*i
+			if binary.LittleEndian.Uint16(out[field:]) == tag {
+				binary.LittleEndian.PutUint32(out[field+8:], uint32(value))
+			}
+		}
+	}
+	previousNext := 4
+	for _, ifd := range ifds {
+		fields := append([]tiffEntry{}, ifd.fields...)
+		if ifd.exif != nil {
+			fields = append(fields, longEntry(tagExifIFDPointer, 0))
+		}
+		if ifd.gps != nil {
+			fields = append(fields, longEntry(0x8825, 0))
+		}
+		start, next := writeIFD(fields)
+		binary.LittleEndian.PutUint32(out[previousNext:], uint32(start))
+		previousNext = next
+		if ifd.exif != nil {
+			exifStart, _ := writeIFD(ifd.exif)
+			patch(start, tagExifIFDPointer, exifStart)
+		}
+		if ifd.gps != nil {
+			gpsStart, _ := writeIFD(ifd.gps)
+			patch(start, 0x8825, gpsStart)
+		}
+	}
+	return out
+}
+
+// exifTiff is a Tiff with one IFD holding DateTime and an Exif sub-IFD holding DateTimeOriginal, empty values are left out
+func exifTiff(dateTime string, dateTimeOriginal string) []byte {
+	ifd := testIFD{}
+	if dateTime != "" {
+		ifd.fields = append(ifd.fields, asciiEntry(tagDateTime, dateTime))
+	}
+	if dateTimeOriginal != "" {
+		ifd.exif = []tiffEntry{asciiEntry(0x9003, dateTimeOriginal)}
+	}
+	return buildTiff(ifd)
+}
+
+// jpegWithExif wraps a Tiff in the APP1 segment of an otherwise empty JPEG
+func jpegWithExif(tiff []byte) []byte {
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(tiff)+8))
+	out = append(out, "Exif\x00\x00"...)
+	out = append(out, tiff...)
+	return append(out, 0xFF, 0xD9)
+}
+
+// restoreAfterTest puts the package variables pointed to back to their values once the test ends
+func restoreAfterTest[T any](t *testing.T, variables ...*T) {
+	t.Helper()
+	saved := make([]T, len(variables))
+	for i, variable := range variables {
+		saved[i] = *variable
+	}
+	t.Cleanup(func() {
+		for i, variable := range variables {
+			*variable = saved[i]
+		}
+	})
+}
+
+func TestParseCanonicalExtensions(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"jpg", map[string]string{"JPG": "jpg", "JPEG": "jpg", "JPE": "jpg"}, false},
+		{".tiff", map[string]string{"TIF": "tiff", "TIFF": "tiff"}, false},
+		{"png=PNG", map[string]string{"PNG": "PNG"}, false},
+		{" jpg , .tiff ", map[string]string{"JPG": "jpg", "JPEG": "jpg", "JPE": "jpg", "TIF": "tiff", "TIFF": "tiff"}, false},
+		{"xyz", nil, true},
+		{"jpg=", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseCanonicalExtensions(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseCanonicalExtensions(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		for from, to := range test.want {
+			if got[from] != to {
+				t.Errorf("parseCanonicalExtensions(%q)[%s] = %q, want %q", test.value, from, got[from], to)
+			}
+		}
+	}
+}
+
+func TestOutputExtension(t *testing.T) {
+	restoreAfterTest(t, &canonicalExtensions)
+	mapping, err := parseCanonicalExtensions("jpg,tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonicalExtensions = mapping
+	tests := []struct {
+		ext  string
+		want string
+	}{
+		{".JPEG", ".jpg"},
+		{".jpeg", ".jpg"},
+		{".JPG", ".jpg"},
+		{".TIF", ".tiff"},
+		{".tif", ".tiff"},
+		{".PNG", ".PNG"},
+		{".mov", ".mov"},
+	}
+	for _, test := range tests {
+		if got := outputExtension(test.ext); got != test.want {
+			t.Errorf("outputExtension(%q) = %q, want %q", test.ext, got, test.want)
+		}
+	}
+}
+
+func TestCanonicalExtRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_0001.JPEG", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "SCAN_0001.TIF", exifTiff("2021:05:02 08:00:00", ""))
+	mustRunMain(t, "-canonical-ext", "jpg,tiff", "-no-backup", dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg", "2021-05-02 08.00.00.tiff")
+}
+
+func TestRenameSidecars(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{"upper case", []string{"IMG_1234.AAE"}, []string{"2021-05-01 12.30.00.AAE"}},
+		{"lower case", []string{"IMG_1234.aae"}, []string{"2021-05-01 12.30.00.aae"}},
+		{"taken target", []string{"IMG_1234.AAE", "2021-05-01 12.30.00.AAE"}, []string{"IMG_1234.AAE", "2021-05-01 12.30.00.AAE"}},
+		{"other base name", []string{"IMG_9999.AAE"}, []string{"IMG_9999.AAE"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, file := range test.files {
+				writeTestFile(t, dir, file, []byte(file))
+			}
+			renameSidecars(filepath.Join(dir, "IMG_1234.HEIC"), filepath.Join(dir, "2021-05-01 12.30.00.HEIC"))
+			assertFiles(t, dir, test.want...)
+		})
+	}
+}
+
+func TestAAESidecarFollowsPhoto(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_1234.JPG", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "IMG_1234.AAE", []byte("<plist/>"))
+	mustRunMain(t, dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00.JPG", "2021-05-01 12.30.00.AAE")
+}
+
+// startTestWorkers starts the worker pool runJobs needs once for all tests
+var startTestWorkers sync.Once
+
+func TestRunJobsSurvivesPanic(t *testing.T) {
+	startTestWorkers.Do(func() { startWorkers(2) })
+	var mediaFiles []*mediaFile
+	for _, name := range []string{"a.jpg", "broken.heic", "b.jpg", "c.jpg"} {
+		mediaFiles = append(mediaFiles, &mediaFile{Path: name})
+	}
+	// more runs than workers, each would end a worker if panics were not recovered
+	for run := 0; run < 3; run++ {
+		done := make(chan bool)
+		var processed int32
+		go func() {
+			runJobs(mediaFiles, func(mf *mediaFile) {
+				if mf.Path == "broken.heic" {
+					panic("index out of range")
+				}
+				atomic.AddInt32(&processed, 1)
+			})
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("runJobs did not return after a job panicked")
+		}
+		if processed != 3 {
+			t.Errorf("run %d processed %d files, want 3", run, processed)
+		}
+		if mediaFiles[1].Err == nil || !strings.Contains(mediaFiles[1].Err.Error(), "index out of range") {
+			t.Errorf("run %d: the panicking file has error %v", run, mediaFiles[1].Err)
+		}
+	}
+}
+
+func TestDisplayTime(t *testing.T) {
+	restoreAfterTest(t, &displayLocation)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database: " + err.Error())
+	}
+	tokyoNoon := time.Date(2021, 5, 1, 12, 0, 0, 0, time.FixedZone("+09:00", 9*3600))
+	tests := []struct {
+		name     string
+		location *time.Location
+		mt       mediaTime
+		want     string
+	}{
+		{"zoned to New York", newYork, mediaTime{Time: tokyoNoon, Zoned: true}, "2021-04-30 23:00:00 EDT"},
+		{"zoned to UTC", time.UTC, mediaTime{Time: tokyoNoon, Zoned: true}, "2021-05-01 03:00:00 UTC"},
+		{"wall clock is left alone", newYork, mediaTime{Time: time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)}, "2021-05-01 12:00:00 UTC"},
+		{"no display zone", nil, mediaTime{Time: tokyoNoon, Zoned: true}, "2021-05-01 12:00:00 +09:00"},
+	}
+	for _, test := range tests {
+		displayLocation = test.location
+		if got := displayTime(test.mt).Format("2006-01-02 15:04:05 MST"); got != test.want {
+			t.Errorf("%s: displayTime = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDisplayTZRenames(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skip("no time zone database: " + err.Error())
+	}
+	dir := t.TempDir()
+	writeTestFile(t, dir, "tokyo.jpg", jpegWithExif(buildTiff(testIFD{exif: []tiffEntry{
+		asciiEntry(0x9003, "2021:05:01 12:00:00"),
+		asciiEntry(0x9011, "+09:00"),
+	}})))
+	writeTestFile(t, dir, "unzoned.jpg", jpegWithExif(exifTiff("", "2021:05:02 12:00:00")))
+	mustRunMain(t, "-display-tz", "America/New_York", dir)
+	assertFiles(t, dir, "2021-04-30 23.00.00.jpg", "2021-05-02 12.00.00.jpg")
+}
+
+func TestZoneWallClock(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database: " + err.Error())
+	}
+	restoreAfterTest(t, &sourceLocation)
+	sourceLocation = berlin
+	wallClock := func(month time.Month, day, hour int) mediaTime {
+		return mediaTime{Time: time.Date(2021, month, day, hour, 30, 0, 0, time.UTC)}
+	}
+	tests := []struct {
+		name string
+		mt   mediaTime
+		want time.Time
+	}{
+		// clocks went from 02:00 CET to 03:00 CEST on 2021-03-28
+		{"before the change", wallClock(time.March, 28, 1), time.Date(2021, 3, 28, 0, 30, 0, 0, time.UTC)},
+		{"after the change", wallClock(time.March, 28, 3), time.Date(2021, 3, 28, 1, 30, 0, 0, time.UTC)},
+		{"winter", wallClock(time.January, 10, 12), time.Date(2021, 1, 10, 11, 30, 0, 0, time.UTC)},
+		{"summer", wallClock(time.July, 10, 12), time.Date(2021, 7, 10, 10, 30, 0, 0, time.UTC)},
+		{"recorded zone kept", mediaTime{Time: time.Date(2021, 7, 10, 12, 30, 0, 0, time.UTC), Zoned: true}, time.Date(2021, 7, 10, 12, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got := zoneWallClock(test.mt)
+		if !got.Zoned || !got.Time.Equal(test.want) {
+			t.Errorf("%s: zoneWallClock = %v (zoned %v), want %v", test.name, got.Time, got.Zoned, test.want)
+		}
+	}
+	dateOnly := mediaTime{Time: time.Date(2021, 7, 10, 0, 0, 0, 0, time.UTC), DateOnly: true}
+	if got := zoneWallClock(dateOnly); got != dateOnly {
+		t.Errorf("zoneWallClock moved a date only time to %v", got.Time)
+	}
+}
+
+func TestSourceTZAcrossDaylightSaving(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skip("no time zone database: " + err.Error())
+	}
+	dir := t.TempDir()
+	writeTestFile(t, dir, "before.jpg", jpegWithExif(exifTiff("", "2021:03:28 01:30:00")))
+	writeTestFile(t, dir, "after.jpg", jpegWithExif(exifTiff("", "2021:03:28 03:30:00")))
+	writeTestFile(t, dir, "summer.jpg", jpegWithExif(exifTiff("", "2021:07:10 12:00:00")))
+	mustRunMain(t, "-source-tz", "Europe/Berlin", "-display-tz", "UTC", dir)
+	assertFiles(t, dir, "2021-03-28 00.30.00.jpg", "2021-03-28 01.30.00.jpg", "2021-07-10 10.00.00.jpg")
+}
+
+func TestRequireDate(t *testing.T) {
+	tests := []struct {
+		args  []string
+		fails bool
+	}{
+		{nil, false},
+		{[]string{"-require-date"}, true},
+		{[]string{"-require-date", "-strict"}, true},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+		noDate := writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("", "")))
+		output, err := runMain(t, append(test.args, dir)...)
+		if (err != nil) != test.fails {
+			t.Errorf("%q exited with %v, want failure %v\n%s", test.args, err, test.fails, output)
+		}
+		if test.fails && !strings.Contains(output, "Could not find a date in "+noDate) {
+			t.Errorf("%q did not report %s:\n%s", test.args, noDate, output)
+		}
+		// the files with dates are renamed either way
+		assertFiles(t, dir, "2021-05-01 12.30.00.jpg", "IMG_0002.jpg")
+	}
+}
+
+func TestCaptureInstant(t *testing.T) {
+	tokyo := time.FixedZone("", 9*60*60)
+	tests := []struct {
+		mt   mediaTime
+		want time.Time
+	}{
+		{mediaTime{Time: time.Date(2021, 5, 1, 12, 30, 0, 0, tokyo), Zoned: true}, time.Date(2021, 5, 1, 3, 30, 0, 0, time.UTC)},
+		// a wall clock reading is the same reading in the local zone, whatever zone it was parsed in
+		{mediaTime{Time: time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)}, time.Date(2021, 5, 1, 12, 30, 0, 0, time.Local)},
+		{mediaTime{Time: time.Date(2021, 5, 1, 12, 30, 0, 500, tokyo)}, time.Date(2021, 5, 1, 12, 30, 0, 500, time.Local)},
+	}
+	for _, test := range tests {
+		if got := captureInstant(test.mt); !got.Equal(test.want) {
+			t.Errorf("captureInstant(%v, zoned %v) = %v, want %v", test.mt.Time, test.mt.Zoned, got, test.want)
+		}
+	}
+}
+
+func TestSyncFileTimes(t *testing.T) {
+	t.Setenv("TZ", "America/New_York")
+	dir := t.TempDir()
+	writeTestFile(t, dir, "naive/IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "zoned/IMG_0001.jpg", jpegWithExif(buildTiff(testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:30:00"), asciiEntry(0x9011, "+09:00")}})))
+	writeTestFile(t, dir, "named/2021-05-01 12.30.00.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "video/clip.mp4", mp4WithTime(time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)))
+	mustRunMain(t, "-sync-file-times", dir)
+	tests := []struct {
+		file string
+		want time.Time
+	}{
+		// the camera clock of a picture without a zone is taken as local time
+		{"naive/2021-05-01 12.30.00.jpg", time.Date(2021, 5, 1, 16, 30, 0, 0, time.UTC)},
+		{"zoned/2021-05-01 12.30.00.jpg", time.Date(2021, 5, 1, 3, 30, 0, 0, time.UTC)},
+		{"named/2021-05-01 12.30.00.jpg", time.Date(2021, 5, 1, 16, 30, 0, 0, time.UTC)},
+		// video times are UTC and named in local time
+		{"video/2021-05-01 08.30.00.mp4", time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(test.file)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !info.ModTime().Equal(test.want) {
+			t.Errorf("%s modified at %v, want %v", test.file, info.ModTime().UTC(), test.want)
+		}
+	}
+}
+
+func TestRenormalizeTZ(t *testing.T) {
+	dir := t.TempDir()
+	zoned := func(offset string) []byte {
+		return jpegWithExif(buildTiff(testIFD{exif: []tiffEntry{asciiEntry(0x9003, "2023:01:01 12:00:00"), asciiEntry(0x9011, offset)}}))
+	}
+	// each trip was named in the zone the camera was in
+	writeTestFile(t, dir, "tokyo/2023-01-01 12.00.00.jpg", zoned("+09:00"))
+	writeTestFile(t, dir, "new york/2023-01-01 12.00.00.jpg", zoned("-05:00"))
+	writeTestFile(t, dir, "london/2023-01-01 12.00.00.jpg", zoned("+00:00"))
+	// without a zone the instant is unknown, the name is left alone
+	writeTestFile(t, dir, "home/2023-01-01 12.00.00.jpg", jpegWithExif(exifTiff("", "2023:01:01 12:00:00")))
+	want := []string{"home/2023-01-01 12.00.00.jpg", "london/2023-01-01 12.00.00.jpg", "new york/2023-01-01 17.00.00.jpg", "tokyo/2023-01-01 03.00.00.jpg"}
+	mustRunMain(t, "-display-tz", "UTC", "-renormalize-tz", dir)
+	assertFiles(t, dir, want...)
+	mustRunMain(t, "-display-tz", "UTC", "-renormalize-tz", dir)
+	assertFiles(t, dir, want...)
+}
+
+func BenchmarkGetMediaTime(b *testing.B) {
+	dir := b.TempDir()
+	// a 16MB photo whose Exif fills its first few hundred bytes, as in the large JPEGs of high resolution cameras
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	large := writeTestFile(b, dir, "IMG_0001.jpg", append(photo[:len(photo)-2], append(make([]byte, 16<<20), 0xFF, 0xD9)...))
+	// a RAW file without Exif goexif can read, its date is only found in the embedded JPEG preview
+	raw := copyTestdata(b, dir, "broken-tiff-preview.cr2", "IMG_0002.CR2")
+	for _, file := range []string{large, raw} {
+		name := filepath.Base(file)
+		b.Run(name+"/ReadFile", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// the whole file is read and kept for the preview, as before pictures were decoded from the open file
+				data, err := os.ReadFile(file)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, _, err := decodeExifTime(bytes.NewReader(data), file); err != nil {
+					if _, _, ok := embeddedJPEGTime(data, file); !ok {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(name+"/open file", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := getMediaTime(file); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Matroska/WebM element IDs, see https://www.matroska.org/technical/elements.html
+const (
+	ebmlSegmentID = 0x18538067
+	ebmlInfoID    = 0x1549A966
+	ebmlDateUTCID = 0x4461
+	ebmlClusterID = 0x1F43B675
+)
+
+// matroskaEpoch is what DateUTC counts nanoseconds from
+var matroskaEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var matroskaExtensions = []string{
+	"MKV", "WEBM",
+}
+
+// readVint reads an EBML variable length integer.  The number of leading zero bits in the first byte gives the length, IDs keep the length marker bit while sizes drop it.  unknown is set for sizes with every value bit set
+func readVint(r io.Reader, maxLength int, keepMarker bool) (value uint64, unknown bool, err error) {
+	first := make([]byte, 1)
+	if _, err = io.ReadFull(r, first); err != nil {
+		return
+	}
+	length := 1
+	for mask := byte(0x80); length <= maxLength && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > maxLength {
+		return 0, false, errors.New("Invalid EBML variable length integer")
+	}
+	value = uint64(first[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	allOnes := value == uint64(0xFF>>length)
+	rest := make([]byte, length-1)
+	if _, err = io.ReadFull(r, rest); err != nil {
+		return
+	}
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	return value, allOnes && !keepMarker, nil
+}
+
+// readElementHeader reads an element ID and data size
+func readElementHeader(r io.Reader) (id uint64, size int64, unknown bool, err error) {
+	if id, _, err = readVint(r, 4, true); err != nil {
+		return
+	}
+	var dataSize uint64
+	if dataSize, unknown, err = readVint(r, 8, false); err != nil {
+		return
+	}
+	return id, int64(dataSize), unknown, nil
+}
+
+// getMatroskaCreationTime reads the DateUTC element from the Segment Information of a Matroska or WebM file
+func getMatroskaCreationTime(r io.ReadSeeker) (time.Time, error) {
+	// top level: EBML header, then the Segment
+	for {
+		id, size, unknown, err := readElementHeader(r)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if id == ebmlSegmentID {
+			break
+		}
+		if unknown {
+			return time.Time{}, errors.New("Unknown size top level EBML element")
+		}
+		if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	// segment children, the Segment may have an unknown size when written live so read until the first Cluster or EOF
+	for {
+		id, size, unknown, err := readElementHeader(r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return time.Time{}, err
+		}
+		if id == ebmlClusterID {
+			break
+		}
+		if unknown {
+			return time.Time{}, errors.New("Unknown size EBML element in segment")
+		}
+		if id != ebmlInfoID {
+			if _, err := r.Seek(size, io.SeekCurrent); err != nil {
+				return time.Time{}, err
+			}
+			continue
+		}
+
+		start, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for pos := start; pos < start+size; {
+			childID, childSize, childUnknown, err := readElementHeader(r)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if childUnknown {
+				return time.Time{}, errors.New("Unknown size EBML element in segment info")
+			}
+			if childID == ebmlDateUTCID {
+				if childSize != 8 {
+					return time.Time{}, errors.New("Invalid DateUTC element size")
+				}
+				data := make([]byte, 8)
+				if _, err := io.ReadFull(r, data); err != nil {
+					return time.Time{}, err
+				}
+				nanoseconds := int64(binary.BigEndian.Uint64(data))
+				return matroskaEpoch.Add(time.Duration(nanoseconds)).Local(), nil
+			}
+			if pos, err = r.Seek(childSize, io.SeekCurrent); err != nil {
+				return time.Time{}, err
+			}
+		}
+		return time.Time{}, errors.New("No DateUTC element in segment info")
+	}
+	return time.Time{}, errors.New("Did not find segment info")
+}
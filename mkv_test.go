@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadVint(t *testing.T) {
+	tests := []struct {
+		data       []byte
+		maxLength  int
+		keepMarker bool
+		want       uint64
+		unknown    bool
+		fails      bool
+	}{
+		{[]byte{0x81}, 8, false, 1, false, false},
+		{[]byte{0x40, 0x02}, 8, false, 2, false, false},
+		{[]byte{0x1A, 0x45, 0xDF, 0xA3}, 4, true, 0x1A45DFA3, false, false},
+		{[]byte{0x18, 0x53, 0x80, 0x67}, 4, true, ebmlSegmentID, false, false},
+		{[]byte{0xFF}, 8, false, 0x7F, true, false},
+		{[]byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, 8, false, 0xFFFFFFFFFFFFFF, true, false},
+		// an ID may be at most 4 bytes long
+		{[]byte{0x08, 0, 0, 0, 0}, 4, true, 0, false, true},
+		{[]byte{0x40}, 8, false, 0, false, true},
+	}
+	for _, test := range tests {
+		value, unknown, err := readVint(bytes.NewReader(test.data), test.maxLength, test.keepMarker)
+		if (err != nil) != test.fails {
+			t.Errorf("readVint(% X) error %v, want failure %v", test.data, err, test.fails)
+			continue
+		}
+		if !test.fails && (value != test.want || unknown != test.unknown) {
+			t.Errorf("readVint(% X) = %X, %v, want %X, %v", test.data, value, unknown, test.want, test.unknown)
+		}
+	}
+}
+
+func TestGetMatroskaCreationTime(t *testing.T) {
+	// dateutc.mkv is an empty EBML header, a live Segment of unknown size, a SeekHead and an Info holding TimecodeScale and DateUTC
+	file, err := os.Open(filepath.Join("testdata", "dateutc.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	got, err := getMatroskaCreationTime(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("DateUTC = %v, want %v", got, want)
+	}
+}
+
+func TestMatroskaRenames(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	dir := t.TempDir()
+	copyTestdata(t, dir, "dateutc.mkv", "clip.mkv")
+	copyTestdata(t, dir, "dateutc.mkv", "clip.webm")
+	mustRunMain(t, dir)
+	assertFiles(t, dir, "2022-03-04 05.06.07.mkv", "2022-03-04 05.06.07.webm")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// pickEarliest is set by -pick earliest, the earliest plausible of all recorded times wins instead of the first by preference.  Editors update the later tags when they save a file, the earliest is most likely the capture
+var pickEarliest bool
+
+// plausibleCaptureTime reports whether a photo time can be a real capture time.  Unset clocks and zeroed tags give the 1904 and 1970 epochs, a wrong clock may be in the future
+func plausibleCaptureTime(t time.Time) bool {
+	return t.Year() > 1970 && t.Before(time.Now().Add(24*time.Hour))
+}
+
+// earliestTime returns the candidate with the earliest capture instant among those plausible reports true for
+func earliestTime(candidates []mediaTime, plausible func(time.Time) bool) (mediaTime, bool) {
+	var earliest mediaTime
+	found := false
+	for _, candidate := range candidates {
+		if !plausible(captureInstant(candidate)) {
+			continue
+		}
+		if !found || captureInstant(candidate).Before(captureInstant(earliest)) {
+			earliest, found = candidate, true
+		}
+	}
+	return earliest, found
+}
+
+// earliestExifTime is exifTime for -pick earliest.  Every Exif date tag and the GPS time are read, tags which can not be parsed are passed over.  Date only times are used only when nothing else is recorded as midnight would always win
+func earliestExifTime(x *exif.Exif, fileWork string) (mediaTime, error) {
+	var candidates, dateOnly []mediaTime
+	var jsonFields map[string]interface{}
+	for _, field := range exifDateFields {
+		value, present, ok := exifString(x, field.name)
+		offset := dateOffset(x, field)
+		if present && !ok {
+			if jsonFields == nil {
+				jsonFields = make(map[string]interface{})
+				if data, err := x.MarshalJSON(); err == nil {
+					json.Unmarshal(data, &jsonFields)
+				}
+			}
+			value, ok = jsonDateString(jsonFields[string(field.name)])
+			if jsonOffset, _ := jsonFields[string(field.offset)].(string); strings.TrimSpace(jsonOffset) != "" {
+				offset = jsonOffset
+			}
+		}
+		if !ok {
+			continue
+		}
+		timeInfo, err := parseExifDate(value, offset)
+		if err != nil {
+			continue
+		}
+		subSec, _, _ := exifString(x, field.subSec)
+		timeInfo = withSubSec(timeInfo, subSec)
+		timeInfo.Source, timeInfo.Value = string(field.name), strings.TrimSpace(value+" "+offset)
+		if timeInfo.DateOnly {
+			dateOnly = append(dateOnly, timeInfo)
+		} else {
+			candidates = append(candidates, timeInfo)
+		}
+	}
+	if timeInfo, ok := gpsTime(x); ok {
+		if timeInfo.DateOnly {
+			dateOnly = append(dateOnly, timeInfo)
+		} else {
+			candidates = append(candidates, timeInfo)
+		}
+	}
+	if timeInfo, ok := earliestTime(candidates, plausibleCaptureTime); ok {
+		return timeInfo, nil
+	}
+	if timeInfo, ok := earliestTime(dateOnly, plausibleCaptureTime); ok {
+		return timeInfo, nil
+	}
+	// nothing is plausible, fall back to the usual order of preference
+	return preferredExifTime(x, fileWork)
+}
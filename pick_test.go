@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEarliestTime(t *testing.T) {
+	at := func(year int, source string) mediaTime {
+		return mediaTime{Time: time.Date(year, 5, 1, 12, 0, 0, 0, time.UTC), Zoned: true, Source: source}
+	}
+	future := mediaTime{Time: time.Now().AddDate(1, 0, 0), Zoned: true, Source: "DateTime"}
+	tests := []struct {
+		name       string
+		candidates []mediaTime
+		want       string
+		ok         bool
+	}{
+		{"earliest wins", []mediaTime{at(2022, "DateTime"), at(2019, "DateTimeOriginal"), at(2020, "DateTimeDigitized")}, "DateTimeOriginal", true},
+		{"epoch passed over", []mediaTime{at(1970, "DateTimeDigitized"), at(2021, "DateTime")}, "DateTime", true},
+		{"future passed over", []mediaTime{future, at(2021, "GPS")}, "GPS", true},
+		{"nothing plausible", []mediaTime{at(1904, "mvhd"), future}, "", false},
+		{"no candidates", nil, "", false},
+	}
+	for _, test := range tests {
+		got, ok := earliestTime(test.candidates, plausibleCaptureTime)
+		if ok != test.ok || got.Source != test.want {
+			t.Errorf("%s: earliestTime = %v, %v, want %v, %v", test.name, got.Source, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestPickEarliest(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	// the editor saved the photo in 2022, its digitized tag was zeroed and the camera clock ran a second ahead of the GPS fix
+	resaved := buildTiff(testIFD{
+		fields: []tiffEntry{asciiEntry(0x0132, "2022:01:02 08:00:00")},
+		exif:   []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:30:00"), asciiEntry(0x9004, "1970:01:01 00:00:00")},
+		gps:    []tiffEntry{rationalEntry(0x0007, 12, 1, 29, 1, 59, 1), asciiEntry(0x001D, "2021:05:01")},
+	})
+	// a trimmed GoPro clip whose mvhd was rewritten on export, the GPS fix still has the recording time
+	trimmed := mp4WithTime(time.Date(2022, 3, 4, 10, 0, 0, 0, time.UTC), goProUdta("210501093000.000"))
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"preferred", nil, []string{"2021-05-01 12.30.00.jpg", "2022-03-04 10.00.00.mp4"}},
+		{"earliest", []string{"-pick", "earliest"}, []string{"2021-05-01 09.30.00.mp4", "2021-05-01 12.29.59.jpg"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, dir, "edited.jpg", jpegWithExif(resaved))
+			writeTestFile(t, dir, "trimmed.mp4", trimmed)
+			mustRunMain(t, append(test.args, dir)...)
+			assertFiles(t, dir, test.want...)
+		})
+	}
+}
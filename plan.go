@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// Operations of a rename plan written by -emit-plan
+const (
+	opRename = "rename"
+	opMove   = "move"
+	opSkip   = "skip"
+)
+
+// planOperation is one step of a rename plan
+type planOperation struct {
+	Op     string `json:"op"`
+	Source string `json:"source"`
+	Target string `json:"target,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// renamePlan is the file -emit-plan writes and -apply-plan executes
+type renamePlan struct {
+	Root       string          `json:"root"`
+	Operations []planOperation `json:"operations"`
+}
+
+// buildRenamePlan lists what a run would do with every file it looked at, in the order the operations have to be applied
+func buildRenamePlan(root string, dedupe []dedupeAction, mediaFiles []*mediaFile) (renamePlan, error) {
+	plan := renamePlan{Root: root}
+	results.Lock()
+	for _, result := range results.Items {
+		plan.Operations = append(plan.Operations, planOperation{Op: opSkip, Source: result.Path, Reason: result.Reason})
+	}
+	results.Unlock()
+
+	removed := make(map[*mediaFile]bool)
+	for _, action := range dedupe {
+		for _, mf := range action.Remove {
+			rel, err := filepath.Rel(root, mf.Path)
+			if err != nil {
+				return plan, err
+			}
+			removed[mf] = true
+			plan.Operations = append(plan.Operations, planOperation{Op: opMove, Source: mf.Path, Target: filepath.Join(root, duplicatesDirName, rel), Reason: reasonDuplicate})
+		}
+	}
+
+	var pending []*mediaFile
+	for _, mf := range mediaFiles {
+		switch {
+		case removed[mf]:
+		case mf.Err == errNoDate:
+			plan.Operations = append(plan.Operations, planOperation{Op: opSkip, Source: mf.Path, Reason: reasonNoDate})
+		case mf.Err != nil:
+			plan.Operations = append(plan.Operations, planOperation{Op: opSkip, Source: mf.Path, Reason: mf.Err.Error()})
+		default:
+			pending = append(pending, mf)
+		}
+	}
+	if usesSequence() {
+		assignSequence(pending)
+	}
+	if dateOnlyCollision == "spread" {
+		spreadDateOnly(pending)
+	}
+	renames, unchanged, skipped, err := planRenames(pending, false)
+	if err != nil {
+		return plan, err
+	}
+	for _, mf := range unchanged {
+		plan.Operations = append(plan.Operations, planOperation{Op: opSkip, Source: mf.Path, Reason: reasonFormatted})
+	}
+	for _, result := range skipped {
+		plan.Operations = append(plan.Operations, planOperation{Op: opSkip, Source: result.Path, Reason: result.Reason})
+	}
+	for _, rename := range renames {
+		plan.Operations = append(plan.Operations, planOperation{Op: opRename, Source: rename.From, Target: rename.To})
+	}
+	return plan, nil
+}
+
+// writeRenamePlan saves plan as JSON to file
+func writeRenamePlan(file string, plan renamePlan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// readRenamePlan loads a plan written by -emit-plan
+func readRenamePlan(file string) (plan renamePlan, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &plan); err != nil {
+		err = errors.New("Could not parse plan " + file + ": " + err.Error())
+	}
+	return
+}
+
+// applyRenamePlan executes the renames and moves of a plan in order.  Each source must still exist and each target still be free, operations for which that no longer holds fail without touching the file
+func applyRenamePlan(plan renamePlan) {
+	for _, operation := range plan.Operations {
+		result := fileResult{Path: operation.Source}
+		switch operation.Op {
+		case opSkip:
+			results.add(result.skipped(operation.Reason))
+			continue
+		case opRename, opMove:
+		default:
+			err := errors.New("Unknown plan operation " + operation.Op + " for " + operation.Source)
+			stdErr.Println(err.Error())
+			results.add(result.failed(err))
+			continue
+		}
+
+		var err error
+		switch {
+		case !extensions.DoesFileExist(operation.Source):
+			err = errors.New("Could not " + operation.Op + " " + operation.Source + ": it no longer exists")
+		case extensions.DoesFileExist(operation.Target):
+			err = errors.New("Could not " + operation.Op + " " + operation.Source + ": " + operation.Target + " already exists")
+		default:
+			if err = os.MkdirAll(filepath.Dir(operation.Target), 0755); err == nil {
+				err = os.Rename(operation.Source, operation.Target)
+			}
+			if err != nil {
+				err = errors.New("Could not " + operation.Op + " " + operation.Source + ": " + err.Error())
+			}
+		}
+		if err != nil {
+			stdErr.Println(err.Error())
+			results.add(result.failed(err))
+			continue
+		}
+
+		result.NewPath = operation.Target
+		if operation.Op == opMove {
+			result.Status = statusMoved
+			result.Reason = operation.Reason
+			logFileLine("Moved "+operation.Source+" to "+operation.Target, statusMoved, operation.Source, operation.Target, "")
+		} else {
+			result.Status = statusRenamed
+			oldLogName, newLogName := logNames(operation.Source, operation.Target)
+			logFileLine("Renamed "+oldLogName+" to "+newLogName, statusRenamed, oldLogName, newLogName, "")
+			renameSidecars(operation.Source, operation.Target)
+		}
+		results.add(result)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmitAndApplyPlan(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	planFile := filepath.Join(root, "plan.json")
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	writeTestFile(t, dir, "IMG_0001.HEIC", photo)
+	writeTestFile(t, dir, "IMG_0001.JPG", photo)
+	writeTestFile(t, dir, "trip/IMG_0002.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	writeTestFile(t, dir, "2021-05-03 09.00.00.jpg", jpegWithExif(exifTiff("", "2021:05:03 09:00:00")))
+	before := []string{"2021-05-03 09.00.00.jpg", "IMG_0001.HEIC", "IMG_0001.JPG", "trip/IMG_0002.jpg"}
+
+	mustRunMain(t, "-prefer-format", "heic,jpg", "-emit-plan", planFile, dir)
+	assertFiles(t, dir, before...)
+	plan, err := readRenamePlan(planFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, operation := range plan.Operations {
+		line := operation.Op + " " + relativeTo(dir, operation.Source)
+		if operation.Target != "" {
+			line += " -> " + relativeTo(dir, operation.Target)
+		}
+		got = append(got, filepath.ToSlash(line))
+	}
+	want := []string{
+		"move IMG_0001.JPG -> " + duplicatesDirName + "/IMG_0001.JPG",
+		"skip 2021-05-03 09.00.00.jpg",
+		"rename IMG_0001.HEIC -> 2021-05-01 12.30.00.HEIC",
+		"rename trip/IMG_0002.jpg -> trip/2021-05-02 08.00.00.jpg",
+	}
+	if filepath.Clean(plan.Root) != dir || strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("plan for %s:\n%s\nwant for %s:\n%s", plan.Root, strings.Join(got, "\n"), dir, strings.Join(want, "\n"))
+	}
+
+	mustRunMain(t, "-apply-plan", planFile)
+	assertFiles(t, dir, "2021-05-01 12.30.00.HEIC", "2021-05-03 09.00.00.jpg", duplicatesDirName+"/IMG_0001.JPG", "trip/2021-05-02 08.00.00.jpg")
+
+	// applying it again finds every source gone and changes nothing
+	output, err := runMain(t, "-apply-plan", planFile)
+	if err != nil {
+		t.Fatalf("apply failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "Could not rename "+filepath.Join(dir, "IMG_0001.HEIC")+": it no longer exists") {
+		t.Errorf("output lacks the missing source:\n%s", output)
+	}
+	assertFiles(t, dir, "2021-05-01 12.30.00.HEIC", "2021-05-03 09.00.00.jpg", duplicatesDirName+"/IMG_0001.JPG", "trip/2021-05-02 08.00.00.jpg")
+}
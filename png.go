@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// pngExtensions are PNG images.  goexif can not find Exif in them, it is read from their eXIf chunk, and screenshots and exports often only carry a date in their text chunks
+var pngExtensions = []string{
+	"PNG",
+}
+
+// pngSignature starts every PNG file
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// pngChunk is a chunk of a PNG file
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// pngChunks returns the chunks of a PNG up to IEND or the first truncated chunk, nil when data is not a PNG
+func pngChunks(data []byte) []pngChunk {
+	if !bytes.HasPrefix(data, []byte(pngSignature)) {
+		return nil
+	}
+	var chunks []pngChunk
+	i := len(pngSignature)
+	for i+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		// length, type, data and CRC
+		if length < 0 || length > len(data)-i-12 {
+			break
+		}
+		chunks = append(chunks, pngChunk{kind: kind, data: data[i+8 : i+8+length]})
+		if kind == "IEND" {
+			break
+		}
+		i += 12 + length
+	}
+	return chunks
+}
+
+// pngExif returns the TIFF data of a PNG's eXIf chunk
+func pngExif(data []byte) ([]byte, bool) {
+	for _, chunk := range pngChunks(data) {
+		if chunk.kind == "eXIf" {
+			return chunk.data, true
+		}
+	}
+	return nil, false
+}
+
+// pngText returns the keyword and text of a tEXt, zTXt or iTXt chunk, ok is false for other chunks and text which can not be read
+func pngText(chunk pngChunk) (keyword string, text string, ok bool) {
+	separator := bytes.IndexByte(chunk.data, 0)
+	if separator < 0 {
+		return "", "", false
+	}
+	keyword, rest := string(chunk.data[:separator]), chunk.data[separator+1:]
+	switch chunk.kind {
+	case "tEXt":
+		return keyword, string(rest), true
+	case "zTXt":
+		// compression method, always zlib
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		inflated, err := inflate(rest[1:])
+		return keyword, string(inflated), err == nil
+	case "iTXt":
+		// compression flag and method, then language tag and translated keyword
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed := rest[0] == 1
+		rest = rest[2:]
+		for n := 0; n < 2; n++ {
+			end := bytes.IndexByte(rest, 0)
+			if end < 0 {
+				return "", "", false
+			}
+			rest = rest[end+1:]
+		}
+		if !compressed {
+			return keyword, string(rest), true
+		}
+		inflated, err := inflate(rest)
+		return keyword, string(inflated), err == nil
+	}
+	return "", "", false
+}
+
+// inflate decompresses zlib data
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// pngCreationLayouts are the forms the PNG Creation Time keyword is found in, the RFC 1123 date the PNG specification suggests first.  Exif and ISO 8601 dates are read by parseCommentDate
+var pngCreationLayouts = []string{
+	time.RFC1123,
+	time.RFC1123Z,
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	time.ANSIC,
+}
+
+// parsePNGCreationTime parses the text of a Creation Time chunk
+func parsePNGCreationTime(value string) (mediaTime, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range pngCreationLayouts {
+		if timeInfo, err := time.Parse(layout, value); err == nil {
+			return mediaTime{Time: timeInfo, Zoned: layout != time.ANSIC, Value: value}, true
+		}
+	}
+	return parseCommentDate(value)
+}
+
+// xmpPropertyRegexp matches the value of an XMP property written as an attribute or as an element
+func xmpPropertyRegexp(property string) *regexp.Regexp {
+	return regexp.MustCompile(regexp.QuoteMeta(property) + `(?:\s*=\s*["']|>)\s*([^"'<]+)`)
+}
+
+// xmpDateProperties are the XMP properties holding a capture date, in order of preference
+var xmpDateProperties = []struct {
+	name  string
+	value *regexp.Regexp
+}{
+	{"exif:DateTimeOriginal", xmpPropertyRegexp("exif:DateTimeOriginal")},
+	{"photoshop:DateCreated", xmpPropertyRegexp("photoshop:DateCreated")},
+	{"xmp:CreateDate", xmpPropertyRegexp("xmp:CreateDate")},
+}
+
+// xmpDateLayouts are the ISO 8601 forms XMP dates are written in, with and without a zone
+var xmpDateLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+}
+
+// xmpTime returns the first date of xmpDateProperties found in an XMP packet, written as an attribute or as an element
+func xmpTime(packet string) (mediaTime, bool) {
+	for _, property := range xmpDateProperties {
+		match := property.value.FindStringSubmatch(packet)
+		if match == nil {
+			continue
+		}
+		value := strings.TrimSpace(match[1])
+		for i, layout := range xmpDateLayouts {
+			if timeInfo, err := time.Parse(layout, value); err == nil {
+				return mediaTime{Time: timeInfo, Zoned: i < 2, Source: property.name, Value: value}, true
+			}
+		}
+		if day, err := time.Parse("2006-01-02", value); err == nil {
+			return mediaTime{Time: day, DateOnly: true, Source: property.name, Value: value}, true
+		}
+	}
+	return mediaTime{}, false
+}
+
+// pngTextTime returns the date held in a PNG's text chunks: the Creation Time keyword or, failing that, the dates of an XMP packet
+func pngTextTime(data []byte) (mediaTime, bool) {
+	var xmp []string
+	for _, chunk := range pngChunks(data) {
+		keyword, text, ok := pngText(chunk)
+		if !ok {
+			continue
+		}
+		switch keyword {
+		case "Creation Time":
+			if mt, ok := parsePNGCreationTime(text); ok {
+				mt.Source = sourcePNGCreationTime
+				return mt, true
+			}
+		case "XML:com.adobe.xmp":
+			xmp = append(xmp, text)
+		}
+	}
+	for _, packet := range xmp {
+		if mt, ok := xmpTime(packet); ok {
+			return mt, true
+		}
+	}
+	return mediaTime{}, false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// pngWith returns a PNG of the chunks given between an empty IHDR and IEND, the reader ignores the CRCs
+func pngWith(chunks ...[]byte) []byte {
+	data := []byte(pngSignature)
+	data = append(data, pngChunkBytes("IHDR", make([]byte, 13))...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return append(data, pngChunkBytes("IEND", nil)...)
+}
+
+// pngChunkBytes returns a chunk of kind holding data, with a zero CRC
+func pngChunkBytes(kind string, data []byte) []byte {
+	chunk := make([]byte, 8)
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], kind)
+	return append(append(chunk, data...), 0, 0, 0, 0)
+}
+
+// deflate compresses text with zlib as zTXt and compressed iTXt chunks hold it
+func deflate(t *testing.T, text string) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	if _, err := w.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return compressed.Bytes()
+}
+
+func TestPngTextTime(t *testing.T) {
+	attributeXMP := `<rdf:Description xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/" photoshop:DateCreated="2020-03-04T05:06:07"/>`
+	elementXMP := `<rdf:Description><exif:DateTimeOriginal>2021-04-05T06:07:08+02:00</exif:DateTimeOriginal></rdf:Description>`
+	tests := []struct {
+		name   string
+		data   []byte
+		want   time.Time
+		zoned  bool
+		source string
+		ok     bool
+	}{
+		{"RFC 1123 Creation Time", pngWith(pngChunkBytes("tEXt", []byte("Creation Time\x00Tue, 01 Jan 2019 12:00:00 GMT"))), time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC), true, sourcePNGCreationTime, true},
+		{"Exif style Creation Time", pngWith(pngChunkBytes("tEXt", []byte("Creation Time\x002019:02:03 04:05:06"))), time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC), false, sourcePNGCreationTime, true},
+		{"compressed Creation Time", pngWith(pngChunkBytes("zTXt", append([]byte("Creation Time\x00\x00"), deflate(t, "2019:02:03 04:05:06")...))), time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC), false, sourcePNGCreationTime, true},
+		{"XMP attribute", pngWith(pngChunkBytes("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"+attributeXMP))), time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC), false, "photoshop:DateCreated", true},
+		{"compressed XMP element", pngWith(pngChunkBytes("iTXt", append([]byte("XML:com.adobe.xmp\x00\x01\x00\x00\x00"), deflate(t, elementXMP)...))), time.Date(2021, 4, 5, 4, 7, 8, 0, time.UTC), true, "exif:DateTimeOriginal", true},
+		{"Creation Time before XMP", pngWith(pngChunkBytes("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"+attributeXMP)), pngChunkBytes("tEXt", []byte("Creation Time\x002019:02:03 04:05:06"))), time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC), false, sourcePNGCreationTime, true},
+		{"other text", pngWith(pngChunkBytes("tEXt", []byte("Software\x00GIMP 2019:02:03 04:05:06"))), time.Time{}, false, "", false},
+		{"truncated chunk", append(pngWith(), pngChunkBytes("tEXt", []byte("Creation Time\x002019:02:03 04:05:06"))[:20]...), time.Time{}, false, "", false},
+		{"not a PNG", []byte("Creation Time\x002019:02:03 04:05:06"), time.Time{}, false, "", false},
+	}
+	for _, test := range tests {
+		got, ok := pngTextTime(test.data)
+		if ok != test.ok {
+			t.Errorf("%s: pngTextTime found a date %v, want %v", test.name, ok, test.ok)
+			continue
+		}
+		if ok && (!got.Time.Equal(test.want) || got.Zoned != test.zoned || got.Source != test.source) {
+			t.Errorf("%s: pngTextTime = %v zoned %v from %q, want %v zoned %v from %q", test.name, got.Time, got.Zoned, got.Source, test.want, test.zoned, test.source)
+		}
+	}
+}
+
+func TestPngExif(t *testing.T) {
+	tiffData := exifTiff("", "2022:05:06 07:08:09")
+	if got, ok := pngExif(pngWith(pngChunkBytes("eXIf", tiffData))); !ok || !bytes.Equal(got, tiffData) {
+		t.Errorf("pngExif did not return the eXIf chunk")
+	}
+	if _, ok := pngExif(pngWith(pngChunkBytes("tEXt", []byte("Software\x00GIMP")))); ok {
+		t.Errorf("pngExif found Exif in a PNG without an eXIf chunk")
+	}
+}
+
+func TestPngRenames(t *testing.T) {
+	dir := t.TempDir()
+	copyTestdata(t, dir, "screenshot.png", "Screenshot 1.png")
+	writeTestFile(t, dir, "export.png", pngWith(pngChunkBytes("eXIf", exifTiff("", "2022:05:06 07:08:09"))))
+	writeTestFile(t, dir, "plain.png", pngWith(pngChunkBytes("tEXt", []byte("Software\x00GIMP"))))
+	mustRunMain(t, "-display-tz", "UTC", dir)
+	// the fixture was created at 14:15:16 one hour east of UTC
+	assertFiles(t, dir, "2019-03-02 13.15.16.png", "2022-05-06 07.08.09.png", "plain.png")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+	"github.com/DanielRenne/GoCore/core/utils"
+)
+
+// preflightSample is the time -preflight renders every naming format with to see that it can be read back
+var preflightSample = time.Date(2023, 11, 14, 13, 45, 56, 0, time.UTC)
+
+// formatProblems reports naming formats whose names can not be recognized again, runs would then rename their own output over and over
+func formatProblems() (problems []string) {
+	formats := map[string]string{"format": fmtDesired, "-image-template": imageTemplate, "-video-template": videoTemplate, "-audio-template": audioTemplate, "-date-only-format": dateOnlyFormat}
+	for _, option := range []string{"format", "-image-template", "-video-template", "-audio-template", "-date-only-format"} {
+		format := formats[option]
+		if format == "" {
+			continue
+		}
+		mf := &mediaFile{Path: filepath.Join("preflight", "preflight.jpg"), Seq: 1}
+		name := renderName(format, preflightSample, mf)
+		parsed, _, ok := parseNameTokens(format, name, mf.Path)
+		if !ok || renderName(format, parsed, mf) != name {
+			problems = append(problems, "The "+option+" "+format+" can not be read back from the names it makes, e.g. "+name)
+		}
+	}
+	return
+}
+
+// extensionProblems reports extension lists which contradict each other or name formats this tool does not handle
+func extensionProblems() (problems []string) {
+	for _, ext := range audioExtensions {
+		if utils.InArray(ext, pictureExtensions) || utils.InArray(ext, movieExtensions) {
+			problems = append(problems, "-audio-exts lists "+ext+" which is already handled as a picture or movie")
+		}
+	}
+	for _, ext := range preferredFormats {
+		if mediaCategory("file."+ext) == "" {
+			problems = append(problems, "-prefer-format lists "+ext+" which is not a media extension")
+		}
+	}
+	for ext := range canonicalExtensions {
+		if mediaCategory("file."+ext) == "" {
+			problems = append(problems, "-canonical-ext maps "+ext+" which is not a media extension")
+		}
+	}
+	return
+}
+
+// backupProblems reports why -backup of dir would fail before copying anything.  With processedOnly only media files are counted, an upper bound of what gets copied
+func backupProblems(dir string, processedOnly bool) (problems []string) {
+	backupDir := backupPath(dir)
+	if _, err := os.Stat(backupDir); err == nil && !backupInterrupted(backupDir) {
+		problems = append(problems, backupDir+" already exists, remove it or move it out of the way")
+	}
+	files, err := RecurseFiles(dir, nil)
+	if err != nil {
+		return append(problems, "Could not list "+dir+": "+err.Error())
+	}
+	var copied []string
+	for _, file := range files {
+		if !processedOnly || mediaCategory(file) != "" {
+			copied = append(copied, file)
+		}
+	}
+	if err := checkFreeSpace(backupDir, copied); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return
+}
+
+// lockProblems reports locks held by another run
+func lockProblems() (problems []string) {
+	if sequenceState == "" {
+		return
+	}
+	if _, err := os.Stat(sequenceLock()); err == nil {
+		problems = append(problems, sequenceLock()+" exists, another run is using "+sequenceState+".  Remove the lock if no other run is going")
+	}
+	return
+}
+
+// preflightReport lists problems as -preflight prints them
+func preflightReport(problems []string) string {
+	if len(problems) == 0 {
+		return "Preflight passed, nothing was changed"
+	}
+	found := extensions.IntToString(len(problems)) + " problems"
+	if len(problems) == 1 {
+		found = "1 problem"
+	}
+	return "Preflight found " + found + ":\n  " + strings.Join(problems, "\n  ")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatProblems(t *testing.T) {
+	restoreAfterTest(t, &fmtDesired, &imageTemplate, &videoTemplate, &audioTemplate, &dateOnlyFormat)
+	tests := []struct {
+		name    string
+		format  string
+		problem string
+	}{
+		{"default format", "2006-01-02 15.04.05", ""},
+		{"sequence numbers", "20060102 {seq}", ""},
+		{"weekday only", "Monday", "The format Monday can not be read back"},
+	}
+	for _, test := range tests {
+		fmtDesired, imageTemplate, videoTemplate, audioTemplate, dateOnlyFormat = test.format, "", "", "", ""
+		problems := formatProblems()
+		if test.problem == "" && len(problems) > 0 || test.problem != "" && (len(problems) != 1 || !strings.HasPrefix(problems[0], test.problem)) {
+			t.Errorf("%s: formatProblems() = %q, want %q", test.name, problems, test.problem)
+		}
+	}
+	fmtDesired, videoTemplate = "2006-01-02 15.04.05", "Monday"
+	if problems := formatProblems(); len(problems) != 1 || !strings.HasPrefix(problems[0], "The -video-template Monday") {
+		t.Errorf("formatProblems() = %q, want the -video-template reported", problems)
+	}
+}
+
+func TestExtensionProblems(t *testing.T) {
+	restoreAfterTest(t, &audioExtensions, &preferredFormats)
+	restoreAfterTest(t, &canonicalExtensions)
+	tests := []struct {
+		name      string
+		audio     []string
+		preferred []string
+		canonical map[string]string
+		problem   string
+	}{
+		{"sane lists", []string{"M4A"}, []string{"HEIC", "JPG"}, map[string]string{"JPEG": "jpg"}, ""},
+		{"audio extension already a movie", []string{"MP4"}, nil, nil, "-audio-exts lists MP4"},
+		{"preferred format not media", nil, []string{"HEIC", "TXT"}, nil, "-prefer-format lists TXT"},
+		{"canonical extension not media", nil, nil, map[string]string{"DOC": "docx"}, "-canonical-ext maps DOC"},
+	}
+	for _, test := range tests {
+		audioExtensions, preferredFormats, canonicalExtensions = test.audio, test.preferred, test.canonical
+		problems := extensionProblems()
+		if test.problem == "" && len(problems) > 0 || test.problem != "" && (len(problems) != 1 || !strings.HasPrefix(problems[0], test.problem)) {
+			t.Errorf("%s: extensionProblems() = %q, want %q", test.name, problems, test.problem)
+		}
+	}
+}
+
+func TestLockProblems(t *testing.T) {
+	restoreAfterTest(t, &sequenceState)
+	sequenceState = ""
+	if problems := lockProblems(); len(problems) > 0 {
+		t.Errorf("lockProblems() without -sequence-state = %q", problems)
+	}
+	sequenceState = filepath.Join(t.TempDir(), "seq.json")
+	if problems := lockProblems(); len(problems) > 0 {
+		t.Errorf("lockProblems() without a lock = %q", problems)
+	}
+	writeTestFile(t, filepath.Dir(sequenceState), filepath.Base(sequenceLock()), nil)
+	if problems := lockProblems(); len(problems) != 1 || !strings.Contains(problems[0], "another run is using") {
+		t.Errorf("lockProblems() with a lock = %q", problems)
+	}
+}
+
+func TestBackupProblems(t *testing.T) {
+	restoreAfterTest(t, &minFreeBytes)
+	tests := []struct {
+		name         string
+		backupExists bool
+		minFree      int64
+		problem      string
+	}{
+		{"room for the backup", false, 0, ""},
+		{"backup already there", true, 0, "already exists"},
+		{"volume too small", false, 1 << 62, "Not enough free space"},
+	}
+	for _, test := range tests {
+		dir := filepath.Join(t.TempDir(), "photos")
+		writeTestFile(t, dir, "a.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+		if test.backupExists {
+			if err := os.Mkdir(backupPath(dir), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		minFreeBytes = test.minFree
+		problems := backupProblems(dir, false)
+		if test.problem == "" && len(problems) > 0 || test.problem != "" && (len(problems) != 1 || !strings.Contains(problems[0], test.problem)) {
+			t.Errorf("%s: backupProblems() = %q, want %q", test.name, problems, test.problem)
+		}
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "photos")
+	writeTestFile(t, dir, "a.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	output := mustRunMain(t, "-preflight", "-backup", dir)
+	if !strings.Contains(output, "Preflight passed") {
+		t.Errorf("clean preflight printed\n%s", output)
+	}
+	assertFiles(t, dir, "a.jpg")
+
+	// every failing check is listed in one report
+	if err := os.Mkdir(backupPath(dir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	state := filepath.Join(t.TempDir(), "seq.json")
+	writeTestFile(t, filepath.Dir(state), filepath.Base(state)+".lock", nil)
+	output, err := runMain(t, "-preflight", "-backup", "-sequence-state", state, "-image-template", "Monday", "-prefer-format", "heic,txt", dir, "2006-01-02 {seq}")
+	if err == nil {
+		t.Fatalf("preflight with problems exited 0\n%s", output)
+	}
+	for _, want := range []string{"Preflight found 4 problems:", "The -image-template Monday", "-prefer-format lists TXT", "another run is using", "already exists"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("preflight report lacks %q\n%s", want, output)
+		}
+	}
+	assertFiles(t, dir, "a.jpg")
+}
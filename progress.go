@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// progressEvery is set by -progress-every, how many files are processed between two progress lines.  0 turns them off
+var progressEvery int
+
+// progress counts the media files a run went through and logs how far along it is with an estimate of the time left
+type progress struct {
+	sync.Mutex
+	total int
+	done  int
+	start time.Time
+}
+
+// newProgress starts counting towards total files
+func newProgress(total int) *progress {
+	return &progress{total: total, start: time.Now()}
+}
+
+// step counts one more processed file and logs a progress line every progressEvery files
+func (p *progress) step() {
+	p.Lock()
+	defer p.Unlock()
+	p.done++
+	if progressEvery <= 0 || p.done%progressEvery != 0 && p.done != p.total {
+		return
+	}
+	line := "Processed " + extensions.IntToString(p.done) + "/" + extensions.IntToString(p.total) + " files"
+	if remaining := p.total - p.done; remaining > 0 {
+		elapsed := time.Since(p.start)
+		eta := time.Duration(float64(elapsed) / float64(p.done) * float64(remaining))
+		line += ", about " + eta.Round(time.Second).String() + " left"
+	}
+	log.Println(line)
+}
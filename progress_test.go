@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestProgressStep(t *testing.T) {
+	restoreAfterTest(t, &progressEvery)
+	saved := log.Writer()
+	t.Cleanup(func() { log.SetOutput(saved) })
+	tests := []struct {
+		every int
+		total int
+		want  []string
+	}{
+		{2, 5, []string{"Processed 2/5 files, about", "Processed 4/5 files, about", "Processed 5/5 files"}},
+		{10, 3, []string{"Processed 3/3 files"}},
+		{0, 3, nil},
+	}
+	for _, test := range tests {
+		var logged bytes.Buffer
+		log.SetOutput(&logged)
+		progressEvery = test.every
+		p := newProgress(test.total)
+		for i := 0; i < test.total; i++ {
+			p.step()
+		}
+		lines := strings.Split(strings.TrimSpace(logged.String()), "\n")
+		if logged.Len() == 0 {
+			lines = nil
+		}
+		if len(lines) != len(test.want) {
+			t.Errorf("every %d of %d: logged %q, want %q", test.every, test.total, lines, test.want)
+			continue
+		}
+		for i, want := range test.want {
+			if !strings.Contains(lines[i], want) {
+				t.Errorf("every %d of %d: line %q lacks %q", test.every, test.total, lines[i], want)
+			}
+		}
+		if len(lines) > 0 && strings.Contains(lines[len(lines)-1], "left") {
+			t.Errorf("every %d of %d: the last line has an estimate: %q", test.every, test.total, lines[len(lines)-1])
+		}
+	}
+}
+
+func TestProgressCountsFilesToRead(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	writeTestFile(t, dir, "2021-05-03 09.00.00.jpg", jpegWithExif(exifTiff("", "2021:05:03 09:00:00")))
+	writeTestFile(t, dir, "notes.txt", []byte("notes"))
+	output := mustRunMain(t, "-progress-every", "1", dir)
+	if !strings.Contains(output, "Processed 2/2 files") || strings.Contains(output, "/3 files") || strings.Contains(output, "/4 files") {
+		t.Errorf("progress does not count the two files to read:\n%s", output)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// psdExtensions are Photoshop documents, whose Exif sits in an image resource block instead of an APP1 segment
+var psdExtensions = []string{
+	"PSD",
+}
+
+// psdExifResource is the ID of the image resource holding Exif data 1, a Tiff structured Exif block
+const psdExifResource = 0x0422
+
+// psdExif returns the Tiff structured Exif stored in the image resources section of a Photoshop document
+func psdExif(data []byte) ([]byte, error) {
+	const headerSize = 26
+	if len(data) < headerSize+4 || string(data[:4]) != "8BPS" {
+		return nil, errors.New("Not a Photoshop document")
+	}
+	// the color mode data section comes first, then the image resources section
+	data = data[headerSize:]
+	colorModeSize := uint64(binary.BigEndian.Uint32(data))
+	if colorModeSize > uint64(len(data)-4) {
+		return nil, errors.New("Truncated color mode data")
+	}
+	data = data[4+colorModeSize:]
+	if len(data) < 4 {
+		return nil, errors.New("Truncated image resources")
+	}
+	resourcesSize := uint64(binary.BigEndian.Uint32(data))
+	if resourcesSize > uint64(len(data)-4) {
+		return nil, errors.New("Truncated image resources")
+	}
+	resources := data[4 : 4+resourcesSize]
+
+	for len(resources) >= 8 {
+		if string(resources[:4]) != "8BIM" {
+			return nil, errors.New("Invalid image resource signature")
+		}
+		id := binary.BigEndian.Uint16(resources[4:])
+		// the name is a Pascal string padded to an even size, length byte included
+		nameSize := (1 + int(resources[6]) + 1) &^ 1
+		r := resources[6:]
+		if nameSize+4 > len(r) {
+			return nil, errors.New("Truncated image resource")
+		}
+		size := uint64(binary.BigEndian.Uint32(r[nameSize:]))
+		r = r[nameSize+4:]
+		if size > uint64(len(r)) {
+			return nil, errors.New("Truncated image resource")
+		}
+		if id == psdExifResource {
+			if !isTiffHeader(r[:size]) {
+				return nil, errors.New("No Tiff header in the Exif resource")
+			}
+			return r[:size], nil
+		}
+		padded := size + size&1
+		if padded > uint64(len(r)) {
+			padded = uint64(len(r))
+		}
+		resources = r[padded:]
+	}
+	return nil, errors.New("No Exif resource")
+}
+
+func isTiffHeader(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPsdExif(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "layered.psd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	noExif := append([]byte{}, data...)
+	// renumber the Exif resource so only the caption resource is left to find
+	exifID := 26 + 4 + 4 + 16 + 4
+	noExif[exifID], noExif[exifID+1] = 0x04, 0x24
+	tests := []struct {
+		name string
+		data []byte
+		fail bool
+	}{
+		{"exif after an odd sized resource", data, false},
+		{"no exif resource", noExif, true},
+		{"truncated resources", data[:60], true},
+		{"not a photoshop document", jpegWithExif(exifTiff("", "2019:11:12 13:14:15")), true},
+	}
+	for _, test := range tests {
+		tiffData, err := psdExif(test.data)
+		if (err != nil) != test.fail {
+			t.Errorf("%s: psdExif error %v, want failure %v", test.name, err, test.fail)
+			continue
+		}
+		if !test.fail && !isTiffHeader(tiffData) {
+			t.Errorf("%s: psdExif returned % x, want a Tiff header", test.name, tiffData[:4])
+		}
+	}
+}
+
+func TestPsdRenamed(t *testing.T) {
+	dir := t.TempDir()
+	copyTestdata(t, dir, "layered.psd", "layered.psd")
+	mustRunMain(t, dir)
+	assertFiles(t, dir, "2019-11-12 13.14.15.psd")
+}
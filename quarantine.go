@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// quarantineDir is where -quarantine-dir moves files that failed or have no date, "" leaves them in place
+var quarantineDir string
+
+// quarantinable reports whether a result is a file -quarantine-dir moves away: one whose metadata could not be read, listed in unreadable, or held no date.  Files which only failed to be renamed, such as every file of a rolled back -atomic run, are left in place
+func quarantinable(result fileResult, unreadable map[string]bool) bool {
+	return result.Status == statusFailed && unreadable[result.Path] || result.Status == statusSkipped && result.Reason == reasonNoDate
+}
+
+// quarantineFiles moves every file of mediaFiles under root whose metadata could not be read or held no date into quarantineDir keeping its relative path, records where it went and returns a report of the moves
+func quarantineFiles(root string, mediaFiles []*mediaFile) string {
+	unreadable := make(map[string]bool)
+	for _, mf := range mediaFiles {
+		if mf.Err != nil {
+			unreadable[mf.Path] = true
+		}
+	}
+	results.Lock()
+	defer results.Unlock()
+	var lines []string
+	for i, result := range results.Items {
+		if !quarantinable(result, unreadable) || !extensions.DoesFileExist(result.Path) {
+			continue
+		}
+		newName, err := moveInto(root, quarantineDir, result.Path)
+		if err != nil {
+			stdErr.Println("Could not quarantine " + result.Path + ": " + err.Error())
+			continue
+		}
+		renameSidecars(result.Path, newName)
+		results.Items[i].NewPath = newName
+		lines = append(lines, "  "+result.Path+" -> "+newName)
+	}
+	if len(lines) == 0 {
+		return "Quarantined no files"
+	}
+	return "Quarantined " + extensions.IntToString(len(lines)) + " files to " + quarantineDir + ":\n" + strings.Join(lines, "\n")
+}
+
+// inQuarantine reports whether path is inside quarantineDir, which is skipped when it sits in the processed directory
+func inQuarantine(path string) bool {
+	if quarantineDir == "" {
+		return false
+	}
+	dir, errDir := filepath.Abs(quarantineDir)
+	file, errFile := filepath.Abs(path)
+	if errDir != nil || errFile != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, file)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
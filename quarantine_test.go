@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+func TestQuarantineDir(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	quarantine := filepath.Join(root, "quarantine")
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	noDate := writeTestFile(t, dir, "trip/IMG_0002.jpg", jpegWithExif(exifTiff("", "")))
+	writeTestFile(t, dir, "trip/IMG_0002.AAE", []byte("<plist/>"))
+	corrupt := writeTestFile(t, dir, "IMG_0003.jpg", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x10, 'E', 'x', 'i', 'f', 0, 0, 'M', 'M', 0, 42, 0xFF, 0xFF})
+	writeTestFile(t, dir, "notes.txt", []byte("notes"))
+	output := mustRunMain(t, "-quarantine-dir", quarantine, dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg", "notes.txt")
+	assertFiles(t, quarantine, "IMG_0003.jpg", "trip/IMG_0002.AAE", "trip/IMG_0002.jpg")
+	for _, want := range []string{
+		"Quarantined 2 files to " + quarantine + ":",
+		"  " + noDate + " -> " + filepath.Join(quarantine, "trip", "IMG_0002.jpg"),
+		"  " + corrupt + " -> " + filepath.Join(quarantine, "IMG_0003.jpg"),
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output lacks %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestQuarantineInsideDirIsSkipped(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "")))
+	quarantine := filepath.Join(dir, "quarantine")
+	mustRunMain(t, "-quarantine-dir", quarantine, dir)
+	assertFiles(t, dir, "quarantine/IMG_0001.jpg")
+	// the next run leaves the quarantined file where it is
+	output := mustRunMain(t, "-quarantine-dir", quarantine, dir)
+	assertFiles(t, dir, "quarantine/IMG_0001.jpg")
+	if !strings.Contains(output, "Quarantined no files") {
+		t.Errorf("output lacks the empty report:\n%s", output)
+	}
+}
+
+func TestQuarantinable(t *testing.T) {
+	unreadable := map[string]bool{"broken.jpg": true, "undated.jpg": true}
+	tests := []struct {
+		name   string
+		result fileResult
+		want   bool
+	}{
+		{"metadata could not be read", fileResult{Path: "broken.jpg", Status: statusFailed}, true},
+		{"no date with -require-date", fileResult{Path: "undated.jpg", Status: statusFailed}, true},
+		{"no date", fileResult{Path: "undated.jpg", Status: statusSkipped, Reason: reasonNoDate}, true},
+		{"rename failed", fileResult{Path: "IMG_0001.jpg", Status: statusFailed}, false},
+		{"already named", fileResult{Path: "2021-05-01 12.30.00.jpg", Status: statusSkipped, Reason: reasonFormatted}, false},
+		{"renamed", fileResult{Path: "IMG_0002.jpg", Status: statusRenamed}, false},
+	}
+	for _, test := range tests {
+		if got := quarantinable(test.result, unreadable); got != test.want {
+			t.Errorf("%s: quarantinable = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestQuarantineLeavesRolledBackFiles(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	quarantine := filepath.Join(root, "quarantine")
+	photo := jpegWithExif(exifTiff("", "2021:05:01 12:30:00"))
+	var want []string
+	// twelve photos of one second need more suffixes than _%01d has, the whole -atomic run is rolled back
+	for i := 1; i <= 12; i++ {
+		name := "IMG_" + extensions.IntToString(100+i) + ".jpg"
+		writeTestFile(t, dir, name, photo)
+		want = append(want, name)
+	}
+	writeTestFile(t, dir, "other.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	writeTestFile(t, dir, "undated.jpg", jpegWithExif(exifTiff("", "")))
+	output, _ := runMain(t, "-atomic", "-collision-format", "_%01d", "-quarantine-dir", quarantine, dir)
+	if !strings.Contains(output, "Rolled back") {
+		t.Fatalf("the run was not rolled back:\n%s", output)
+	}
+	assertFiles(t, dir, append(want, "other.jpg")...)
+	assertFiles(t, quarantine, "undated.jpg")
+}
+
+func TestQuarantineOutsideBackup(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	quarantine := filepath.Join(root, "quarantine")
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "undated.jpg", jpegWithExif(exifTiff("", "")))
+	// the quarantined file left the directory but is still one of its files
+	output := mustRunMain(t, "-backup", "-strict", "-quarantine-dir", quarantine, dir)
+	if !strings.Contains(output, "File counts match, removed backup") {
+		t.Errorf("the backup did not match:\n%s", output)
+	}
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg")
+	assertFiles(t, quarantine, "undated.jpg")
+}
+
+func TestMoveFile(t *testing.T) {
+	// /dev/shm is a memory file system on Linux, another volume than the temporary folder
+	otherVolume, err := os.MkdirTemp("/dev/shm", "quarantine")
+	if err != nil {
+		t.Skip("no second volume to move to: " + err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(otherVolume) })
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{"same volume", filepath.Join(t.TempDir(), "IMG_0001.jpg")},
+		{"other volume", filepath.Join(otherVolume, "IMG_0001.jpg")},
+	}
+	taken := time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)
+	for _, test := range tests {
+		file := writeTestFile(t, t.TempDir(), "IMG_0001.jpg", []byte("photo"))
+		if err := os.Chtimes(file, taken, taken); err != nil {
+			t.Fatal(err)
+		}
+		if err := moveFile(file, test.target); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s: %s is left behind", test.name, file)
+		}
+		info, err := os.Stat(test.target)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if data, _ := os.ReadFile(test.target); string(data) != "photo" || !info.ModTime().Equal(taken) {
+			t.Errorf("%s: %s holds %q modified %v", test.name, test.target, data, info.ModTime())
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// rawExtensions are camera RAW formats which embed a full size JPEG preview carrying the same Exif as the RAW
+var rawExtensions = []string{
+	"CR2", "NEF", "ARW",
+}
+
+// maxEmbeddedPreviews bounds how many JPEG start markers embeddedJPEGTime tries, RAW files hold a handful of previews and thumbnails
+const maxEmbeddedPreviews = 16
+
+var jpegStart = []byte{0xFF, 0xD8, 0xFF}
+
+// embeddedJPEGTime looks for JPEG previews inside the bytes of a RAW file and returns the capture time from the first one whose Exif holds a date
+func embeddedJPEGTime(data []byte, fileWork string) (mediaTime, *exif.Exif, bool) {
+	offset := 0
+	for tries := 0; tries < maxEmbeddedPreviews; tries++ {
+		i := bytes.Index(data[offset:], jpegStart)
+		if i == -1 {
+			break
+		}
+		start := offset + i
+		offset = start + len(jpegStart)
+		x, err := exif.Decode(bytes.NewReader(data[start:]))
+		if err != nil {
+			continue
+		}
+		if mt, err := exifTime(x, fileWork); err == nil {
+			mt.Source = sourceRawPreview + mt.Source
+			return mt, x, true
+		}
+	}
+	return mediaTime{}, nil, false
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmbeddedJPEGTime(t *testing.T) {
+	readFixture := func(fixture string) []byte {
+		data, err := os.ReadFile(filepath.Join("testdata", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		// a Tiff header pointing past the end of the file, then junk holding a stray JPEG marker, then the preview
+		{"broken tiff", readFixture("broken-tiff-preview.cr2"), "2017:08:09 10:11:12"},
+		{"undated tiff", readFixture("undated-tiff-preview.nef"), "2017:08:09 10:11:12"},
+		{"no preview", buildTiff(testIFD{fields: []tiffEntry{asciiEntry(0x010F, "Nikon")}}), ""},
+	}
+	for _, test := range tests {
+		mt, _, ok := embeddedJPEGTime(test.data, test.name)
+		if ok != (test.want != "") {
+			t.Errorf("%s: embeddedJPEGTime found a date %v, want %q", test.name, ok, test.want)
+			continue
+		}
+		if got := mt.Time.Format(exifDateLayout); ok && (got != test.want || mt.Source != sourceRawPreview+"DateTimeOriginal") {
+			t.Errorf("%s: embeddedJPEGTime = %s from %s, want %s from the preview's DateTimeOriginal", test.name, got, mt.Source, test.want)
+		}
+	}
+}
+
+func TestRawPreviewRenames(t *testing.T) {
+	dir := t.TempDir()
+	copyTestdata(t, dir, "broken-tiff-preview.cr2", "IMG_0001.CR2")
+	copyTestdata(t, dir, "undated-tiff-preview.nef", "DSC_0002.NEF")
+	writeTestFile(t, dir, "DSC_0003.NEF", buildTiff(testIFD{fields: []tiffEntry{asciiEntry(0x010F, "Nikon")}}))
+	mustRunMain(t, dir)
+	assertFiles(t, dir, "2017-08-09 10.11.12.CR2", "2017-08-09 10.11.12.NEF", "DSC_0003.NEF")
+}
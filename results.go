@@ -0,0 +1,226 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+const (
+	statusRenamed = "renamed"
+	statusSkipped = "skipped"
+	statusMoved   = "moved"
+	// statusLinked files were replaced by a link to an identical file, see -dedupe-link
+	statusLinked = "linked"
+	statusFailed = "failed"
+)
+
+// Reasons a file was skipped or moved instead of renamed
+const (
+	reasonFormatted = "already-formatted"
+	reasonNoDate    = "no-date"
+	reasonDuplicate = "duplicate"
+	// reasonLink files are symlinks to, or hardlinks of, another file of the processed directory
+	reasonLink = "link"
+	// reasonExternalLink files are symlinks to files outside the processed directory, see -follow-symlinks
+	reasonExternalLink = "external-link"
+	// reasonNotCorrupted files have no collision suffix chain for -repair to collapse
+	reasonNotCorrupted = "not-corrupted"
+	// reasonTargetExists and reasonTargetLarger files would collide with a file already in the library, see -skip-if-exists and -skip-if-target-larger
+	reasonTargetExists = "target-exists"
+	reasonTargetLarger = "target-larger"
+	// reasonDeclined files were not renamed because the answer to -interactive was no
+	reasonDeclined = "declined"
+	// reasonOutOfRange files were taken before -since or after -until
+	reasonOutOfRange = "out-of-range"
+)
+
+// fileResult records what a run did with one file
+type fileResult struct {
+	Path    string
+	NewPath string
+	Status  string
+	Reason  string
+	Err     error
+}
+
+func (r fileResult) skipped(reason string) fileResult {
+	r.Status = statusSkipped
+	r.Reason = reason
+	return r
+}
+
+func (r fileResult) failed(err error) fileResult {
+	r.Status = statusFailed
+	r.Err = err
+	return r
+}
+
+// maxErrorDetails is how many failures keep their error, set by -max-error-details.  Later failures are only counted by category so a directory failing file after file does not pile up error text
+var maxErrorDetails = 1000
+
+// maxErrorCategories bounds the categories overflowing failures are counted in, the rest count as other
+const maxErrorCategories = 100
+
+// runResults collects the fileResult of every file seen during a run, workers add to it concurrently
+type runResults struct {
+	sync.Mutex
+	Items []fileResult
+	// renamedTo holds the NewPath of every result
+	renamedTo map[string]bool
+	// detailedErrors counts the failures whose Err was kept, overflow counts the others by errorCategory
+	detailedErrors int
+	overflow       map[string]int
+}
+
+var results runResults
+
+// errorCategory names the kind of a failure without the file it happened to, e.g. "Could not exif.Decode" for "Could not exif.Decode /photos/a.jpg: EOF"
+func errorCategory(result fileResult) string {
+	message := result.Err.Error()
+	message = strings.ReplaceAll(message, result.Path, "")
+	message = strings.ReplaceAll(message, filepath.Base(result.Path), "")
+	if i := strings.Index(message, ":"); i >= 0 {
+		message = message[:i]
+	}
+	return strings.TrimSpace(message)
+}
+
+func (r *runResults) add(result fileResult) {
+	if explain {
+		log.Println(explanation(result))
+	}
+	r.Lock()
+	if result.Err != nil {
+		if r.detailedErrors < maxErrorDetails {
+			r.detailedErrors++
+		} else {
+			if r.overflow == nil {
+				r.overflow = make(map[string]int)
+			}
+			category := errorCategory(result)
+			if _, ok := r.overflow[category]; !ok && len(r.overflow) >= maxErrorCategories {
+				category = "other"
+			}
+			r.overflow[category]++
+			result.Err = nil
+		}
+	}
+	r.Items = append(r.Items, result)
+	if result.NewPath != "" {
+		if r.renamedTo == nil {
+			r.renamedTo = make(map[string]bool)
+		}
+		r.renamedTo[result.NewPath] = true
+	}
+	r.Unlock()
+}
+
+// producedInRun reports whether path is the new name of a file of this run
+func (r *runResults) producedInRun(path string) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.renamedTo[path]
+}
+
+// count returns how many results have the given status
+func (r *runResults) count(status string) (total int) {
+	r.Lock()
+	defer r.Unlock()
+	for _, result := range r.Items {
+		if result.Status == status {
+			total++
+		}
+	}
+	return
+}
+
+func (r *runResults) summary() string {
+	line := "Renamed " + extensions.IntToString(r.count(statusRenamed)) +
+		", skipped " + extensions.IntToString(r.count(statusSkipped))
+	if moved := r.count(statusMoved); moved > 0 {
+		line += ", moved " + extensions.IntToString(moved)
+	}
+	if linked := r.count(statusLinked); linked > 0 {
+		line += ", linked " + extensions.IntToString(linked)
+	}
+	return line + ", failed " + extensions.IntToString(r.count(statusFailed)) + " of " + extensions.IntToString(len(r.Items)) + " files"
+}
+
+// relocated counts the files renamed into another folder than the one they were in
+func (r *runResults) relocated() (total int) {
+	r.Lock()
+	defer r.Unlock()
+	for _, result := range r.Items {
+		if result.Status == statusRenamed && filepath.Dir(result.NewPath) != filepath.Dir(result.Path) {
+			total++
+		}
+	}
+	return
+}
+
+// skipReasons counts skipped files by their reason
+func (r *runResults) skipReasons() map[string]int {
+	r.Lock()
+	defer r.Unlock()
+	reasons := make(map[string]int)
+	for _, result := range r.Items {
+		if result.Status == statusSkipped {
+			reasons[result.Reason]++
+		}
+	}
+	return reasons
+}
+
+// skipReasonBreakdown lists skip reasons from most to least common
+func (r *runResults) skipReasonBreakdown() string {
+	reasons := r.skipReasons()
+	names := make([]string, 0, len(reasons))
+	for reason := range reasons {
+		names = append(names, reason)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if reasons[names[i]] != reasons[names[j]] {
+			return reasons[names[i]] > reasons[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	lines := []string{"Skipped files by reason:"}
+	if len(names) == 0 {
+		lines = append(lines, "  none")
+	}
+	for _, reason := range names {
+		lines = append(lines, "  "+reason+": "+extensions.IntToString(reasons[reason]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// errorOverflow lists, by category, the failures which did not keep their error because of -max-error-details.  It is empty when every failure kept its error
+func (r *runResults) errorOverflow() string {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.overflow) == 0 {
+		return ""
+	}
+	categories := make([]string, 0, len(r.overflow))
+	total := 0
+	for category, count := range r.overflow {
+		categories = append(categories, category)
+		total += count
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if r.overflow[categories[i]] != r.overflow[categories[j]] {
+			return r.overflow[categories[i]] > r.overflow[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+	lines := []string{extensions.IntToString(total) + " failures after the first " + extensions.IntToString(r.detailedErrors) + " were only counted:"}
+	for _, category := range categories {
+		lines = append(lines, "  "+category+": "+extensions.IntToString(r.overflow[category]))
+	}
+	return strings.Join(lines, "\n")
+}
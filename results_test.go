@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+func TestSkipReasonBreakdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []fileResult
+		want  string
+	}{
+		{"none", []fileResult{{Path: "a.jpg", Status: statusRenamed}}, "Skipped files by reason:\n  none"},
+		{
+			"most common first, ties by name",
+			[]fileResult{
+				{Path: "a.jpg", Status: statusSkipped, Reason: reasonNoDate},
+				{Path: "b.jpg", Status: statusSkipped, Reason: reasonFormatted},
+				{Path: "c.jpg", Status: statusSkipped, Reason: reasonFormatted},
+				{Path: "d.jpg", Status: statusSkipped, Reason: reasonDuplicate},
+				{Path: "e.jpg", Status: statusRenamed},
+				{Path: "f.jpg", Status: statusFailed, Err: errors.New("Could not Open f.jpg")},
+			},
+			"Skipped files by reason:\n  already-formatted: 2\n  duplicate: 1\n  no-date: 1",
+		},
+	}
+	for _, test := range tests {
+		var r runResults
+		for _, item := range test.items {
+			r.add(item)
+		}
+		if got := r.skipReasonBreakdown(); got != test.want {
+			t.Errorf("%s: skipReasonBreakdown =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestReportSkippedReasons(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "2021-05-01 12.30.00.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "2021-05-02 12.30.00.jpg", jpegWithExif(exifTiff("", "2021:05:02 12:30:00")))
+	writeTestFile(t, dir, "no date.jpg", jpegWithExif(buildTiff(testIFD{fields: []tiffEntry{asciiEntry(0x010F, "Canon")}})))
+	writeTestFile(t, dir, "old.jpg", jpegWithExif(exifTiff("", "2010:01:01 08:00:00")))
+	writeTestFile(t, dir, "new.jpg", jpegWithExif(exifTiff("", "2021:06:01 08:00:00")))
+	output := mustRunMain(t, "-report-skipped-reasons", "-since", "2020-01-01", dir)
+	want := "Skipped files by reason:\n  already-formatted: 2\n  no-date: 1\n  out-of-range: 1"
+	if !strings.Contains(output, want) {
+		t.Errorf("output does not hold\n%s\n%s", want, output)
+	}
+	assertFiles(t, dir, "2021-05-01 12.30.00.jpg", "2021-05-02 12.30.00.jpg", "2021-06-01 08.00.00.jpg", "no date.jpg", "old.jpg")
+}
+
+func TestErrorOverflow(t *testing.T) {
+	restoreAfterTest(t, &maxErrorDetails)
+	maxErrorDetails = 3
+	var r runResults
+	for i := 0; i < 4; i++ {
+		name := "dir/open" + extensions.IntToString(i) + ".jpg"
+		r.add(fileResult{Path: name, Status: statusFailed, Err: errors.New("Could not Open " + name + ": permission denied")})
+	}
+	for i := 0; i < 6; i++ {
+		name := "dir/decode" + extensions.IntToString(i) + ".jpg"
+		r.add(fileResult{Path: name, Status: statusFailed, Err: errors.New("Could not exif.Decode " + name + ": EOF")})
+	}
+	r.add(fileResult{Path: "dir/ok.jpg", Status: statusRenamed, NewPath: "dir/2021-05-01 12.30.00.jpg"})
+
+	kept := 0
+	for _, item := range r.Items {
+		if item.Err != nil {
+			kept++
+		}
+	}
+	if kept != 3 {
+		t.Errorf("%d failures kept their error, want 3", kept)
+	}
+	if got, want := r.summary(), "Renamed 1, skipped 0, failed 10 of 11 files"; got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+	want := "7 failures after the first 3 were only counted:\n  Could not exif.Decode: 6\n  Could not Open: 1"
+	if got := r.errorOverflow(); got != want {
+		t.Errorf("errorOverflow =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestErrorOverflowCategoriesBounded(t *testing.T) {
+	restoreAfterTest(t, &maxErrorDetails)
+	maxErrorDetails = 0
+	var r runResults
+	failures := maxErrorCategories + 5
+	for i := 0; i < failures; i++ {
+		r.add(fileResult{Path: "a.jpg", Status: statusFailed, Err: errors.New("Failure " + extensions.IntToString(i))})
+	}
+	if len(r.overflow) != maxErrorCategories+1 || r.overflow["other"] != 5 {
+		t.Errorf("%d categories with %d other, want %d with 5", len(r.overflow), r.overflow["other"], maxErrorCategories+1)
+	}
+	if !strings.HasPrefix(r.errorOverflow(), extensions.IntToString(failures)+" failures after the first 0") {
+		t.Errorf("errorOverflow does not account for all %d failures:\n%s", failures, r.errorOverflow())
+	}
+}
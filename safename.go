@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Set by -safe-charset and -safe-substitute.  safeCharAllowed is nil when names are not restricted beyond unsafeNameChars
+var (
+	safeCharAllowed func(r rune) bool
+	safeSubstitute  = "_"
+)
+
+// windowsReserved are the characters NTFS and exFAT do not allow in names, next to control characters
+const windowsReserved = `<>:"/\|?*`
+
+// parseSafeCharset reads a -safe-charset value: ntfs, exfat, portable (the POSIX portable file name characters A-Z a-z 0-9 . _ -) or custom:<chars> for ASCII letters and digits plus chars
+func parseSafeCharset(value string) (func(r rune) bool, error) {
+	asciiAlphanumeric := func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+	}
+	switch {
+	case value == "":
+		return nil, nil
+	case value == "ntfs", value == "exfat":
+		return func(r rune) bool {
+			return r >= 0x20 && r != 0x7F && !strings.ContainsRune(windowsReserved, r)
+		}, nil
+	case value == "portable":
+		return func(r rune) bool {
+			return asciiAlphanumeric(r) || strings.ContainsRune("._-", r)
+		}, nil
+	case strings.HasPrefix(value, "custom:"):
+		chars := strings.TrimPrefix(value, "custom:")
+		return func(r rune) bool {
+			return asciiAlphanumeric(r) || strings.ContainsRune(chars, r)
+		}, nil
+	}
+	return nil, errors.New("Invalid -safe-charset " + value + ", use ntfs, exfat, portable or custom:<chars>")
+}
+
+// safeName replaces the characters of name -safe-charset does not allow with -safe-substitute
+func safeName(name string) string {
+	if safeCharAllowed == nil {
+		return name
+	}
+	var safe strings.Builder
+	for _, r := range name {
+		if safeCharAllowed(r) {
+			safe.WriteRune(r)
+		} else {
+			safe.WriteString(safeSubstitute)
+		}
+	}
+	return safe.String()
+}
+
+// safeLayout applies safeName to the literal text of a Go time layout, leaving its elements alone, so names formatted with it can still be parsed with it
+func safeLayout(layout string) string {
+	if safeCharAllowed == nil {
+		return layout
+	}
+	var safe strings.Builder
+	for i := 0; i < len(layout); {
+		if size := layoutElementSize(layout[i:]); size > 0 {
+			safe.WriteString(layout[i : i+size])
+			i += size
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(layout[i:])
+		safe.WriteString(safeName(layout[i : i+size]))
+		i += size
+	}
+	return safe.String()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeName(t *testing.T) {
+	restoreAfterTest(t, &safeCharAllowed)
+	restoreAfterTest(t, &safeSubstitute)
+	// a space, the Windows reserved characters, a control character, DEL, a non-ASCII letter and the edges of printable ASCII
+	const boundary = "a b:c\"d|e?f*g<h>i\\j\x1fk\x7flém!n~o+p_q-r.jpg"
+	tests := []struct {
+		charset    string
+		substitute string
+		want       string
+	}{
+		{"", "_", boundary},
+		{"ntfs", "_", "a b_c_d_e_f_g_h_i_j_k_lém!n~o+p_q-r.jpg"},
+		{"exfat", "-", "a b-c-d-e-f-g-h-i-j-k-lém!n~o+p_q-r.jpg"},
+		{"portable", "_", "a_b_c_d_e_f_g_h_i_j_k_l_m_n_o_p_q-r.jpg"},
+		{"portable", "", "abcdefghijklmnop_q-r.jpg"},
+		{"custom: !", "_", "a b_c_d_e_f_g_h_i_j_k_l_m!n_o_p_q_r_jpg"},
+	}
+	for _, test := range tests {
+		allowed, err := parseSafeCharset(test.charset)
+		if err != nil {
+			t.Fatalf("parseSafeCharset(%q): %v", test.charset, err)
+		}
+		safeCharAllowed, safeSubstitute = allowed, test.substitute
+		if got := safeName(boundary); got != test.want {
+			t.Errorf("-safe-charset %q -safe-substitute %q: safeName = %q, want %q", test.charset, test.substitute, got, test.want)
+		}
+	}
+	if _, err := parseSafeCharset("fat32"); err == nil {
+		t.Error("parseSafeCharset(fat32) did not fail")
+	}
+}
+
+func TestSafeLayout(t *testing.T) {
+	restoreAfterTest(t, &safeCharAllowed)
+	safeCharAllowed, _ = parseSafeCharset("portable")
+	if got, want := safeLayout("2006-01-02 15:04:05 Jan"), "2006-01-02_15_04_05_Jan"; got != want {
+		t.Errorf("safeLayout = %q, want %q", got, want)
+	}
+}
+
+func TestSafeCharsetNames(t *testing.T) {
+	tests := []struct {
+		charset string
+		want    string
+	}{
+		{"ntfs", "2021-05-01 12.30.00 Trip_ A_B.jpg"},
+		{"portable", "2021-05-01_12.30.00_Trip__A_B.jpg"},
+		{"custom:-._ ", "2021-05-01 12.30.00 Trip_ A_B.jpg"},
+	}
+	for _, test := range tests {
+		t.Run(test.charset, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "Trip: A|B")
+			writeTestFile(t, dir, "a.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+			mustRunMain(t, "-safe-charset", test.charset, dir, "2006-01-02 15.04.05 {dir}")
+			assertFiles(t, dir, test.want)
+		})
+	}
+}
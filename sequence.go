@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// sequenceWidth is how many digits {seq} is zero padded to
+const sequenceWidth = 4
+
+// Sequence numbering state, -sequence-state keeps lastSequence between runs
+var (
+	sequenceState string
+	lastSequence  int
+)
+
+// sequenceToken renders a sequence number zero padded to sequenceWidth
+func sequenceToken(seq int) string {
+	value := extensions.IntToString(seq)
+	if len(value) < sequenceWidth {
+		value = strings.Repeat("0", sequenceWidth-len(value)) + value
+	}
+	return value
+}
+
+// usesSequence reports whether any naming format holds {seq}
+func usesSequence() bool {
+	for _, format := range []string{fmtDesired, imageTemplate, videoTemplate, audioTemplate, dateOnlyFormat} {
+		for _, segment := range splitNameFormat(format) {
+			if segment.token == "seq" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// assignSequence numbers media files in capture order, continuing after lastSequence.  Files already named after the format keep the number in their name
+func assignSequence(mediaFiles []*mediaFile) {
+	var unnumbered []*mediaFile
+	for _, mf := range mediaFiles {
+		if mf.Err != nil {
+			continue
+		}
+		fileName := strings.TrimSuffix(filepath.Base(mf.Path), filepath.Ext(mf.Path))
+		if _, tokens, ok := parseNameTokens(mediaFormat(mf), fileName, mf.Path); ok {
+			if seq, err := strconv.Atoi(tokens["seq"]); err == nil {
+				mf.Seq = seq
+				continue
+			}
+		}
+		unnumbered = append(unnumbered, mf)
+	}
+	sort.SliceStable(unnumbered, func(i, j int) bool {
+		a, b := captureInstant(unnumbered[i].mediaTime), captureInstant(unnumbered[j].mediaTime)
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return unnumbered[i].Path < unnumbered[j].Path
+	})
+	for _, mf := range unnumbered {
+		lastSequence++
+		mf.Seq = lastSequence
+	}
+}
+
+// sequenceLock is the lock file guarding the -sequence-state file against a second run using it at the same time
+func sequenceLock() string {
+	return sequenceState + ".lock"
+}
+
+// loadSequenceState locks the -sequence-state file and reads the last number used from it.  A missing file starts at 0
+func loadSequenceState() error {
+	lock, err := os.OpenFile(sequenceLock(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return errors.New(sequenceLock() + " exists, another run is using " + sequenceState + ".  Remove the lock if no other run is going")
+		}
+		return err
+	}
+	lock.WriteString(extensions.IntToString(os.Getpid()) + "\n")
+	lock.Close()
+
+	data, err := os.ReadFile(sequenceState)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil {
+		lastSequence, err = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	if err != nil {
+		releaseSequenceState()
+		return errors.New("Could not read " + sequenceState + ": " + err.Error())
+	}
+	return nil
+}
+
+// saveSequenceState writes the last number used, through a temporary file so a crash never leaves a half written state
+func saveSequenceState() error {
+	temp := sequenceState + ".tmp"
+	if err := os.WriteFile(temp, []byte(extensions.IntToString(lastSequence)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, sequenceState)
+}
+
+// releaseSequenceState removes the lock taken by loadSequenceState
+func releaseSequenceState() {
+	if err := os.Remove(sequenceLock()); err != nil && !os.IsNotExist(err) {
+		stdErr.Println("Could not remove " + sequenceLock() + ": " + err.Error())
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSequenceToken(t *testing.T) {
+	tests := map[int]string{1: "0001", 42: "0042", 9999: "9999", 12345: "12345"}
+	for seq, want := range tests {
+		if got := sequenceToken(seq); got != want {
+			t.Errorf("sequenceToken(%d) = %q, want %q", seq, got, want)
+		}
+	}
+}
+
+func TestSequenceContinuesAcrossRuns(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "export")
+	state := filepath.Join(root, "sequence.txt")
+	const format = "{seq} 2006-01-02"
+	// the later picture is walked first, numbers follow capture order
+	writeTestFile(t, dir, "a.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	writeTestFile(t, dir, "b.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	mustRunMain(t, "-sequence-state", state, dir, format)
+	assertFiles(t, dir, "0001 2021-05-01.jpg", "0002 2021-05-02.jpg")
+
+	writeTestFile(t, dir, "c.jpg", jpegWithExif(exifTiff("", "2020:01:01 00:00:00")))
+	mustRunMain(t, "-sequence-state", state, dir, format)
+	// numbered files keep their number, the new one continues after the last run
+	assertFiles(t, dir, "0001 2021-05-01.jpg", "0002 2021-05-02.jpg", "0003 2020-01-01.jpg")
+	if data, err := os.ReadFile(state); err != nil || strings.TrimSpace(string(data)) != "3" {
+		t.Errorf("%s holds %q, %v, want 3", state, data, err)
+	}
+	if _, err := os.Stat(state + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("the lock of %s is left behind", state)
+	}
+}
+
+func TestSequenceStateLocked(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "export")
+	state := filepath.Join(root, "sequence.txt")
+	writeTestFile(t, dir, "a.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	// another run holds the lock
+	writeTestFile(t, root, "sequence.txt.lock", []byte("1\n"))
+	output, err := runMain(t, "-sequence-state", state, dir, "{seq} 2006-01-02")
+	if err == nil || !strings.Contains(output, "another run is using "+state) {
+		t.Errorf("run with a locked state exited with %v:\n%s", err, output)
+	}
+	assertFiles(t, dir, "a.jpg")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// followSymlinks is set by -follow-symlinks, symlinked folders are then descended into and symlinks to files outside the directory are renamed like files
+var followSymlinks bool
+
+// walkFollowingLinks is filepath.Walk descending into symlinked folders too.  The folders visited are remembered by identity so a folder reached again, through a link pointing back up the tree or a second link to it, is not walked twice
+func walkFollowingLinks(root string, fn filepath.WalkFunc) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	var visited []os.FileInfo
+	err = walkFollowing(root, info, fn, &visited)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walkFollowing(path string, info os.FileInfo, fn filepath.WalkFunc, visited *[]os.FileInfo) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	for _, seen := range *visited {
+		if os.SameFile(seen, info) {
+			return nil
+		}
+	}
+	*visited = append(*visited, info)
+	if err := fn(path, info, nil); err != nil {
+		return err
+	}
+	dir, err := os.Open(path)
+	if err != nil {
+		return fn(path, info, err)
+	}
+	names, err := dir.Readdirnames(-1)
+	dir.Close()
+	if err != nil {
+		return fn(path, info, err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := filepath.Join(path, name)
+		childInfo, err := os.Stat(child)
+		if err != nil {
+			// a broken link is listed as the link itself
+			if childInfo, err = os.Lstat(child); err != nil {
+				if err := fn(child, nil, err); err != nil && err != filepath.SkipDir {
+					return err
+				}
+				continue
+			}
+		}
+		if err := walkFollowing(child, childInfo, fn, visited); err != nil {
+			if err == filepath.SkipDir {
+				if childInfo.IsDir() {
+					continue
+				}
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// linksOutsideRoot reports whether file is a symlink which does not point to a file under root, those are skipped unless -follow-symlinks is passed
+func linksOutsideRoot(root string, file string) bool {
+	info, err := os.Lstat(file)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return false
+	}
+	return !linksIntoRoot(root, file)
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+	"github.com/DanielRenne/GoCore/core/utils"
+)
+
+// Per category naming formats, an empty one falls back to fmtDesired
+var (
+	imageTemplate string
+	videoTemplate string
+	audioTemplate string
+)
+
+// devicePrefix is set by -device-prefix and put in front of every name, outside the time layout so it is never read as one
+var devicePrefix string
+
+const (
+	categoryImage = "image"
+	categoryVideo = "video"
+	categoryAudio = "audio"
+)
+
+// formatPresets are the naming formats -preset names, for those who would rather not write a Go time layout
+var formatPresets = []struct {
+	name   string
+	layout string
+}{
+	{"dropbox", "2006-01-02 15.04.05"},
+	{"iso", "2006-01-02T150405"},
+	{"compact", "20060102_150405"},
+	{"underscore", "2006_01_02_15_04_05"},
+	{"unix", "2006-01-02_15-04-05"},
+}
+
+// presetLayout returns the naming format of a -preset
+func presetLayout(name string) (string, bool) {
+	for _, preset := range formatPresets {
+		if preset.name == strings.ToLower(name) {
+			return preset.layout, true
+		}
+	}
+	return "", false
+}
+
+// presetNames lists the -preset names
+func presetNames() string {
+	var names []string
+	for _, preset := range formatPresets {
+		names = append(names, preset.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// presetUsage describes every -preset with the name it gives a photo taken 2021-05-01 12:30:00
+func presetUsage() string {
+	example := time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)
+	var presets []string
+	for _, preset := range formatPresets {
+		presets = append(presets, preset.name+" ("+example.Format(preset.layout)+".jpg)")
+	}
+	return strings.Join(presets, ", ")
+}
+
+// mediaCategory returns which kind of media file is by its extension, or "" when it is not processed
+func mediaCategory(file string) string {
+	ext := strings.ToUpper(strings.TrimPrefix(filepath.Ext(file), "."))
+	switch {
+	case utils.InArray(ext, pictureExtensions):
+		return categoryImage
+	case utils.InArray(ext, movieExtensions):
+		return categoryVideo
+	case utils.InArray(ext, audioExtensions):
+		return categoryAudio
+	}
+	return ""
+}
+
+// dateOnlyFormat is set by -date-only-format, the naming format of files whose metadata holds a day but no time of day
+var dateOnlyFormat string
+
+// mediaFormat returns the naming format for a media file whose metadata was read
+func mediaFormat(mf *mediaFile) string {
+	if mf.DateOnly && dateOnlyFormat != "" {
+		return dateOnlyFormat
+	}
+	return nameFormat(mf.Path)
+}
+
+// isFormattedName reports whether fileName (without extension) is already named after the format of file, or after -date-only-format, with or without a collision suffix
+func isFormattedName(fileName string, file string) bool {
+	names := []string{fileName}
+	// a file given a collision suffix by an earlier run is named too
+	if trimmed, ok := trimCollisionSuffix(fileName); ok {
+		names = append(names, trimmed)
+	}
+	for _, name := range names {
+		for _, format := range []string{nameFormat(file), dateOnlyFormat} {
+			if format == "" {
+				continue
+			}
+			if _, ok := parseName(format, name, file); ok {
+				return true
+			}
+			// files renamed before -keep-original-name was used have no original name left to keep
+			if trimmed := strings.TrimSuffix(format, originalNameSuffix); trimmed != format {
+				if _, ok := parseName(trimmed, name, file); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// nameFormat returns the naming format for file's category
+func nameFormat(file string) string {
+	format := ""
+	switch mediaCategory(file) {
+	case categoryImage:
+		format = imageTemplate
+	case categoryVideo:
+		format = videoTemplate
+	case categoryAudio:
+		format = audioTemplate
+	}
+	if format == "" {
+		return fmtDesired
+	}
+	return format
+}
+
+// nameToken is a {placeholder} which may appear in the naming format next to the time layout
+type nameToken struct {
+	// render returns the text inserted for the token
+	render func(mf *mediaFile) string
+	// pattern returns a regexp matching the text render produced for file, used to recognize files which are already named.  It may only hold non-capturing groups
+	pattern func(file string) string
+}
+
+var nameTokens = map[string]nameToken{
+	"dir": {
+		render: func(mf *mediaFile) string {
+			return dirToken(mf.Path)
+		},
+		pattern: func(file string) string {
+			return regexp.QuoteMeta(dirToken(file))
+		},
+	},
+	"seq": {
+		render: func(mf *mediaFile) string {
+			return sequenceToken(mf.Seq)
+		},
+		pattern: func(file string) string {
+			return `\d{` + extensions.IntToString(sequenceWidth) + `,}`
+		},
+	},
+	"comment": {
+		render: func(mf *mediaFile) string {
+			return commentToken(mf.Comment)
+		},
+		pattern: func(file string) string {
+			// the comment is only known once the file's metadata is read
+			return `.{0,` + extensions.IntToString(commentMaxLength) + `}`
+		},
+	},
+}
+
+var tokenRegexp = regexp.MustCompile(`\{[a-z]+\}`)
+
+func init() {
+	// registered here as rendering it parses names, which looks tokens up
+	nameTokens["original"] = nameToken{
+		render: originalToken,
+		pattern: func(file string) string {
+			return `.+`
+		},
+	}
+}
+
+// originalToken is the name mf had before it was first renamed, without extension.  A file already named after the format keeps the original name it holds so renaming again does not nest it
+func originalToken(mf *mediaFile) string {
+	name := strings.TrimSuffix(filepath.Base(mf.Path), filepath.Ext(mf.Path))
+	if _, tokens, ok := parseNameTokens(mediaFormat(mf), name, mf.Path); ok && tokens["original"] != "" {
+		return tokens["original"]
+	}
+	return sanitizeNameComponent(asciiComponent(name))
+}
+
+// originalNameSuffix is what -keep-original-name appends to the naming formats
+const originalNameSuffix = " ({original})"
+
+// withOriginalName appends the {original} token in parentheses to a naming format for -keep-original-name, an empty format stays empty so it still falls back to fmtDesired
+func withOriginalName(format string) string {
+	if format == "" || strings.Contains(format, "{original}") {
+		return format
+	}
+	return format + originalNameSuffix
+}
+
+// dirToken is the sanitized name of the folder holding file
+func dirToken(file string) string {
+	return sanitizeNameComponent(asciiComponent(filepath.Base(filepath.Dir(file))))
+}
+
+var unsafeNameChars = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+
+// sanitizeNameComponent makes text taken from paths or metadata safe to use inside a file name
+func sanitizeNameComponent(value string) string {
+	return strings.TrimSpace(safeName(unsafeNameChars.Replace(value)))
+}
+
+// nameSegment is either a piece of Go time layout or a known {token}
+type nameSegment struct {
+	layout string
+	token  string
+}
+
+// layoutTokens are {tokens} standing for a piece of time layout, for formats written without Go's reference time
+var layoutTokens = map[string]string{
+	"date": "2006-01-02",
+}
+
+// splitNameFormat cuts format into time layout pieces and known tokens.  Unknown {words} stay part of the layout
+func splitNameFormat(format string) (segments []nameSegment) {
+	last := 0
+	for _, loc := range tokenRegexp.FindAllStringIndex(format, -1) {
+		token := format[loc[0]+1 : loc[1]-1]
+		layout, isLayout := layoutTokens[token]
+		if _, ok := nameTokens[token]; !ok && !isLayout {
+			continue
+		}
+		if loc[0] > last {
+			segments = append(segments, nameSegment{layout: format[last:loc[0]]})
+		}
+		if isLayout {
+			segments = append(segments, nameSegment{layout: layout})
+		} else {
+			segments = append(segments, nameSegment{token: token})
+		}
+		last = loc[1]
+	}
+	if last < len(format) {
+		segments = append(segments, nameSegment{layout: format[last:]})
+	}
+	return
+}
+
+// renderName formats timeInfo with format, filling in any tokens from mf, after the -device-prefix
+func renderName(format string, timeInfo time.Time, mf *mediaFile) string {
+	var name strings.Builder
+	name.WriteString(devicePrefix)
+	for _, segment := range splitNameFormat(format) {
+		if segment.token != "" {
+			name.WriteString(nameTokens[segment.token].render(mf))
+			continue
+		}
+		name.WriteString(timeInfo.Format(safeLayout(segment.layout)))
+	}
+	return safeName(name.String())
+}
+
+// parseName reports whether fileName (without extension) is what format renders for file and returns the time it holds
+func parseName(format string, fileName string, file string) (time.Time, bool) {
+	timeInfo, _, ok := parseNameTokens(format, fileName, file)
+	return timeInfo, ok
+}
+
+// parseNameTokens is parseName also returning the text each token matched
+func parseNameTokens(format string, fileName string, file string) (time.Time, map[string]string, bool) {
+	if !strings.HasPrefix(fileName, devicePrefix) {
+		return time.Time{}, nil, false
+	}
+	fileName = strings.TrimPrefix(fileName, devicePrefix)
+	segments := splitNameFormat(format)
+	hasToken := false
+	layout := ""
+	for _, segment := range segments {
+		if segment.token != "" {
+			hasToken = true
+		}
+		layout += segment.layout
+	}
+	if !hasToken {
+		timeInfo, err := time.Parse(safeLayout(layout), fileName)
+		return timeInfo, nil, err == nil
+	}
+
+	var expression strings.Builder
+	var layouts []string
+	expression.WriteString("^")
+	for _, segment := range segments {
+		if segment.token != "" {
+			expression.WriteString("(" + nameTokens[segment.token].pattern(file) + ")")
+			continue
+		}
+		expression.WriteString("(" + layoutPattern(safeLayout(segment.layout)) + ")")
+		layouts = append(layouts, safeLayout(segment.layout))
+	}
+	expression.WriteString("$")
+	re, err := regexp.Compile(expression.String())
+	if err != nil {
+		return time.Time{}, nil, false
+	}
+	match := re.FindStringSubmatch(fileName)
+	if match == nil {
+		return time.Time{}, nil, false
+	}
+	tokens := make(map[string]string)
+	var values []string
+	for i, segment := range segments {
+		if segment.token != "" {
+			tokens[segment.token] = match[i+1]
+			continue
+		}
+		values = append(values, match[i+1])
+	}
+	// the layout pieces are parsed together so values split by a token (e.g. date and time of day) end up in one time
+	timeInfo, err := time.Parse(strings.Join(layouts, "\x00"), strings.Join(values, "\x00"))
+	return timeInfo, tokens, err == nil
+}
+
+// hasSuffixChain reports whether fileName is a formatted name followed by two or more numeric collision suffixes
+func hasSuffixChain(fileName string, file string) bool {
+	match := suffixChainRegexp.FindStringSubmatch(fileName)
+	if match == nil {
+		return false
+	}
+	return isFormattedName(match[1], file)
+}
+
+// layoutChunks maps the elements of Go's reference time to the text they format to, longest elements first
+var layoutChunks = []struct {
+	chunk   string
+	pattern string
+}{
+	{"January", `[A-Za-z]+`},
+	{"Jan", `[A-Za-z]{3}`},
+	{"Monday", `[A-Za-z]+`},
+	{"Mon", `[A-Za-z]{3}`},
+	{"MST", `(?:[A-Za-z]{3,5}|[+-]\d{2,4})`},
+	{"2006", `\d{4}`},
+	{"002", `\d{3}`},
+	{"__2", `[ \d]{2}\d`},
+	{"_2006", `_\d{4}`}, // a literal _ followed by the year, as time.Format reads it
+	{"_2", `[ \d]\d`},
+	{"-07:00:00", `[+-]\d{2}:\d{2}:\d{2}`},
+	{"-070000", `[+-]\d{6}`},
+	{"-07:00", `[+-]\d{2}:\d{2}`},
+	{"-0700", `[+-]\d{4}`},
+	{"-07", `[+-]\d{2}`},
+	{"Z07:00:00", `(?:Z|[+-]\d{2}:\d{2}:\d{2})`},
+	{"Z070000", `(?:Z|[+-]\d{6})`},
+	{"Z07:00", `(?:Z|[+-]\d{2}:\d{2})`},
+	{"Z0700", `(?:Z|[+-]\d{4})`},
+	{"Z07", `(?:Z|[+-]\d{2})`},
+	{"01", `\d{2}`},
+	{"02", `\d{2}`},
+	{"03", `\d{2}`},
+	{"04", `\d{2}`},
+	{"05", `\d{2}`},
+	{"06", `\d{2}`},
+	{"15", `\d{2}`},
+	{"PM", `[AP]M`},
+	{"pm", `[ap]m`},
+	{"1", `\d{1,2}`},
+	{"2", `\d{1,2}`},
+	{"3", `\d{1,2}`},
+	{"4", `\d{1,2}`},
+	{"5", `\d{1,2}`},
+}
+
+var fractionalSeconds = regexp.MustCompile(`^[.,](0+|9+)`)
+
+// layoutFraction returns the fractional seconds element layout starts with, or ""
+func layoutFraction(layout string) string {
+	fraction := fractionalSeconds.FindString(layout)
+	if fraction != "" && len(fraction) < len(layout) && layout[len(fraction)] >= '0' && layout[len(fraction)] <= '9' {
+		return ""
+	}
+	return fraction
+}
+
+// layoutElementSize returns the length of the Go time layout element layout starts with, 0 when it starts with literal text
+func layoutElementSize(layout string) int {
+	if fraction := layoutFraction(layout); fraction != "" {
+		return len(fraction)
+	}
+	for _, c := range layoutChunks {
+		if strings.HasPrefix(layout, c.chunk) {
+			return len(c.chunk)
+		}
+	}
+	return 0
+}
+
+// layoutPattern turns a Go time layout into a regexp matching the text it formats to
+func layoutPattern(layout string) string {
+	var pattern strings.Builder
+	for i := 0; i < len(layout); {
+		if fraction := layoutFraction(layout[i:]); fraction != "" {
+			if fraction[1] == '0' {
+				pattern.WriteString(`[.,]\d{` + extensions.IntToString(len(fraction)-1) + `}`)
+			} else {
+				pattern.WriteString(`(?:[.,]\d+)?`)
+			}
+			i += len(fraction)
+			continue
+		}
+		matched := false
+		for _, c := range layoutChunks {
+			if strings.HasPrefix(layout[i:], c.chunk) {
+				pattern.WriteString(c.pattern)
+				i += len(c.chunk)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			_, size := utf8.DecodeRuneInString(layout[i:])
+			pattern.WriteString(regexp.QuoteMeta(layout[i : i+size]))
+			i += size
+		}
+	}
+	return pattern.String()
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirToken(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"photos/Hawaii/IMG_1.jpg", "Hawaii"},
+		{"photos/Trip: Rome?/IMG_1.jpg", "Trip_ Rome_"},
+		{"photos/  Paris  /IMG_1.jpg", "Paris"},
+	}
+	for _, test := range tests {
+		if got := dirToken(filepath.FromSlash(test.file)); got != test.want {
+			t.Errorf("dirToken(%q) = %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+func TestRenderAndParseDirName(t *testing.T) {
+	const format = "2006-01-02 15.04.05 - {dir}"
+	taken := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, folder := range []string{"Hawaii", "New York", "Zürich"} {
+		file := filepath.Join("photos", folder, "IMG_1.jpg")
+		name := renderName(format, taken, &mediaFile{Path: file})
+		if want := "2023-01-01 12.00.00 - " + folder; name != want {
+			t.Errorf("renderName in %s = %q, want %q", folder, name, want)
+		}
+		parsed, ok := parseName(format, name, file)
+		if !ok || !parsed.Equal(taken) {
+			t.Errorf("parseName(%q) = %v, %v, want %v", name, parsed, ok, taken)
+		}
+		// the same name in another folder is not named after the format of that folder
+		if _, ok := parseName(format, name, filepath.Join("photos", "Elsewhere", "IMG_1.jpg")); ok {
+			t.Errorf("parseName(%q) matched in another folder", name)
+		}
+	}
+}
+
+func TestDirTokenRenamesIdempotently(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "Hawaii/IMG_1.jpg", jpegWithExif(exifTiff("", "2023:01:01 12:00:00")))
+	writeTestFile(t, dir, "Rome/IMG_1.jpg", jpegWithExif(exifTiff("", "2023:01:01 12:00:00")))
+	want := []string{"Hawaii/2023-01-01 12.00.00 - Hawaii.jpg", "Rome/2023-01-01 12.00.00 - Rome.jpg"}
+	mustRunMain(t, dir, "2006-01-02 15.04.05 - {dir}")
+	assertFiles(t, dir, want...)
+	mustRunMain(t, dir, "2006-01-02 15.04.05 - {dir}")
+	assertFiles(t, dir, want...)
+}
+
+func TestHasSuffixChain(t *testing.T) {
+	tests := []struct {
+		fileName string
+		want     bool
+	}{
+		{"2021-05-01 12.30.00", false},
+		{"2021-05-01 12.30.00-1", false},
+		{"2021-05-01 12.30.00-1-1", true},
+		{"2021-05-01 12.30.00-1-1-1", true},
+		{"2021-05-01 12.30.00-2-10", true},
+		{"IMG_0001-1-1", false},
+	}
+	restoreAfterTest(t, &fmtDesired)
+	fmtDesired = "2006-01-02 15.04.05"
+	for _, test := range tests {
+		if got := hasSuffixChain(test.fileName, "VID.mp4"); got != test.want {
+			t.Errorf("hasSuffixChain(%q) = %v, want %v", test.fileName, got, test.want)
+		}
+	}
+}
+
+func TestRepairCollapsesSuffixChain(t *testing.T) {
+	dir := t.TempDir()
+	clip := mp4WithTime(time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC))
+	writeTestFile(t, dir, "2021-05-01 12.30.00-1-1-1.mp4", clip)
+	writeTestFile(t, dir, "IMG_0001.mp4", clip)
+	mustRunMain(t, "-repair", dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00.mp4", "IMG_0001.mp4")
+}
+
+func TestTrimCollisionSuffixFollowsFormat(t *testing.T) {
+	restoreAfterTest(t, &collisionFormat)
+	restoreAfterTest(t, &trailingSuffixRegexp, &suffixChainRegexp)
+	tests := []struct {
+		format   string
+		fileName string
+		want     string
+		ok       bool
+	}{
+		{"-%d", "2021-05-01 12.30.00-1", "2021-05-01 12.30.00", true},
+		{"-%d", "2021-05-01 12.30.00_001", "2021-05-01 12.30.00_001", false},
+		{"_%03d", "2021-05-01 12.30.00_001", "2021-05-01 12.30.00", true},
+		{" (%d)", "2021-05-01 12.30.00 (2)", "2021-05-01 12.30.00", true},
+	}
+	for _, test := range tests {
+		collisionFormat = test.format
+		trailingSuffixRegexp, suffixChainRegexp = compileCollisionRegexps()
+		got, ok := trimCollisionSuffix(test.fileName)
+		if got != test.want || ok != test.ok {
+			t.Errorf("trimCollisionSuffix(%q) with %s = %q, %v, want %q, %v", test.fileName, test.format, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestNameFormatPerCategory(t *testing.T) {
+	restoreAfterTest(t, &fmtDesired, &imageTemplate, &videoTemplate, &audioTemplate)
+	restoreAfterTest(t, &audioExtensions)
+	fmtDesired, imageTemplate, videoTemplate, audioTemplate = "2006-01-02 15.04.05", "IMG_20060102_150405", "VID_20060102_150405", ""
+	audioExtensions = []string{"M4A"}
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"IMG_0001.JPG", "IMG_20060102_150405"},
+		{"clip.mov", "VID_20060102_150405"},
+		{"memo.m4a", "2006-01-02 15.04.05"},
+		{"notes.txt", "2006-01-02 15.04.05"},
+	}
+	for _, test := range tests {
+		if got := nameFormat(test.file); got != test.want {
+			t.Errorf("nameFormat(%q) = %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+func TestCategoryTemplatesRename(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	dir := t.TempDir()
+	taken := time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)
+	writeTestFile(t, dir, "photo.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "clip.mp4", mp4WithTime(taken))
+	writeTestFile(t, dir, "memo.m4a", mp4WithTime(taken))
+	mustRunMain(t, "-image-template", "IMG_20060102_150405", "-video-template", "VID_20060102_150405", "-audio-template", "AUD_20060102_150405", "-audio-exts", "m4a", dir)
+	assertFiles(t, dir, "AUD_20210501_123000.m4a", "IMG_20210501_123000.jpg", "VID_20210501_123000.mp4")
+	// files named by their category's template are left alone on the next run
+	mustRunMain(t, "-image-template", "IMG_20060102_150405", "-video-template", "VID_20060102_150405", "-audio-template", "AUD_20060102_150405", "-audio-exts", "m4a", dir)
+	assertFiles(t, dir, "AUD_20210501_123000.m4a", "IMG_20210501_123000.jpg", "VID_20210501_123000.mp4")
+}
+
+func TestDevicePrefixNames(t *testing.T) {
+	restoreAfterTest(t, &devicePrefix)
+	const format = "2006-01-02 15.04.05"
+	taken := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	// digits and month names in a prefix are text, not parts of the time layout
+	for _, prefix := range []string{"phoneA_", "Pixel 7 Jan_", "2006_"} {
+		devicePrefix = prefix
+		name := renderName(format, taken, &mediaFile{Path: "IMG_1.jpg"})
+		if want := prefix + "2023-01-01 12.00.00"; name != want {
+			t.Errorf("renderName with %q = %q, want %q", prefix, name, want)
+		}
+		if parsed, ok := parseName(format, name, "IMG_1.jpg"); !ok || !parsed.Equal(taken) {
+			t.Errorf("parseName(%q) = %v, %v, want %v", name, parsed, ok, taken)
+		}
+		if _, ok := parseName(format, "2023-01-01 12.00.00", "IMG_1.jpg"); ok {
+			t.Errorf("a name without %q parsed as formatted", prefix)
+		}
+	}
+}
+
+func TestDevicePrefixRenamesIdempotently(t *testing.T) {
+	root := t.TempDir()
+	photo := jpegWithExif(exifTiff("", "2023:01:01 12:00:00"))
+	writeTestFile(t, root, "library/IMG_0001.jpg", photo)
+	writeTestFile(t, root, "phoneB/IMG_0001.jpg", photo)
+	mustRunMain(t, "-device-prefix", "phoneA_", filepath.Join(root, "library"))
+	mustRunMain(t, "-device-prefix", "phoneB_", filepath.Join(root, "phoneB"))
+	want := []string{"library/phoneA_2023-01-01 12.00.00.jpg", "phoneB/phoneB_2023-01-01 12.00.00.jpg"}
+	assertFiles(t, root, want...)
+	mustRunMain(t, "-device-prefix", "phoneA_", filepath.Join(root, "library"))
+	assertFiles(t, root, want...)
+}
+
+func TestMediaFormatDateOnly(t *testing.T) {
+	restoreAfterTest(t, &fmtDesired, &dateOnlyFormat, &imageTemplate)
+	fmtDesired, imageTemplate = "2006-01-02 15.04.05", ""
+	midnight := mediaTime{Time: time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)}
+	dayOnly := mediaTime{Time: midnight.Time, DateOnly: true}
+	tests := []struct {
+		name     string
+		dateOnly string
+		mt       mediaTime
+		want     string
+	}{
+		{"date only", "2006-01-02", dayOnly, "2006-01-02"},
+		{"real midnight", "2006-01-02", midnight, "2006-01-02 15.04.05"},
+		{"date only without -date-only-format", "", dayOnly, "2006-01-02 15.04.05"},
+	}
+	for _, test := range tests {
+		dateOnlyFormat = test.dateOnly
+		if got := mediaFormat(&mediaFile{Path: "a.jpg", mediaTime: test.mt}); got != test.want {
+			t.Errorf("%s: mediaFormat = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// names in either format are left alone by later runs
+	dateOnlyFormat = "2006-01-02"
+	for _, name := range []string{"2021-05-01", "2021-05-01-1", "2021-05-01 00.00.00"} {
+		if !isFormattedName(name, name+".jpg") {
+			t.Errorf("isFormattedName(%q) = false", name)
+		}
+	}
+}
+
+func TestDateOnlyFormatRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "day.jpg", jpegWithExif(buildTiff(testIFD{gps: []tiffEntry{asciiEntry(0x001D, "2021:05:01")}})))
+	writeTestFile(t, dir, "midnight.jpg", jpegWithExif(exifTiff("", "2021:05:02 00:00:00")))
+	for run := 0; run < 2; run++ {
+		mustRunMain(t, "-trust", "gps-time", "-date-only-format", "2006-01-02", dir)
+		assertFiles(t, dir, "2021-05-01.jpg", "2021-05-02 00.00.00.jpg")
+	}
+}
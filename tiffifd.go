@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// Tiff tags telling the full image of a multi IFD Tiff from its thumbnails and the tags holding its dates
+const (
+	tagNewSubfileType = 0x00FE
+	tagSubfileType    = 0x00FF
+	tagDateTime       = 0x0132
+	tagExifIFDPointer = 0x8769
+)
+
+// reducedResolution reports whether an IFD holds a thumbnail or preview of another image, NewSubfileType has bit 0 set for those, the older SubfileType is 2
+func reducedResolution(dir *tiff.Dir) bool {
+	for _, tag := range dir.Tags {
+		if tag.Format() != tiff.IntVal {
+			continue
+		}
+		value, err := tag.Int64(0)
+		if err != nil {
+			continue
+		}
+		if tag.Id == tagNewSubfileType && value&1 == 1 || tag.Id == tagSubfileType && value == 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDates reports whether an IFD holds DateTime or points to an Exif sub-IFD
+func hasDates(dir *tiff.Dir) bool {
+	for _, tag := range dir.Tags {
+		if tag.Id == tagDateTime || tag.Id == tagExifIFDPointer {
+			return true
+		}
+	}
+	return false
+}
+
+// primaryIFD returns the index of the first full resolution IFD carrying dates.  It is 0, the IFD goexif reads, unless scanning software wrote a thumbnail first
+func primaryIFD(dirs []*tiff.Dir) int {
+	if len(dirs) < 2 || !reducedResolution(dirs[0]) {
+		return 0
+	}
+	for i, dir := range dirs[1:] {
+		if !reducedResolution(dir) && hasDates(dir) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ifdOffset follows the IFD chain of Tiff data to the offset of IFD index, ok is false when the chain ends or loops first
+func ifdOffset(data []byte, order binary.ByteOrder, index int) (offset uint32, ok bool) {
+	if len(data) < 8 {
+		return 0, false
+	}
+	offset = order.Uint32(data[4:])
+	seen := make(map[uint32]bool)
+	for i := 0; i < index; i++ {
+		if offset == 0 || seen[offset] || uint64(offset)+2 > uint64(len(data)) {
+			return 0, false
+		}
+		seen[offset] = true
+		next := uint64(offset) + 2 + 12*uint64(order.Uint16(data[offset:]))
+		if next+4 > uint64(len(data)) {
+			return 0, false
+		}
+		offset = order.Uint32(data[next:])
+	}
+	return offset, offset != 0
+}
+
+// primaryExif returns the Exif of the full resolution image of a multi IFD Tiff, such as a scan whose first IFD is its thumbnail.  goexif only reads the first IFD, so the Tiff is decoded again with its header pointing at the primary one.  x is returned as it is when its first IFD is the primary image
+func primaryExif(x *exif.Exif, fileWork string) *exif.Exif {
+	if x.Tiff == nil {
+		return x
+	}
+	index := primaryIFD(x.Tiff.Dirs)
+	if index == 0 {
+		return x
+	}
+	offset, ok := ifdOffset(x.Raw, x.Tiff.Order, index)
+	if !ok {
+		return x
+	}
+	data := append([]byte{}, x.Raw...)
+	x.Tiff.Order.PutUint32(data[4:], offset)
+	primary, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return x
+	}
+	fileLog.Println(fileWork + " has " + extensions.IntToString(len(x.Tiff.Dirs)) + " IFDs, IFD 0 is a thumbnail, reading the dates of IFD " + extensions.IntToString(index))
+	return primary
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// thumbnailEntry marks an IFD as a reduced resolution image through NewSubfileType
+var thumbnailEntry = longEntry(tagNewSubfileType, 1)
+
+// oldThumbnailEntry marks an IFD as a reduced resolution image through the older SubfileType
+var oldThumbnailEntry = tiffEntry{tagSubfileType, 3, 1, []byte{2, 0}}
+
+// widthEntry tells the IFDs of a test apart by their ImageWidth
+func widthEntry(width uint32) tiffEntry {
+	return longEntry(0x0100, width)
+}
+
+func TestPrimaryIFD(t *testing.T) {
+	dated := []tiffEntry{asciiEntry(tagDateTime, "2021:05:01 12:30:00")}
+	tests := []struct {
+		name string
+		ifds []testIFD
+		want int
+	}{
+		{"single IFD", []testIFD{{fields: dated}}, 0},
+		{"full image first", []testIFD{{fields: dated}, {fields: []tiffEntry{thumbnailEntry}}}, 0},
+		{"thumbnail first", []testIFD{{fields: []tiffEntry{thumbnailEntry}}, {fields: dated}}, 1},
+		{"old SubfileType thumbnail first", []testIFD{{fields: []tiffEntry{oldThumbnailEntry}}, {fields: dated}}, 1},
+		{"two thumbnails before Exif", []testIFD{{fields: []tiffEntry{thumbnailEntry}}, {fields: []tiffEntry{thumbnailEntry, asciiEntry(tagDateTime, "2000:01:01 00:00:00")}}, {exif: []tiffEntry{asciiEntry(0x9003, "2021:05:01 12:30:00")}}}, 2},
+		{"no full image with dates", []testIFD{{fields: []tiffEntry{thumbnailEntry}}, {fields: []tiffEntry{widthEntry(640)}}}, 0},
+		{"only a thumbnail", []testIFD{{fields: []tiffEntry{thumbnailEntry}}}, 0},
+	}
+	for _, test := range tests {
+		decoded, err := tiff.Decode(bytes.NewReader(buildTiff(test.ifds...)))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := primaryIFD(decoded.Dirs); got != test.want {
+			t.Errorf("%s: primaryIFD = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIfdOffset(t *testing.T) {
+	chain := buildTiff(testIFD{fields: []tiffEntry{widthEntry(0)}}, testIFD{fields: []tiffEntry{widthEntry(1)}}, testIFD{fields: []tiffEntry{widthEntry(2)}})
+	// the last IFD points back to the first one
+	looping := append([]byte{}, chain...)
+	last, _ := ifdOffset(looping, binary.LittleEndian, 2)
+	binary.LittleEndian.PutUint32(looping[last+2+12:], binary.LittleEndian.Uint32(looping[4:]))
+	second, _ := ifdOffset(chain, binary.LittleEndian, 1)
+	tests := []struct {
+		name  string
+		data  []byte
+		index int
+		ok    bool
+	}{
+		{"first IFD", chain, 0, true},
+		{"second IFD", chain, 1, true},
+		{"last IFD", chain, 2, true},
+		{"past the end of the chain", chain, 3, false},
+		{"around a looping chain", looping, 4, false},
+		{"truncated IFD", chain[:second+2+6], 2, false},
+		{"truncated header", chain[:6], 0, false},
+	}
+	for _, test := range tests {
+		offset, ok := ifdOffset(test.data, binary.LittleEndian, test.index)
+		if ok != test.ok {
+			t.Errorf("%s: ifdOffset found %v, want %v", test.name, ok, test.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		// every IFD of the chain holds its index as its width
+		dir, _, err := tiff.DecodeDir(bytes.NewReader(test.data[offset:]), binary.LittleEndian)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if width, err := dir.Tags[0].Int64(0); err != nil || width != int64(test.index) {
+			t.Errorf("%s: ifdOffset %d leads to IFD %d, %v", test.name, offset, width, err)
+		}
+	}
+}
+
+func TestThumbnailFirstTiffRenames(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "scan.tif", buildTiff(
+		testIFD{fields: []tiffEntry{thumbnailEntry, widthEntry(160)}},
+		testIFD{fields: []tiffEntry{widthEntry(4000), asciiEntry(tagDateTime, "2021:05:01 12:30:00")}},
+	))
+	mustRunMain(t, dir)
+	assertFiles(t, dir, "2021-05-01 12.30.00.tif")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stages of the work on one file -trace times
+const (
+	stageRead   = "read"
+	stageDecode = "decode"
+	stageRename = "rename"
+)
+
+var traceStages = []string{stageRead, stageDecode, stageRename}
+
+// fileTrace adds up how long each stage took for every file, set up by -trace
+type fileTrace struct {
+	sync.Mutex
+	durations map[string]map[string]time.Duration
+}
+
+// tracing is nil unless -trace is set
+var tracing *fileTrace
+
+// traceStage adds the time since start to a stage of file, it does nothing without -trace
+func traceStage(file string, stage string, start time.Time) {
+	if tracing == nil {
+		return
+	}
+	elapsed := time.Since(start)
+	tracing.Lock()
+	defer tracing.Unlock()
+	if tracing.durations == nil {
+		tracing.durations = make(map[string]map[string]time.Duration)
+	}
+	if tracing.durations[file] == nil {
+		tracing.durations[file] = make(map[string]time.Duration)
+	}
+	tracing.durations[file][stage] += elapsed
+}
+
+// milliseconds renders a duration for the trace CSV
+func milliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// write saves the stage durations as CSV, one row per file, slowest first
+func (t *fileTrace) write(file string) error {
+	t.Lock()
+	defer t.Unlock()
+	files := make([]string, 0, len(t.durations))
+	totals := make(map[string]time.Duration)
+	for path, stages := range t.durations {
+		files = append(files, path)
+		for _, d := range stages {
+			totals[path] += d
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if totals[files[i]] != totals[files[j]] {
+			return totals[files[i]] > totals[files[j]]
+		}
+		return files[i] < files[j]
+	})
+
+	fd, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	w := csv.NewWriter(fd)
+	header := []string{"path"}
+	for _, stage := range traceStages {
+		header = append(header, stage+"_ms")
+	}
+	w.Write(append(header, "total_ms"))
+	for _, path := range files {
+		row := []string{path}
+		for _, stage := range traceStages {
+			row = append(row, milliseconds(t.durations[path][stage]))
+		}
+		w.Write(append(row, milliseconds(totals[path])))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return fd.Close()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// readTrace returns the rows of a -trace CSV
+func readTrace(t *testing.T, file string) [][]string {
+	t.Helper()
+	fd, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	rows, err := csv.NewReader(fd).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestFileTraceWrite(t *testing.T) {
+	trace := &fileTrace{durations: map[string]map[string]time.Duration{
+		"fast.jpg": {stageRead: time.Millisecond, stageDecode: 500 * time.Microsecond},
+		"raw.cr2":  {stageRead: 40 * time.Millisecond, stageDecode: 2 * time.Millisecond, stageRename: 250 * time.Microsecond},
+		"tie.jpg":  {stageRead: 1500 * time.Microsecond},
+	}}
+	file := filepath.Join(t.TempDir(), "trace.csv")
+	if err := trace.write(file); err != nil {
+		t.Fatal(err)
+	}
+	// slowest first, ties by path, stages a file never reached are 0
+	want := [][]string{
+		{"path", "read_ms", "decode_ms", "rename_ms", "total_ms"},
+		{"raw.cr2", "40.000", "2.000", "0.250", "42.250"},
+		{"fast.jpg", "1.000", "0.500", "0.000", "1.500"},
+		{"tie.jpg", "1.500", "0.000", "0.000", "1.500"},
+	}
+	if rows := readTrace(t, file); !reflect.DeepEqual(rows, want) {
+		t.Errorf("trace rows\n%q\nwant\n%q", rows, want)
+	}
+}
+
+func TestTraceRun(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "photos")
+	writeTestFile(t, dir, "IMG_0001.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+	writeTestFile(t, dir, "IMG_0002.jpg", jpegWithExif(exifTiff("", "2021:05:02 08:00:00")))
+	writeTestFile(t, dir, "clip.mp4", mp4WithTime(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+	trace := filepath.Join(root, "trace.csv")
+	mustRunMain(t, "-trace", trace, dir)
+	rows := readTrace(t, trace)
+	if len(rows) != 4 {
+		t.Fatalf("trace has %d rows, want a header and one per file:\n%q", len(rows), rows)
+	}
+	seen := make(map[string]bool)
+	for _, row := range rows[1:] {
+		seen[filepath.Base(row[0])] = true
+		total := 0.0
+		for i, value := range row[1:] {
+			ms, err := strconv.ParseFloat(value, 64)
+			if err != nil || ms < 0 {
+				t.Errorf("%s: %s is %q, want a non-negative duration", row[0], rows[0][i+1], value)
+			}
+			if i < len(row)-2 {
+				total += ms
+			}
+		}
+		if last, _ := strconv.ParseFloat(row[len(row)-1], 64); last < total-0.01 || last > total+0.01 {
+			t.Errorf("%s: total %v is not the sum of its stages %v", row[0], last, total)
+		}
+	}
+	for _, name := range []string{"IMG_0001.jpg", "IMG_0002.jpg", "clip.mp4"} {
+		if !seen[name] {
+			t.Errorf("trace has no row for %s:\n%q", name, rows)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gosimple/unidecode"
+)
+
+// Set by -ascii-safe and -on-untransliterable
+var (
+	asciiSafe        bool
+	untransliterable = untransliterableReplace
+)
+
+// Policies of -on-untransliterable for characters without an ASCII spelling, such as emoji
+const (
+	untransliterableStrip   = "strip"
+	untransliterableReplace = "replace"
+)
+
+// asciiComponent spells a name component taken from paths or metadata in ASCII when -ascii-safe is set, e.g. Zürich as Zurich and 北京 as Bei Jing.  The time in a name is never passed through it
+func asciiComponent(value string) string {
+	if !asciiSafe {
+		return value
+	}
+	var ascii strings.Builder
+	for _, r := range value {
+		if r < utf8.RuneSelf {
+			ascii.WriteRune(r)
+			continue
+		}
+		spelled := unidecode.Unidecode(string(r))
+		if strings.TrimSpace(spelled) == "" || !isASCII(spelled) {
+			if untransliterable == untransliterableReplace {
+				ascii.WriteString("_")
+			}
+			continue
+		}
+		ascii.WriteString(spelled)
+	}
+	return strings.Join(strings.Fields(ascii.String()), " ")
+}
+
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
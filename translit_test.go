@@ -0,0 +1,54 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAsciiComponent(t *testing.T) {
+	restoreAfterTest(t, &asciiSafe)
+	restoreAfterTest(t, &untransliterable)
+	tests := []struct {
+		name   string
+		value  string
+		policy string
+		want   string
+	}{
+		{"ascii untouched", "Canon EOS R5", untransliterableReplace, "Canon EOS R5"},
+		{"accented", "Zürich Café", untransliterableReplace, "Zurich Cafe"},
+		{"cjk", "北京", untransliterableReplace, "Bei Jing"},
+		{"emoji replaced", "Party 🎉", untransliterableReplace, "Party _"},
+		{"emoji stripped", "Party 🎉", untransliterableStrip, "Party"},
+		{"only emoji stripped", "🎉🎂", untransliterableStrip, ""},
+	}
+	for _, test := range tests {
+		asciiSafe, untransliterable = true, test.policy
+		if got := asciiComponent(test.value); got != test.want {
+			t.Errorf("%s: asciiComponent(%q) = %q, want %q", test.name, test.value, got, test.want)
+		}
+	}
+	asciiSafe = false
+	if got := asciiComponent("Zürich 🎉"); got != "Zürich 🎉" {
+		t.Errorf("asciiComponent without -ascii-safe = %q", got)
+	}
+}
+
+func TestAsciiSafeNames(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"kept as is", nil, "2021-05-01 12.30.00 Zürich 北京 🎉.jpg"},
+		{"replace", []string{"-ascii-safe"}, "2021-05-01 12.30.00 Zurich Bei Jing _.jpg"},
+		{"strip", []string{"-ascii-safe", "-on-untransliterable", "strip"}, "2021-05-01 12.30.00 Zurich Bei Jing.jpg"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "Zürich 北京 🎉")
+			writeTestFile(t, dir, "a.jpg", jpegWithExif(exifTiff("", "2021:05:01 12:30:00")))
+			mustRunMain(t, append(test.args, dir, "2006-01-02 15.04.05 {dir}")...)
+			assertFiles(t, dir, test.want)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// renameManifestName is the file in the backup folder listing what a run renamed and moved, for -undo
+const renameManifestName = "renames.json"
+
+// renameManifestSuffix names the sibling file the manifest is kept in when a matching backup is removed
+const renameManifestSuffix = " - Renames "
+
+// manifestEntry is one rename or move of a run.  Size and ModTime are the file's after the run, so -undo can tell it changed since
+type manifestEntry struct {
+	Op      string `json:"op"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"`
+}
+
+// renameManifest is the file -backup writes and -undo reads
+type renameManifest struct {
+	Root    string          `json:"root"`
+	Entries []manifestEntry `json:"entries"`
+}
+
+// writeRenameManifest lists every file the run renamed or moved in the manifest inside backupDir
+func writeRenameManifest(dir string, backupDir string) error {
+	manifest := renameManifest{Root: dir}
+	results.Lock()
+	for _, result := range results.Items {
+		op := opRename
+		switch result.Status {
+		case statusRenamed:
+		case statusMoved:
+			op = opMove
+		default:
+			continue
+		}
+		entry := manifestEntry{Op: op, Old: result.Path, New: result.NewPath}
+		if info, err := os.Stat(result.NewPath); err == nil {
+			entry.Size, entry.ModTime = info.Size(), info.ModTime().UnixNano()
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+	results.Unlock()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(backupDir, renameManifestName), append(data, '\n'), 0644)
+}
+
+// keepRenameManifest moves the manifest out of a backup about to be removed into a dated sibling file of the processed directory
+func keepRenameManifest(backupDir string) {
+	manifest := filepath.Join(backupDir, renameManifestName)
+	if !extensions.DoesFileExist(manifest) {
+		return
+	}
+	kept := strings.TrimSuffix(filepath.Clean(backupDir), backupDirSuffix) + renameManifestSuffix + time.Now().Format("2006-01-02 15.04.05") + ".json"
+	if err := os.Rename(manifest, kept); err != nil {
+		stdErr.Println("Could not keep rename manifest " + manifest + ": " + err.Error())
+		return
+	}
+	log.Println("Kept the rename manifest as " + kept + ", pass it to -undo to reverse the run")
+}
+
+// readRenameManifest loads a manifest written by -backup
+func readRenameManifest(file string) (manifest renameManifest, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		err = errors.New("Could not parse rename manifest " + file + ": " + err.Error())
+	}
+	return
+}
+
+// undoRenames puts every file of a manifest back under its old name, last rename first.  Files whose new name is gone or whose old name is taken fail, files changed since the run are reported and still renamed back
+func undoRenames(manifest renameManifest) {
+	for i := len(manifest.Entries) - 1; i >= 0; i-- {
+		entry := manifest.Entries[i]
+		result := fileResult{Path: entry.New}
+		info, err := os.Stat(entry.New)
+		switch {
+		case err != nil:
+			err = errors.New("Could not undo " + entry.Op + " of " + entry.Old + ": " + entry.New + " no longer exists")
+		case extensions.DoesFileExist(entry.Old):
+			err = errors.New("Could not undo " + entry.Op + " of " + entry.Old + ": it exists again")
+		default:
+			if info.Size() != entry.Size || info.ModTime().UnixNano() != entry.ModTime {
+				log.Println(entry.New + " was modified since it was renamed, renaming it back anyway")
+			}
+			if err = os.MkdirAll(filepath.Dir(entry.Old), 0755); err == nil {
+				err = os.Rename(entry.New, entry.Old)
+			}
+			if err != nil {
+				err = errors.New("Could not undo " + entry.Op + " of " + entry.Old + ": " + err.Error())
+			}
+		}
+		if err != nil {
+			stdErr.Println(err.Error())
+			results.add(result.failed(err))
+			continue
+		}
+		if entry.Op == opRename {
+			renameSidecars(entry.New, entry.Old)
+		}
+		oldLogName, newLogName := logNames(entry.New, entry.Old)
+		logFileLine("Renamed "+oldLogName+" back to "+newLogName, statusRenamed, oldLogName, newLogName, "")
+		result.NewPath = entry.Old
+		result.Status = statusRenamed
+		results.add(result)
+	}
+}
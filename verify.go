@@ -0,0 +1,52 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/DanielRenne/GoCore/core/extensions"
+)
+
+// verifyResult counts what -verify found
+type verifyResult struct {
+	matching   int
+	mismatched []string
+	unnamed    int
+	undated    int
+}
+
+// verifyNames compares the name of every media file with the name its metadata gives it, without renaming anything.  Names carrying a collision suffix match too
+func verifyNames(mediaFiles []*mediaFile) (result verifyResult) {
+	for _, mf := range mediaFiles {
+		if mf.Err != nil {
+			result.undated++
+			continue
+		}
+		ext := filepath.Ext(mf.Path)
+		fileName := strings.TrimSuffix(filepath.Base(mf.Path), ext)
+		expected := renderName(mediaFormat(mf), displayTime(mf.mediaTime), mf)
+		if trimmed, _ := trimCollisionSuffix(fileName); fileName == expected || trimmed == expected {
+			result.matching++
+			continue
+		}
+		if !isFormattedName(fileName, mf.Path) {
+			result.unnamed++
+			continue
+		}
+		result.mismatched = append(result.mismatched, mf.Path+" is named "+fileName+" but its "+mf.Source+" says "+expected)
+	}
+	sort.Strings(result.mismatched)
+	return
+}
+
+// summary describes a -verify pass, listing every mismatch
+func (v verifyResult) summary() string {
+	lines := append([]string{}, v.mismatched...)
+	lines = append(lines, "Verified "+extensions.IntToString(v.matching+len(v.mismatched)+v.unnamed+v.undated)+" files: "+
+		extensions.IntToString(v.matching)+" match their metadata, "+
+		extensions.IntToString(len(v.mismatched))+" do not, "+
+		extensions.IntToString(v.unnamed)+" are not named after a date and "+
+		extensions.IntToString(v.undated)+" have no readable date")
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// atom is a QuickTime/MP4 atom (box) located in a file, Offset and Size describe its data after the header
+type atom struct {
+	Type   string
+	Offset int64
+	Size   int64
+}
+
+// readAtoms calls fn for every atom between start and end, stopping when fn returns false
+func readAtoms(r io.ReadSeeker, start int64, end int64, fn func(a atom) (bool, error)) error {
+	buf := make([]byte, 8)
+	for offset := start; offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(buf))
+		a := atom{Type: string(buf[4:8]), Offset: offset + 8}
+		switch size {
+		case 0:
+			// the atom runs to the end of its parent
+			size = end - offset
+		case 1:
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(buf))
+			a.Offset += 8
+		}
+		if size < a.Offset-offset || offset+size > end {
+			return errors.New("Invalid size of atom " + a.Type)
+		}
+		a.Size = offset + size - a.Offset
+		more, err := fn(a)
+		if err != nil || !more {
+			return err
+		}
+		offset += size
+	}
+	return nil
+}
+
+// findAtom follows path (e.g. moov, udta) down from the top level of a file and returns the last atom on it
+func findAtom(r io.ReadSeeker, path ...string) (atom, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return atom{}, err
+	}
+	return childAtom(r, atom{Size: end}, path...)
+}
+
+// readAtomData reads the data of an atom up to limit bytes
+func readAtomData(r io.ReadSeeker, a atom, limit int64) ([]byte, error) {
+	if a.Size > limit {
+		return nil, errors.New("The " + a.Type + " atom is too large")
+	}
+	if _, err := r.Seek(a.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, a.Size)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// headerCreationTime reads the creation time, in seconds since 1904, of a mvhd, tkhd or mdhd atom's data.  Byte 1 is the version, 2-4 flags, then the creation time in 32 bits for version 0 and 64 bits for version 1
+func headerCreationTime(data []byte) (int64, bool) {
+	if len(data) < 8 {
+		return 0, false
+	}
+	if data[0] == 1 {
+		if len(data) < 12 {
+			return 0, false
+		}
+		return int64(binary.BigEndian.Uint64(data[4:])), true
+	}
+	return int64(binary.BigEndian.Uint32(data[4:])), true
+}
+
+// getMediaHeaderTime returns the earliest creation time in the mdhd atoms of the tracks of a movie, moov/trak/mdia/mdhd.  Editors which rewrite mvhd often leave the tracks' own headers alone
+func getMediaHeaderTime(r io.ReadSeeker) (time.Time, error) {
+	return earliestTrackTime(r, "mdia", "mdhd")
+}
+
+// getTrackHeaderTime returns the earliest creation time in the tkhd atoms of the tracks of a movie, moov/trak/tkhd.  Some camcorders write a malformed mvhd but valid track headers
+func getTrackHeaderTime(r io.ReadSeeker) (time.Time, error) {
+	return earliestTrackTime(r, "tkhd")
+}
+
+// earliestTrackTime returns the earliest creation time of the header atom at path inside every trak atom of moov
+func earliestTrackTime(r io.ReadSeeker, path ...string) (time.Time, error) {
+	header := path[len(path)-1]
+	moov, err := findAtom(r, "moov")
+	if err != nil {
+		return time.Time{}, err
+	}
+	var traks []atom
+	err = readAtoms(r, moov.Offset, moov.Offset+moov.Size, func(a atom) (bool, error) {
+		if a.Type == "trak" {
+			traks = append(traks, a)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	var earliest time.Time
+	for _, trak := range traks {
+		a, err := childAtom(r, trak, path...)
+		if err != nil {
+			continue
+		}
+		data, err := readAtomData(r, a, 128)
+		if err != nil || len(data) < 8 {
+			continue
+		}
+		seconds, ok := headerCreationTime(data)
+		if !ok || seconds == 0 {
+			// an unset header would hide the times of the other tracks
+			continue
+		}
+		created := time.Unix(seconds-appleEpochAdjustment, 0).Local()
+		if earliest.IsZero() || created.Before(earliest) {
+			earliest = created
+		}
+	}
+	if earliest.IsZero() {
+		return time.Time{}, errors.New("Did not find track header atom (" + header + ")")
+	}
+	return earliest, nil
+}
+
+// childAtom follows path down from parent and returns the last atom on it
+func childAtom(r io.ReadSeeker, parent atom, path ...string) (atom, error) {
+	found := parent
+	for _, atomType := range path {
+		parent := found
+		found = atom{}
+		err := readAtoms(r, parent.Offset, parent.Offset+parent.Size, func(a atom) (bool, error) {
+			if a.Type == atomType {
+				found = a
+				return false, nil
+			}
+			return true, nil
+		})
+		if err != nil {
+			return atom{}, err
+		}
+		if found.Type == "" {
+			return atom{}, errors.New("Did not find " + atomType + " atom")
+		}
+	}
+	return found, nil
+}
+
+// getMovieTime picks the capture time of a QuickTime/MP4 file.  The creationdate of the keys metadata is used when it records a zone, then mvhd when it is plausible, otherwise the GoPro GPS time with -gopro, the ©day user data and then the earliest of the tracks' mdhd and tkhd times.  With -pick earliest the earliest plausible of them wins
+func getMovieTime(r io.ReadSeeker) (time.Time, string, error) {
+	keysTime, keysZoned, errKeys := getQuickTimeCreationDate(r)
+	keysUsable := errKeys == nil && plausibleVideoTime(keysTime)
+	if keysUsable && keysZoned && !pickEarliest {
+		return keysTime, sourceQuickTimeKeys, nil
+	}
+	mvhdTime, err := getVideoCreationTimeMetadata(r)
+	mvhdUsable := err == nil && plausibleVideoTime(mvhdTime)
+	if mvhdUsable && !pickEarliest {
+		return mvhdTime, sourceMvhd, nil
+	}
+	var candidates []mediaTime
+	if keysUsable {
+		if !pickEarliest {
+			return keysTime, sourceQuickTimeKeys, nil
+		}
+		candidates = append(candidates, mediaTime{Time: keysTime, Zoned: true, Source: sourceQuickTimeKeys})
+	}
+	if mvhdUsable {
+		candidates = append(candidates, mediaTime{Time: mvhdTime, Zoned: true, Source: sourceMvhd})
+	}
+	if pickEarliest || goproMetadata {
+		if goproTime, errGoPro := getGoProCreationTime(r); errGoPro == nil {
+			if !pickEarliest {
+				return goproTime, sourceGoPro, nil
+			}
+			candidates = append(candidates, mediaTime{Time: goproTime, Zoned: true, Source: sourceGoPro})
+		}
+	}
+	if dayTime, errDay := getUserDataDay(r); errDay == nil && plausibleVideoTime(dayTime) {
+		if !pickEarliest {
+			return dayTime, sourceUdtaDay, nil
+		}
+		candidates = append(candidates, mediaTime{Time: dayTime, Zoned: true, Source: sourceUdtaDay})
+	}
+	if mdhdTime, errMdhd := getMediaHeaderTime(r); errMdhd == nil {
+		candidates = append(candidates, mediaTime{Time: mdhdTime, Zoned: true, Source: sourceMdhd})
+	}
+	if tkhdTime, errTkhd := getTrackHeaderTime(r); errTkhd == nil {
+		candidates = append(candidates, mediaTime{Time: tkhdTime, Zoned: true, Source: sourceTkhd})
+	}
+	if picked, ok := earliestTime(candidates, plausibleVideoTime); ok {
+		return picked.Time, picked.Source, nil
+	}
+	return mvhdTime, sourceMvhd, err
+}
+
+// goproMetadata is set by -gopro to fall back to the GPS time GoPro cameras store in udta when mvhd looks wrong
+var goproMetadata bool
+
+// maxGoProUdtaSize bounds the GPMF atom read into memory, it holds a few kilobytes of camera settings
+const maxGoProUdtaSize = 1 << 20
+
+// plausibleVideoTime reports whether a mvhd time can be a real capture time.  Cameras with an unset clock write 0 (1904) or dates before they were made, a wrong clock may also be in the future
+func plausibleVideoTime(t time.Time) bool {
+	return t.Year() >= 2005 && t.Before(time.Now().Add(24*time.Hour))
+}
+
+// getGoProCreationTime reads the GPSU (GPS UTC time) entry of the GPMF metadata in the udta atom of a GoPro video
+func getGoProCreationTime(r io.ReadSeeker) (time.Time, error) {
+	a, err := findAtom(r, "moov", "udta", "GPMF")
+	if err != nil {
+		return time.Time{}, err
+	}
+	data, err := readAtomData(r, a, maxGoProUdtaSize)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return gpmfGPSTime(data)
+}
+
+// gpmfGPSTime walks GPMF key-length-value entries, descending into nested ones, for the first GPSU timestamp
+func gpmfGPSTime(data []byte) (time.Time, error) {
+	for len(data) >= 8 {
+		key := string(data[:4])
+		valueType := data[4]
+		length := int(data[5]) * int(binary.BigEndian.Uint16(data[6:8]))
+		padded := (length + 3) &^ 3
+		if 8+length > len(data) {
+			return time.Time{}, errors.New("Truncated GPMF entry " + key)
+		}
+		value := data[8 : 8+length]
+		switch {
+		case valueType == 0:
+			if t, err := gpmfGPSTime(value); err == nil {
+				return t, nil
+			}
+		case key == "GPSU" && valueType == 'U' && length >= 16:
+			// yymmddhhmmss.sss in UTC
+			t, err := time.Parse("060102150405.000", string(value[:16]))
+			if err != nil {
+				return time.Time{}, errors.New("Invalid GPSU " + string(value[:16]))
+			}
+			return t.Local(), nil
+		}
+		if 8+padded > len(data) {
+			break
+		}
+		data = data[8+padded:]
+	}
+	return time.Time{}, errors.New("No GPSU entry in GPMF")
+}
+
+// metaChildren returns the part of a meta atom holding its children.  MP4 writes meta as a full atom, with version and flags before the children, QuickTime without them
+func metaChildren(r io.ReadSeeker, meta atom) atom {
+	header := make([]byte, 4)
+	if _, err := r.Seek(meta.Offset, io.SeekStart); err != nil || meta.Size < 4 {
+		return meta
+	}
+	if _, err := io.ReadFull(r, header); err != nil || binary.BigEndian.Uint32(header) != 0 {
+		return meta
+	}
+	meta.Offset, meta.Size = meta.Offset+4, meta.Size-4
+	return meta
+}
+
+// udtaDayType is the ©day atom, the recording date phones that leave mvhd at 0 still write into the user data
+const udtaDayType = "\xa9day"
+
+// maxUdtaDaySize bounds the ©day atom read into memory, it holds a date string
+const maxUdtaDaySize = 1024
+
+// getUserDataDay reads the ISO 8601 date of the ©day atom in moov/udta, either the QuickTime form straight under udta or the iTunes form in udta/meta/ilst.  A date without a zone is taken as local time
+func getUserDataDay(r io.ReadSeeker) (time.Time, error) {
+	udta, err := findAtom(r, "moov", "udta")
+	if err != nil {
+		return time.Time{}, err
+	}
+	var value string
+	if day, err := childAtom(r, udta, udtaDayType); err == nil {
+		// string length and language code, then the string
+		data, err := readAtomData(r, day, maxUdtaDaySize)
+		if err != nil || len(data) < 4 {
+			return time.Time{}, errors.New("Invalid " + udtaDayType + " atom")
+		}
+		value = string(data[4:])
+	} else {
+		meta, err := childAtom(r, udta, "meta")
+		if err != nil {
+			return time.Time{}, err
+		}
+		day, err := childAtom(r, metaChildren(r, meta), "ilst", udtaDayType, "data")
+		if err != nil {
+			return time.Time{}, err
+		}
+		// data type and locale, then the string
+		data, err := readAtomData(r, day, maxUdtaDaySize)
+		if err != nil || len(data) < 8 {
+			return time.Time{}, errors.New("Invalid " + udtaDayType + " atom")
+		}
+		value = string(data[8:])
+	}
+	mt, ok := parseCommentDate(value)
+	if !ok {
+		return time.Time{}, errors.New("Could not parse " + udtaDayType + " date " + value)
+	}
+	if !mt.Zoned {
+		return localWallClock(mt.Time), nil
+	}
+	return mt.Time.Local(), nil
+}
+
+// localWallClock takes a date read without a zone as local time
+func localWallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+}
+
+// quickTimeCreationDateKey is the key of the creation date in the keys metadata of QuickTime movies, written by iPhones and drones with the zone of the place of recording
+const quickTimeCreationDateKey = "com.apple.quicktime.creationdate"
+
+// maxKeysSize bounds the keys atom read into memory, it holds a list of key names
+const maxKeysSize = 1 << 16
+
+// getQuickTimeCreationDate reads the creationdate of the moov/meta keys and ilst atoms.  keys lists the key names, the ilst atom holding a key's value is named after its 1 based index in that list.  A date with a zone keeps that zone, one without is taken as local time
+func getQuickTimeCreationDate(r io.ReadSeeker) (time.Time, bool, error) {
+	meta, err := findAtom(r, "moov", "meta")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	meta = metaChildren(r, meta)
+	keys, err := childAtom(r, meta, "keys")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	data, err := readAtomData(r, keys, maxKeysSize)
+	if err != nil || len(data) < 8 {
+		return time.Time{}, false, errors.New("Invalid keys atom")
+	}
+	// version and flags, the entry count, then every key as size, namespace and name
+	count := binary.BigEndian.Uint32(data[4:])
+	index := uint32(0)
+	data = data[8:]
+	for i := uint32(1); i <= count && len(data) >= 8; i++ {
+		size := binary.BigEndian.Uint32(data)
+		if size < 8 || uint64(size) > uint64(len(data)) {
+			return time.Time{}, false, errors.New("Invalid keys atom")
+		}
+		if string(data[8:size]) == quickTimeCreationDateKey {
+			index = i
+			break
+		}
+		data = data[size:]
+	}
+	if index == 0 {
+		return time.Time{}, false, errors.New("No " + quickTimeCreationDateKey + " key")
+	}
+	name := make([]byte, 4)
+	binary.BigEndian.PutUint32(name, index)
+	value, err := childAtom(r, meta, "ilst", string(name), "data")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	// data type and locale, then the string
+	data, err = readAtomData(r, value, maxUdtaDaySize)
+	if err != nil || len(data) < 8 {
+		return time.Time{}, false, errors.New("Invalid " + quickTimeCreationDateKey + " value")
+	}
+	mt, ok := parseCommentDate(string(data[8:]))
+	if !ok {
+		return time.Time{}, false, errors.New("Could not parse " + quickTimeCreationDateKey + " " + string(data[8:]))
+	}
+	if !mt.Zoned {
+		return localWallClock(mt.Time), false, nil
+	}
+	return mt.Time, true, nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// appleEpoch is the number of seconds from 1904, where QuickTime times start, to 1970
+const appleEpoch = 2082844800
+
+// atomBytes returns an MP4 atom of kind name holding the bytes of parts
+func atomBytes(name string, parts ...[]byte) []byte {
+	var body []byte
+	for _, part := range parts {
+		body = append(body, part...)
+	}
+	data := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(data, name...), body...)
+}
+
+// mvhdAtom returns a version 0 movie header created at t, zero when t is zero
+func mvhdAtom(t time.Time) []byte {
+	var seconds uint32
+	if !t.IsZero() {
+		seconds = uint32(t.Unix() + appleEpoch)
+	}
+	body := []byte{0, 0, 0, 0}
+	body = binary.BigEndian.AppendUint32(body, seconds)
+	body = binary.BigEndian.AppendUint32(body, seconds)
+	body = binary.BigEndian.AppendUint32(body, 1000)
+	body = binary.BigEndian.AppendUint32(body, 5000)
+	return atomBytes("mvhd", body, make([]byte, 80))
+}
+
+// mvhdAtomV1 returns a version 1 movie header, with 64 bit times, created at t
+func mvhdAtomV1(t time.Time) []byte {
+	seconds := uint64(t.Unix() + appleEpoch)
+	body := []byte{1, 0, 0, 0}
+	body = binary.BigEndian.AppendUint64(body, seconds)
+	body = binary.BigEndian.AppendUint64(body, seconds)
+	body = binary.BigEndian.AppendUint32(body, 600)
+	body = binary.BigEndian.AppendUint64(body, 3000)
+	return atomBytes("mvhd", body, make([]byte, 80))
+}
+
+// trakAtom returns a track whose media header was created at t, zero when t is zero
+func trakAtom(t time.Time) []byte {
+	var seconds uint32
+	if !t.IsZero() {
+		seconds = uint32(t.Unix() + appleEpoch)
+	}
+	body := []byte{0, 0, 0, 0}
+	body = binary.BigEndian.AppendUint32(body, seconds)
+	body = binary.BigEndian.AppendUint32(body, seconds)
+	body = binary.BigEndian.AppendUint32(body, 48000)
+	body = binary.BigEndian.AppendUint32(body, 240000)
+	return atomBytes("trak", atomBytes("mdia", atomBytes("mdhd", body, make([]byte, 4))))
+}
+
+// mp4WithTime returns a minimal MP4 whose movie header was created at t
+func mp4WithTime(t time.Time, atoms ...[]byte) []byte {
+	ftyp := atomBytes("ftyp", []byte("mp41"), make([]byte, 4))
+	return append(ftyp, atomBytes("moov", append([][]byte{mvhdAtom(t)}, atoms...)...)...)
+}
+
+// gpmfEntry is a GPMF key-length-value entry of count values of size bytes, padded to 4 bytes
+func gpmfEntry(key string, valueType byte, size int, count int, data []byte) []byte {
+	entry := append([]byte(key), valueType, byte(size), byte(count>>8), byte(count))
+	entry = append(entry, data...)
+	for len(entry)%4 != 0 {
+		entry = append(entry, 0)
+	}
+	return entry
+}
+
+// goProDevice is the GPMF DEVC entry of a GoPro whose GPS fix was taken at gpsu, a yymmddhhmmss.sss UTC time
+func goProDevice(gpsu string) []byte {
+	inner := append(gpmfEntry("DVNM", 'c', 1, 7, []byte("HERO11 ")), gpmfEntry("GPSU", 'U', 16, 1, []byte(gpsu))...)
+	return gpmfEntry("DEVC", 0, 4, len(inner)/4, inner)
+}
+
+// goProUdta is the udta atom of a GoPro video holding goProDevice
+func goProUdta(gpsu string) []byte {
+	return atomBytes("udta", atomBytes("FIRM", []byte("H22.01")), atomBytes("GPMF", goProDevice(gpsu)))
+}
+
+func TestGpmfGPSTime(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want time.Time
+		fail bool
+	}{
+		{"nested in DEVC", goProDevice("230415123456.789"), time.Date(2023, 4, 15, 12, 34, 56, 789000000, time.UTC), false},
+		{"top level", gpmfEntry("GPSU", 'U', 16, 1, []byte("991231235959.000")), time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), false},
+		{"invalid time", gpmfEntry("GPSU", 'U', 16, 1, []byte("23041512345x.789")), time.Time{}, true},
+		{"truncated", gpmfEntry("GPSU", 'U', 16, 1, []byte("230415123456.789"))[:12], time.Time{}, true},
+		{"no GPSU", gpmfEntry("DVNM", 'c', 1, 7, []byte("HERO11 ")), time.Time{}, true},
+	}
+	for _, test := range tests {
+		got, err := gpmfGPSTime(test.data)
+		if (err != nil) != test.fail || !got.Equal(test.want) {
+			t.Errorf("%s: gpmfGPSTime = %v, %v, want %v, failure %v", test.name, got, err, test.want, test.fail)
+		}
+	}
+}
+
+func TestGoProFlag(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		// without -gopro the udta is not read and the unset clock is taken as it is
+		{nil, []string{"1904-01-01 00.00.00.MP4", "2023-04-15 14.00.00.MP4"}},
+		{[]string{"-gopro"}, []string{"2023-04-15 12.34.56.MP4", "2023-04-15 14.00.00.MP4"}},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		// a camera with an unset clock, then one whose plausible mvhd wins over the GPS time
+		writeTestFile(t, dir, "GX010001.MP4", mp4WithTime(time.Time{}, goProUdta("230415123456.789")))
+		writeTestFile(t, dir, "GX010002.MP4", mp4WithTime(time.Date(2023, 4, 15, 14, 0, 0, 0, time.UTC), goProUdta("230415123456.789")))
+		mustRunMain(t, append(test.args, dir)...)
+		assertFiles(t, dir, test.want...)
+	}
+}
+
+func TestGetMediaHeaderTime(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want time.Time
+		fail bool
+	}{
+		{"one track", mp4WithTime(time.Time{}, trakAtom(time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC))), time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC), false},
+		{
+			"earliest track, unset one passed over",
+			mp4WithTime(time.Time{}, trakAtom(time.Date(2021, 5, 1, 12, 30, 5, 0, time.UTC)), trakAtom(time.Time{}), trakAtom(time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC))),
+			time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC),
+			false,
+		},
+		{"no tracks", mp4WithTime(time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)), time.Time{}, true},
+		{"only unset tracks", mp4WithTime(time.Time{}, trakAtom(time.Time{})), time.Time{}, true},
+	}
+	for _, test := range tests {
+		got, err := getMediaHeaderTime(bytes.NewReader(test.data))
+		if (err != nil) != test.fail {
+			t.Errorf("%s: getMediaHeaderTime error %v, want failure %v", test.name, err, test.fail)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("%s: getMediaHeaderTime = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMdhdDiffersFromMvhd(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	recorded := time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		// mvhd wins by default, mdhd stands in for an unset one
+		{"preferred", nil, []string{"2021-05-01 12.30.00.mp4", "2022-03-04 10.00.00.mp4"}},
+		{"earliest", []string{"-pick", "earliest"}, []string{"2021-05-01 12.30.00.mp4", "2021-05-01 12.30.00-1.mp4"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, dir, "edited.mp4", mp4WithTime(time.Date(2022, 3, 4, 10, 0, 0, 0, time.UTC), trakAtom(recorded)))
+			writeTestFile(t, dir, "unset.mp4", mp4WithTime(time.Time{}, trakAtom(recorded)))
+			mustRunMain(t, append(test.args, dir)...)
+			assertFiles(t, dir, test.want...)
+		})
+	}
+}
+
+func TestHeaderCreationTime(t *testing.T) {
+	version1 := func(seconds uint64) []byte {
+		return binary.BigEndian.AppendUint64([]byte{1, 0, 0, 0}, seconds)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want int64
+		ok   bool
+	}{
+		{"version 0", binary.BigEndian.AppendUint32([]byte{0, 0, 0, 0}, 3700000000), 3700000000, true},
+		{"version 1", version1(3700000000), 3700000000, true},
+		// past 2040 the seconds since 1904 no longer fit in 32 bits
+		{"version 1 past 32 bits", version1(1 << 32), 1 << 32, true},
+		{"truncated version 0", []byte{0, 0, 0, 0, 1}, 0, false},
+		{"truncated version 1", version1(3700000000)[:10], 0, false},
+	}
+	for _, test := range tests {
+		got, ok := headerCreationTime(test.data)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: headerCreationTime = %d, %v, want %d, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestMvhdVersions(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	recorded := time.Date(2023, 9, 20, 18, 45, 12, 0, time.UTC)
+	ftyp := atomBytes("ftyp", []byte("qt  "), make([]byte, 4))
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"version 0", mp4WithTime(recorded)},
+		{"version 1", append(ftyp, atomBytes("moov", mvhdAtomV1(recorded))...)},
+	}
+	for _, test := range tests {
+		got, err := getVideoCreationTimeMetadata(bytes.NewReader(test.data))
+		if err != nil || !got.Equal(recorded) {
+			t.Errorf("%s: getVideoCreationTimeMetadata = %v, %v, want %v", test.name, got, err, recorded)
+		}
+		dir := t.TempDir()
+		writeTestFile(t, dir, "IMG_0001.MOV", test.data)
+		mustRunMain(t, dir)
+		assertFiles(t, dir, "2023-09-20 18.45.12.MOV")
+	}
+}
+
+func TestFragmentedMP4(t *testing.T) {
+	t.Setenv("TZ", "UTC")
+	recorded := time.Date(2022, 11, 5, 16, 20, 30, 0, time.UTC)
+	fixture, err := os.ReadFile(filepath.Join("testdata", "fragmented.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragment := append(atomBytes("moof", atomBytes("mfhd", make([]byte, 8)), atomBytes("traf", atomBytes("tfdt", make([]byte, 12)))), atomBytes("mdat", make([]byte, 32))...)
+	tests := []struct {
+		name string
+		data []byte
+		fail bool
+	}{
+		// ftyp, moov holding mvex before mvhd, sidx, then two moof and mdat fragments
+		{"initialization moov first", fixture, false},
+		{"fragments before moov", append(append(atomBytes("styp", []byte("msdh"), make([]byte, 4)), fragment...), atomBytes("moov", mvhdAtom(recorded))...), false},
+		{"fragments without moov", append(atomBytes("styp", []byte("msdh"), make([]byte, 4)), fragment...), true},
+	}
+	for _, test := range tests {
+		got, err := getVideoCreationTimeMetadata(bytes.NewReader(test.data))
+		if (err != nil) != test.fail {
+			t.Errorf("%s: getVideoCreationTimeMetadata error %v, want failure %v", test.name, err, test.fail)
+			continue
+		}
+		if !test.fail && !got.Equal(recorded) {
+			t.Errorf("%s: getVideoCreationTimeMetadata = %v, want %v", test.name, got, recorded)
+		}
+	}
+
+	dir := t.TempDir()
+	copyTestdata(t, dir, "fragmented.mp4", "stream.mp4")
+	mustRunMain(t, dir)
+	assertFiles(t, dir, "2022-11-05 16.20.30.mp4")
+}